@@ -20,38 +20,85 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/k9securityio/k9-cli/core"
+	"io"
 	"os"
+	"time"
+
+	"github.com/k9securityio/k9-cli/core"
+	"github.com/k9securityio/k9-cli/core/api"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var analyzeAccountCmd = &cobra.Command{
 	Use:   "account",
 	Short: `Analyze the specified account`,
+	Long: `Starts an analysis of the account and records the execution in the
+report home, see analyze status. With --wait the command polls the
+execution until it completes and then, when a bucket is configured, syncs
+the report it produced.`,
 	Run: func(cmd *cobra.Command, args []string) {
 
-		cfg, err := config.LoadDefaultConfig(context.TODO())
-		if err != nil {
-			fmt.Fprintf(cmd.ErrOrStderr(), "Error retrieving AWS configuration: %v+\n", err)
-			os.Exit(1)
-		}
+		cfg := loadAWSConfig(cmd)
 
 		stdout := cmd.OutOrStdout()
+		stderr := cmd.ErrOrStderr()
+
+		customerID := stringFlagOrConfig(cmd, FLAG_CUSTOMER_ID, CONFIG_CUSTOMER_ID)
+		accountID := stringFlagOrConfig(cmd, FLAG_ACCOUNT, CONFIG_ACCOUNT)
+		apiHost := stringFlagOrConfig(cmd, FLAG_API, CONFIG_API)
+		client := newAPIClient(cmd, stderr, cfg, apiHost)
+		wait, _ := cmd.Flags().GetBool(FLAG_WAIT)
+		interval, _ := cmd.Flags().GetDuration(FLAG_POLL_INTERVAL)
+		timeout, _ := cmd.Flags().GetDuration(FLAG_TIMEOUT)
+		bucket := stringFlagOrConfig(cmd, FLAG_BUCKET, CONFIG_BUCKET)
+		reportHome := getReportHome(cmd)
+		logPath := core.ExecutionLogPath(reportHome)
 
-		customerID, _ := cmd.Flags().GetString(FLAG_CUSTOMER_ID)
-		accountID, _ := cmd.Flags().GetString(FLAG_ACCOUNT)
-		apiHost, _ := cmd.Flags().GetString("api")
-		if apiHost == "" {
-			apiHost = "api.k9security.io"
+		fmt.Fprintf(stdout, "Starting analysis of %v account %v using %v\n", customerID, accountID, client.URL())
+		execution, err := core.AnalyzeAccount(context.Background(), stdout, client, customerID, accountID)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error triggering analysis for %v account %v: %v+\n", customerID, accountID, err)
+			os.Exit(1)
+		}
+		if err = core.RecordExecution(logPath, execution); err != nil {
+			fmt.Fprintf(stderr, "Unable to record execution %v: %v\n", execution.ExecutionID, err)
+		}
+		if !wait {
+			return
 		}
 
-		fmt.Fprintf(stdout, "Starting analysis of %v account %v using %v\n", customerID, accountID, apiHost)
-		err = core.AnalyzeAccount(os.Stdout, cfg, apiHost, customerID, accountID)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		status := ``
+		execution, err = core.WaitForAnalysis(ctx, execution, interval,
+			func(e core.AnalysisExecution) (core.AnalysisExecution, error) {
+				return core.GetAnalysisStatus(ctx, client, e)
+			},
+			func(e core.AnalysisExecution) {
+				if e.Status != status {
+					status = e.Status
+					fmt.Fprintf(stdout, "Execution %v is %v\n", e.ExecutionID, e.Status)
+				}
+				if err := core.RecordExecution(logPath, e); err != nil {
+					fmt.Fprintf(stderr, "Unable to record execution %v: %v\n", e.ExecutionID, err)
+				}
+			})
 		if err != nil {
-			fmt.Fprintf(cmd.ErrOrStderr(), "Error triggering analysis for %v account %v: %v+\n", customerID, accountID, err)
+			fmt.Fprintf(stderr, "Error waiting for analysis: %v\n", err)
+			os.Exit(1)
+		}
+		if execution.Status != core.ANALYSIS_STATUS_SUCCEEDED {
+			fmt.Fprintf(stderr, "Analysis %v did not succeed: %v\n", execution.ExecutionID, execution.Status)
+			os.Exit(1)
+		}
+
+		if len(bucket) <= 0 {
+			fmt.Fprintln(stdout, `No bucket configured, skipping sync of the new report`)
+			return
+		}
+		if err = syncExecutionReport(ctx, stdout, stderr, openReportStore(cmd, cfg, bucket), reportHome, execution, interval); err != nil {
+			fmt.Fprintf(stderr, "Error syncing the new report: %v\n", err)
 			os.Exit(1)
 		}
 	},
@@ -60,13 +107,51 @@ var analyzeAccountCmd = &cobra.Command{
 func init() {
 	analyzeCmd.AddCommand(analyzeAccountCmd)
 	analyzeAccountCmd.Flags().String(`account`, ``, "The AWS account number for analysis (required)")
-	analyzeAccountCmd.MarkFlagRequired(`account`)
-	viper.BindPFlag(`account`, analyzeAccountCmd.Flags().Lookup(`account`))
+	markFlagRequiredOrConfig(analyzeAccountCmd.Flags(), FLAG_ACCOUNT, CONFIG_ACCOUNT)
 
-	analyzeAccountCmd.Flags().String(`customer_id`, ``, `K9 customer ID that owns the account`)
-	analyzeAccountCmd.MarkFlagRequired(`customer_id`)
-	viper.BindPFlag(`customer_id`, analyzeAccountCmd.Flags().Lookup(`customer_id`))
+	analyzeAccountCmd.Flags().String(`customer_id`, ``, `K9 customer ID that owns the account, defaults to customer_id in the config file`)
+	markFlagRequiredOrConfig(analyzeAccountCmd.Flags(), FLAG_CUSTOMER_ID, CONFIG_CUSTOMER_ID)
+
+	analyzeAccountCmd.Flags().String(FLAG_API, api.DEFAULT_HOST, `K9 API to use for analysis`)
+	addAPIClientFlags(analyzeAccountCmd)
+
+	analyzeAccountCmd.Flags().Bool(FLAG_WAIT, false, `Wait for the analysis to complete, then sync the new report`)
+	analyzeAccountCmd.Flags().Duration(FLAG_POLL_INTERVAL, 30*time.Second, `How often to check the status of the analysis with --wait`)
+	analyzeAccountCmd.Flags().Duration(FLAG_TIMEOUT, time.Hour, `How long to wait for the analysis and its report with --wait`)
+	analyzeAccountCmd.Flags().String(FLAG_BUCKET, ``, `S3 bucket location of your K9 secure inbox, to sync the new report with --wait`)
+}
 
-	analyzeAccountCmd.Flags().String(`api`, ``, `K9 API to use for analysis`)
-	viper.BindPFlag(`api`, analyzeAccountCmd.Flags().Lookup(`api`))
+// syncExecutionReport waits for the report of a completed execution to be
+// delivered to the bucket and syncs it to the report home.
+func syncExecutionReport(ctx context.Context, stdout, stderr io.Writer,
+	store core.ReportStore, reportHome string,
+	execution core.AnalysisExecution, interval time.Duration) error {
+
+	// report file names are truncated to the minute
+	started := execution.StartedAt.Truncate(time.Minute)
+	for {
+		s3db, err := core.LoadStoreDB(ctx, store, core.ReportTypeSelector{core.EXT_CSV})
+		if err != nil {
+			return err
+		}
+		account := s3db.Customers[execution.CustomerID].Accounts[execution.Account]
+		if len(account.Reports) > 0 && !account.Latest().Timestamp.Before(started) {
+			_, err = core.SyncAccounts(stdout, stderr, s3db, store,
+				reportHome,
+				[]core.AccountKey{{CustomerID: execution.CustomerID, Account: execution.Account}},
+				core.SyncOptions{Filter: core.ReportFilter{Latest: 1}, Concurrency: 1, Retries: 3})
+			if err == nil {
+				fmt.Fprintf(stdout, "Synced the report from %v\n",
+					account.Latest().Timestamp.Format(core.FILENAME_TIMESTAMP_LAYOUT))
+			}
+			return err
+		}
+
+		fmt.Fprintf(stdout, "Waiting for the report of execution %v to be delivered\n", execution.ExecutionID)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("the report of execution %v was not delivered: %w", execution.ExecutionID, ctx.Err())
+		case <-time.After(interval):
+		}
+	}
 }
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/k9securityio/k9-cli/core"
+)
+
+func TestSyncExecutionReport(t *testing.T) {
+	inbox := t.TempDir()
+	dir := `customers/C1/reports/aws/111/2022/05/`
+	writeReportFiles(t, inbox, map[string]string{
+		dir + `principals.2022-05-01-0714.csv`: "a,b\n1,2\n",
+		dir + `principals.2022-05-04-0900.csv`: "a,b\n1,2\n",
+		dir + `resources.2022-05-04-0900.csv`:  "a,b\n1,2\n",
+	})
+	store := core.NewLocalStore(inbox)
+
+	cases := map[string]struct {
+		StartedAt   time.Time
+		Expected    []string
+		ExpectedErr bool
+	}{
+		`Delivered`: {
+			// started within the minute the report is named after
+			StartedAt: time.Date(2022, time.May, 4, 9, 0, 40, 0, time.UTC),
+			Expected:  []string{dir + `principals.2022-05-04-0900.csv`, dir + `resources.2022-05-04-0900.csv`},
+		},
+		`Not delivered`: {
+			StartedAt:   time.Date(2022, time.May, 4, 9, 1, 0, 0, time.UTC),
+			ExpectedErr: true,
+		},
+	}
+	for l, c := range cases {
+		reportHome := t.TempDir()
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		err := syncExecutionReport(ctx, io.Discard, io.Discard, store, reportHome,
+			core.AnalysisExecution{ExecutionID: `e1`, CustomerID: `C1`, Account: `111`, StartedAt: c.StartedAt},
+			10*time.Millisecond)
+		cancel()
+		if (err != nil) != c.ExpectedErr {
+			t.Errorf("Case: %v, expected error %v, but was %v", l, c.ExpectedErr, err)
+			continue
+		}
+
+		synced := []string{}
+		filepath.Walk(reportHome, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() && info.Name()[0] != '.' {
+				rel, _ := filepath.Rel(reportHome, path)
+				synced = append(synced, filepath.ToSlash(rel))
+			}
+			return nil
+		})
+		if len(synced) != len(c.Expected) {
+			t.Errorf("Case: %v, expected %v, but was %v", l, c.Expected, synced)
+			continue
+		}
+		for i := range synced {
+			if synced[i] != c.Expected[i] {
+				t.Errorf("Case: %v, expected %v, but was %v", l, c.Expected, synced)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,158 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cmd contains all cobra commands
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/k9securityio/k9-cli/core"
+	"github.com/k9securityio/k9-cli/core/api"
+	"github.com/k9securityio/k9-cli/views"
+	"github.com/spf13/cobra"
+)
+
+var analyzeAccountsCmd = &cobra.Command{
+	Use:   "accounts",
+	Short: `Analyze many accounts at once`,
+	Long: `Starts an analysis of every account of the customer that has delivered
+reports to the secure inbox (--all), or of each account listed in a file,
+one account ID per line (--accounts-file, - reads stdin). Analyses are
+started --concurrency at a time, no faster than --rate per second, and each
+execution is recorded in the report home, see analyze status. A table of
+execution IDs and failures is written when all have been requested.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		stdout := cmd.OutOrStdout()
+		stderr := cmd.ErrOrStderr()
+
+		customerID := stringFlagOrConfig(cmd, FLAG_CUSTOMER_ID, CONFIG_CUSTOMER_ID)
+		all, _ := cmd.Flags().GetBool(FLAG_ALL)
+		accountsFile, _ := cmd.Flags().GetString(FLAG_ACCOUNTS_FILE)
+		bucket := stringFlagOrConfig(cmd, FLAG_BUCKET, CONFIG_BUCKET)
+		apiHost := stringFlagOrConfig(cmd, FLAG_API, CONFIG_API)
+		concurrency, _ := cmd.Flags().GetInt(FLAG_CONCURRENCY)
+		rate, _ := cmd.Flags().GetFloat64(FLAG_RATE)
+		format, _ := cmd.Flags().GetString(FLAG_FORMAT)
+		logPath := core.ExecutionLogPath(getReportHome(cmd))
+
+		if all == (len(accountsFile) > 0) {
+			fmt.Fprintf(stderr, "exactly one of --%v or --%v is required\n", FLAG_ALL, FLAG_ACCOUNTS_FILE)
+			os.Exit(1)
+		}
+		if all && len(bucket) <= 0 {
+			fmt.Fprintf(stderr, "--%v needs a bucket to discover accounts, set --%v or bucket in the config file\n", FLAG_ALL, FLAG_BUCKET)
+			os.Exit(1)
+		}
+		if concurrency < 1 || rate < 0 {
+			fmt.Fprintf(stderr, "--%v must be at least 1 and --%v must not be negative\n", FLAG_CONCURRENCY, FLAG_RATE)
+			os.Exit(1)
+		}
+
+		cfg := loadAWSConfig(cmd)
+
+		var accounts []core.AccountKey
+		if all {
+			s3db, err := core.LoadStoreDB(context.TODO(), openReportStore(cmd, cfg, bucket), core.ReportTypeSelector{core.EXT_CSV})
+			if err != nil {
+				fmt.Fprintf(stderr, "Error loading remote database: %v+\n", err)
+				os.Exit(1)
+			}
+			accounts = s3db.AccountKeys(customerID)
+		} else {
+			var err error
+			accounts, err = readAccountsFile(cmd.InOrStdin(), accountsFile, customerID)
+			if err != nil {
+				fmt.Fprintf(stderr, "Unable to read accounts from %v: %v\n", accountsFile, err)
+				os.Exit(1)
+			}
+		}
+		if len(accounts) == 0 {
+			fmt.Fprintf(stderr, "No accounts to analyze for customer %v\n", customerID)
+			os.Exit(1)
+		}
+
+		client := newAPIClient(cmd, stderr, cfg, apiHost)
+		fmt.Fprintf(stderr, "Starting analysis of %v %v accounts using %v\n", len(accounts), customerID, client.URL())
+
+		var mu sync.Mutex
+		results, err := core.AnalyzeAccounts(context.Background(), accounts,
+			core.BatchOptions{Concurrency: concurrency, Rate: rate},
+			func(ctx context.Context, a core.AccountKey) (core.AnalysisExecution, error) {
+				execution, err := core.AnalyzeAccount(ctx, io.Discard, client, a.CustomerID, a.Account)
+				if err != nil {
+					return execution, err
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if err := core.RecordExecution(logPath, execution); err != nil {
+					fmt.Fprintf(stderr, "Unable to record execution %v: %v\n", execution.ExecutionID, err)
+				}
+				return execution, nil
+			})
+		views.Display(stdout, stderr, format, results)
+		if err != nil {
+			var aggregate *core.AggregateError
+			if errors.As(err, &aggregate) {
+				fmt.Fprintf(stderr, "%v of %v analyses failed to start\n", len(aggregate.Errors()), len(accounts))
+			}
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	analyzeCmd.AddCommand(analyzeAccountsCmd)
+
+	analyzeAccountsCmd.Flags().String(FLAG_CUSTOMER_ID, ``, `K9 customer ID that owns the accounts, defaults to customer_id in the config file`)
+	markFlagRequiredOrConfig(analyzeAccountsCmd.Flags(), FLAG_CUSTOMER_ID, CONFIG_CUSTOMER_ID)
+	analyzeAccountsCmd.Flags().Bool(FLAG_ALL, false, `Analyze every account with reports in the secure inbox`)
+	analyzeAccountsCmd.Flags().String(FLAG_ACCOUNTS_FILE, ``, `File listing the accounts to analyze, one per line, - for stdin`)
+	analyzeAccountsCmd.Flags().String(FLAG_BUCKET, ``, `S3 bucket location of your K9 secure inbox, to discover accounts with --all`)
+	analyzeAccountsCmd.Flags().Int(FLAG_CONCURRENCY, 4, `Number of analyses requested at the same time`)
+	analyzeAccountsCmd.Flags().Float64(FLAG_RATE, 2, `Maximum number of analyses started per second, 0 is unlimited`)
+	analyzeAccountsCmd.Flags().String(FLAG_FORMAT, FORMAT_CSV, `Output format [csv|json]`)
+	analyzeAccountsCmd.Flags().String(FLAG_API, api.DEFAULT_HOST, `K9 API to use for analysis`)
+	addAPIClientFlags(analyzeAccountsCmd)
+}
+
+// readAccountsFile reads the accounts of the customer listed in the file at
+// path, or in stdin when path is -.
+func readAccountsFile(stdin io.Reader, path, customerID string) ([]core.AccountKey, error) {
+	r := stdin
+	if path != `-` {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	ids, err := core.ReadAccountList(r)
+	if err != nil {
+		return nil, err
+	}
+	accounts := make([]core.AccountKey, len(ids))
+	for i, id := range ids {
+		accounts[i] = core.AccountKey{CustomerID: customerID, Account: id}
+	}
+	return accounts, nil
+}
@@ -19,18 +19,64 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
 
+	"github.com/k9securityio/k9-cli/core"
+	"github.com/k9securityio/k9-cli/views"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // analyzePrincipalCmd represents the principal command
 var analyzePrincipalCmd = &cobra.Command{
 	Use:   "principal",
 	Short: "Analyze access for the specified principal",
+	Long: `Builds a dossier for one principal from the local database: its metadata,
+IAM admin status, credential hygiene, access grouped by service and
+capability, and how that access changed across recent analyses.
+
+The json format writes the full dossier, the csv format writes one row per
+access grant.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("principal called")
-		// client.AnalyzePrincipal(cmd.Flag(`account`).Value, cmd.Flag(`service`).Value)
+		verbose, _ := cmd.Flags().GetBool(FLAG_VERBOSE)
+		format, _ := cmd.Flags().GetString(FLAG_FORMAT)
+		customerID := stringFlagOrConfig(cmd, FLAG_CUSTOMER_ID, CONFIG_CUSTOMER_ID)
+		accountID := stringFlagOrConfig(cmd, FLAG_ACCOUNT, CONFIG_ACCOUNT)
+		arn, _ := cmd.Flags().GetString(FLAG_ARN)
+		name, _ := cmd.Flags().GetString(FLAG_NAME)
+		services, _ := cmd.Flags().GetStringArray(FLAG_SERVICE)
+		history, _ := cmd.Flags().GetInt(FLAG_HISTORY)
+		maxKeyAge, _ := cmd.Flags().GetInt(FLAG_MAX_CREDENTIAL_AGE_DAYS)
+		maxIdle, _ := cmd.Flags().GetInt(FLAG_MAX_CREDENTIAL_IDLE_DAYS)
+		reportHome := getReportHome(cmd)
+		stdout := cmd.OutOrStdout()
+		stderr := cmd.ErrOrStderr()
+
+		if (len(arn) > 0) == (len(name) > 0) {
+			fmt.Fprintln(stderr, `exactly one of --arn or --name is required`)
+			os.Exit(1)
+		}
+		principal := arn
+		if len(name) > 0 {
+			principal = name
+		}
+
+		serviceMap := map[string]bool{}
+		for _, s := range services {
+			serviceMap[s] = true
+		}
+		policy := core.CredentialPolicy{
+			MaxAge:  time.Duration(maxKeyAge) * 24 * time.Hour,
+			MaxIdle: time.Duration(maxIdle) * 24 * time.Hour,
+		}
+
+		DoAnalyzePrincipal(stdout, stderr,
+			reportHome, customerID, accountID, format,
+			getAnalysisDate(cmd),
+			principal, serviceMap, history, policy,
+			verbose)
 	},
 }
 
@@ -38,8 +84,229 @@ func init() {
 	analyzeCmd.AddCommand(analyzePrincipalCmd)
 
 	analyzePrincipalCmd.Flags().String(`account`, ``, "The AWS account number for analysis (required)")
-	analyzePrincipalCmd.MarkFlagRequired(`account`)
-	viper.BindPFlag(`account`, analyzePrincipalCmd.Flags().Lookup(`account`))
+	markFlagRequiredOrConfig(analyzePrincipalCmd.Flags(), FLAG_ACCOUNT, CONFIG_ACCOUNT)
+
+	analyzePrincipalCmd.Flags().String(FLAG_CUSTOMER_ID, ``, `K9 customer ID for analysis (required)`)
+	markFlagRequiredOrConfig(analyzePrincipalCmd.Flags(), FLAG_CUSTOMER_ID, CONFIG_CUSTOMER_ID)
+
+	analyzePrincipalCmd.Flags().String(FLAG_ARN, ``, `The ARN of the principal to analyze`)
+	analyzePrincipalCmd.Flags().String(FLAG_NAME, ``, `The name of the principal to analyze`)
 
 	analyzePrincipalCmd.Flags().StringArray(`service`, []string{}, "A list of service names to evaluate")
+
+	analyzePrincipalCmd.Flags().String(FLAG_ANALYSIS_DATE, ``, `Select the snapshot by date expression (default: latest): `+core.DATE_EXPRESSION_HELP)
+	addResolutionFlags(analyzePrincipalCmd)
+	analyzePrincipalCmd.Flags().String(FLAG_FORMAT, FORMAT_JSON, `Output format [json|csv]`)
+	analyzePrincipalCmd.Flags().Int(FLAG_HISTORY, 5, `The number of analyses, up to the selected one, to include in the access history`)
+	analyzePrincipalCmd.Flags().Int(FLAG_MAX_CREDENTIAL_AGE_DAYS, 365, `Days after which an unrotated password or access key is stale`)
+	analyzePrincipalCmd.Flags().Int(FLAG_MAX_CREDENTIAL_IDLE_DAYS, 90, `Days after which an active password or access key that has not been used is unused`)
+}
+
+// PrincipalGrant is a single capability a principal holds on a resource.
+type PrincipalGrant struct {
+	ServiceName      string `csv:"service_name" json:"service_name"`
+	AccessCapability string `csv:"access_capability" json:"access_capability"`
+	ResourceARN      string `csv:"resource_arn" json:"resource_arn"`
+}
+
+// PrincipalHistoryEntry summarizes a principal in one analysis and the
+// grants added or removed since the analysis before it.
+type PrincipalHistoryEntry struct {
+	AnalysisTime time.Time        `json:"analysis_time"`
+	Present      bool             `json:"present"`
+	IAMAdmin     bool             `json:"iam_admin"`
+	Grants       int              `json:"grants"`
+	Added        []PrincipalGrant `json:"added,omitempty"`
+	Removed      []PrincipalGrant `json:"removed,omitempty"`
+}
+
+// PrincipalDossier collects everything known about a principal as of one
+// analysis. Access is keyed by service and then capability.
+type PrincipalDossier struct {
+	Metadata    core.ReportMetadata            `json:"metadata"`
+	Principal   core.PrincipalsReportItem      `json:"principal"`
+	IAMAdmin    bool                           `json:"iam_admin"`
+	Credentials []core.CredentialStatus        `json:"credentials"`
+	Access      map[string]map[string][]string `json:"access"`
+	History     []PrincipalHistoryEntry        `json:"history"`
+	grants      []PrincipalGrant
+}
+
+// DoAnalyzePrincipal builds and displays the dossier of the principal
+// identified by ARN or name.
+func DoAnalyzePrincipal(stdout, stderr io.Writer,
+	reportHome, customerID, accountID, format string,
+	analysisDate *core.AnalysisDate,
+	principal string,
+	services map[string]bool,
+	history int,
+	policy core.CredentialPolicy,
+	verbose bool) {
+
+	db, err := core.LoadLocalDB(reportHome)
+	if err != nil {
+		fmt.Fprintf(stderr, "Unable to load local database, %v\n", err)
+		os.Exit(1)
+	}
+	WarnDBIssues(stderr, &db)
+	if verbose {
+		defer DumpDBStats(stderr, &db)
+	}
+
+	report, meta, ok := db.ResolveReport(customerID, accountID, analysisDate)
+	if !ok {
+		fmt.Fprintf(stderr, "No report found for customer: %v account: %v date: %v\n", customerID, accountID, analysisDate)
+		os.Exit(1)
+	}
+	if verbose {
+		fmt.Fprintf(stderr, "Target Analysis: %v\n", meta.AnalysisTime)
+	}
+
+	dossier, err := BuildPrincipalDossier(report, principal, services, policy)
+	if err != nil {
+		fmt.Fprintf(stderr, "Unable to analyze principal %v: %v\n", principal, err)
+		os.Exit(1)
+	}
+	dossier.Metadata = meta
+
+	// the history covers the selected analysis and those before it
+	account := db.Customers[customerID].Accounts[accountID]
+	previous := []core.LocalReport{}
+	for _, r := range (core.ReportFilter{}).Selects(account.Reports) {
+		if !r.Timestamp.After(report.Timestamp) {
+			previous = append(previous, r)
+		}
+	}
+	dossier.History = BuildPrincipalHistory(stderr, previous, dossier.Principal.PrincipalARN, services, history)
+
+	if format == FORMAT_CSV {
+		views.Display(stdout, stderr, format, dossier.grants)
+		return
+	}
+	views.Display(stdout, stderr, format, dossier)
+}
+
+// BuildPrincipalDossier loads the principal and its access from the report.
+// The principal is matched by ARN or name.
+func BuildPrincipalDossier(report core.LocalReport, principal string, services map[string]bool, policy core.CredentialPolicy) (PrincipalDossier, error) {
+	dossier := PrincipalDossier{Access: map[string]map[string][]string{}}
+
+	principals := &core.PrincipalsReport{}
+	if err := loadLocalReport(report, core.REPORT_TYPE_PREFIX_PRINCIPALS, principals); err != nil {
+		return dossier, err
+	}
+	found := false
+	for _, i := range principals.Items {
+		if i.PrincipalARN == principal || i.PrincipalName == principal {
+			dossier.Principal = i
+			found = true
+			break
+		}
+	}
+	if !found {
+		return dossier, fmt.Errorf("no such principal in the analysis at %v",
+			report.Timestamp.Format(core.FILENAME_TIMESTAMP_LAYOUT))
+	}
+	dossier.IAMAdmin = dossier.Principal.PrincipalIsIAMAdmin
+	dossier.Credentials = policy.Evaluate(dossier.Principal, report.Timestamp)
+
+	access := &core.PrincipalAccessSummaryReport{}
+	if err := loadLocalReport(report, core.REPORT_TYPE_PREFIX_PRINCIPAL_ACCESS_SUMMARIES, access); err != nil {
+		return dossier, err
+	}
+	dossier.grants = principalGrants(access.Items, dossier.Principal.PrincipalARN, services)
+	for _, g := range dossier.grants {
+		if _, ok := dossier.Access[g.ServiceName]; !ok {
+			dossier.Access[g.ServiceName] = map[string][]string{}
+		}
+		dossier.Access[g.ServiceName][g.AccessCapability] = append(dossier.Access[g.ServiceName][g.AccessCapability], g.ResourceARN)
+	}
+	return dossier, nil
+}
+
+// BuildPrincipalHistory summarizes the principal in the last limit reports,
+// oldest first. Reports that cannot be loaded are skipped with a warning.
+func BuildPrincipalHistory(stderr io.Writer, reports []core.LocalReport, arn string, services map[string]bool, limit int) []PrincipalHistoryEntry {
+	// one extra report provides the baseline for the oldest entry
+	if limit < 0 {
+		limit = 0
+	}
+	if len(reports) > limit+1 {
+		reports = reports[len(reports)-limit-1:]
+	}
+
+	out := []PrincipalHistoryEntry{}
+	var before map[PrincipalGrant]bool
+	for _, r := range reports {
+		principals := &core.PrincipalsReport{}
+		access := &core.PrincipalAccessSummaryReport{}
+		if err := loadLocalReport(r, core.REPORT_TYPE_PREFIX_PRINCIPALS, principals); err != nil {
+			fmt.Fprintf(stderr, "Skipping analysis %v: %v\n", r.Timestamp.Format(core.FILENAME_TIMESTAMP_LAYOUT), err)
+			continue
+		}
+		if err := loadLocalReport(r, core.REPORT_TYPE_PREFIX_PRINCIPAL_ACCESS_SUMMARIES, access); err != nil {
+			fmt.Fprintf(stderr, "Skipping analysis %v: %v\n", r.Timestamp.Format(core.FILENAME_TIMESTAMP_LAYOUT), err)
+			continue
+		}
+
+		entry := PrincipalHistoryEntry{AnalysisTime: r.Timestamp}
+		for _, i := range principals.Items {
+			if i.PrincipalARN == arn {
+				entry.Present = true
+				entry.IAMAdmin = i.PrincipalIsIAMAdmin
+			}
+		}
+		grants := principalGrants(access.Items, arn, services)
+		entry.Grants = len(grants)
+		after := map[PrincipalGrant]bool{}
+		for _, g := range grants {
+			after[g] = true
+			if before != nil && !before[g] {
+				entry.Added = append(entry.Added, g)
+			}
+		}
+		if before != nil {
+			entry.Removed = sortedGrants(before, after)
+		}
+		before = after
+		out = append(out, entry)
+	}
+	if len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	return out
+}
+
+// principalGrants returns the grants of the principal on the selected
+// services, or all services when none are selected, in a stable order.
+func principalGrants(items []core.PrincipalAccessSummaryReportItem, arn string, services map[string]bool) []PrincipalGrant {
+	set := map[PrincipalGrant]bool{}
+	for _, i := range items {
+		if i.PrincipalARN != arn || (len(services) > 0 && !services[i.ServiceName]) {
+			continue
+		}
+		set[PrincipalGrant{ServiceName: i.ServiceName, AccessCapability: i.AccessCapability, ResourceARN: i.ResourceARN}] = true
+	}
+	return sortedGrants(set, nil)
+}
+
+// sortedGrants returns the grants in set but not in exclude, ordered by
+// service, capability, and resource.
+func sortedGrants(set, exclude map[PrincipalGrant]bool) []PrincipalGrant {
+	out := []PrincipalGrant{}
+	for g := range set {
+		if !exclude[g] {
+			out = append(out, g)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ServiceName != out[j].ServiceName {
+			return out[i].ServiceName < out[j].ServiceName
+		}
+		if out[i].AccessCapability != out[j].AccessCapability {
+			return out[i].AccessCapability < out[j].AccessCapability
+		}
+		return out[i].ResourceARN < out[j].ResourceARN
+	})
+	return out
 }
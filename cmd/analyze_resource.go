@@ -19,25 +19,242 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"sort"
 
+	"github.com/k9securityio/k9-cli/core"
+	"github.com/k9securityio/k9-cli/views"
 	"github.com/spf13/cobra"
 )
 
 // analyzeResourceCmd represents the resource command
 var analyzeResourceCmd = &cobra.Command{
 	Use:   "resource",
-	Short: "A brief description of your command",
+	Short: "Analyze who can access the specified resource",
+	Long: `Reports who can access one resource by capability, its tags from the
+resources report, and whether the number of principals with each capability
+exceeds the over-accessibility limits. With --principal-arn the report also
+lists the capabilities that principal holds on the resource.
+
+The json format writes the full analysis, the csv format writes one row per
+principal and capability.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("analyze resource called")
+		verbose, _ := cmd.Flags().GetBool(FLAG_VERBOSE)
+		format, _ := cmd.Flags().GetString(FLAG_FORMAT)
+		customerID := stringFlagOrConfig(cmd, FLAG_CUSTOMER_ID, CONFIG_CUSTOMER_ID)
+		accountID := stringFlagOrConfig(cmd, FLAG_ACCOUNT, CONFIG_ACCOUNT)
+		resourceARN, _ := cmd.Flags().GetString(FLAG_RESOURCE_ARN)
+		principalARN, _ := cmd.Flags().GetString(FLAG_PRINCIPAL_ARN)
+		services, _ := cmd.Flags().GetStringArray(FLAG_SERVICE)
+		maxAdmins, _ := cmd.Flags().GetInt(FLAG_MAX_ADMIN)
+		maxRead, _ := cmd.Flags().GetInt(FLAG_MAX_READ)
+		maxWrite, _ := cmd.Flags().GetInt(FLAG_MAX_WRITE)
+		maxDelete, _ := cmd.Flags().GetInt(FLAG_MAX_DELETE)
+		reportHome := getReportHome(cmd)
+		stdout := cmd.OutOrStdout()
+		stderr := cmd.ErrOrStderr()
+
+		serviceMap := map[string]bool{}
+		for _, s := range services {
+			serviceMap[s] = true
+		}
+		policy := AccessibilityPolicy{
+			AdminCap:  maxAdmins,
+			ReadCap:   maxRead,
+			WriteCap:  maxWrite,
+			DeleteCap: maxDelete,
+		}
+
+		DoAnalyzeResource(stdout, stderr,
+			reportHome, customerID, accountID, format,
+			getAnalysisDate(cmd),
+			resourceARN, principalARN, serviceMap, policy,
+			verbose)
 	},
 }
 
-var ()
-
 func init() {
 	analyzeCmd.AddCommand(analyzeResourceCmd)
 	analyzeResourceCmd.Flags().StringArray(`service`, []string{}, "A list of service names")
 	analyzeResourceCmd.Flags().String(`resource-arn`, ``, "The resource to analyze (required)")
 	analyzeResourceCmd.MarkFlagRequired(`resource-arn`)
 	analyzeResourceCmd.Flags().String(`principal-arn`, ``, "The principal to analyze")
+
+	analyzeResourceCmd.Flags().String(FLAG_ACCOUNT, ``, "The AWS account number for analysis (required)")
+	markFlagRequiredOrConfig(analyzeResourceCmd.Flags(), FLAG_ACCOUNT, CONFIG_ACCOUNT)
+	analyzeResourceCmd.Flags().String(FLAG_CUSTOMER_ID, ``, `K9 customer ID for analysis (required)`)
+	markFlagRequiredOrConfig(analyzeResourceCmd.Flags(), FLAG_CUSTOMER_ID, CONFIG_CUSTOMER_ID)
+
+	analyzeResourceCmd.Flags().String(FLAG_ANALYSIS_DATE, ``, `Select the snapshot by date expression (default: latest): `+core.DATE_EXPRESSION_HELP)
+	addResolutionFlags(analyzeResourceCmd)
+	analyzeResourceCmd.Flags().String(FLAG_FORMAT, FORMAT_JSON, `Output format [json|csv]`)
+
+	analyzeResourceCmd.Flags().Int(FLAG_MAX_ADMIN, 5, "The maximum number of principals with ADMIN access to the resource.")
+	analyzeResourceCmd.Flags().Int(FLAG_MAX_READ, 5, "The maximum number of principals with READ to the resource.")
+	analyzeResourceCmd.Flags().Int(FLAG_MAX_WRITE, 5, "The maximum number of principals with WRITE to the resource.")
+	analyzeResourceCmd.Flags().Int(FLAG_MAX_DELETE, 5, "The maximum number of principals with DELETE to the resource.")
+}
+
+// ResourceGrant is a single capability a principal holds on a resource.
+type ResourceGrant struct {
+	AccessCapability string `csv:"access_capability" json:"access_capability"`
+	PrincipalARN     string `csv:"principal_arn" json:"principal_arn"`
+	PrincipalName    string `csv:"principal_name" json:"principal_name"`
+	PrincipalType    string `csv:"principal_type" json:"principal_type"`
+}
+
+// ResourcePrincipalAccess lists the capabilities one principal holds on a
+// resource.
+type ResourcePrincipalAccess struct {
+	PrincipalARN string   `json:"principal_arn"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// ResourceAnalysis collects who can access a resource as of one analysis.
+// Access is keyed by capability.
+type ResourceAnalysis struct {
+	Metadata       core.ReportMetadata      `json:"metadata"`
+	Resource       core.ResourcesReportItem `json:"resource"`
+	Access         map[string][]Principal   `json:"access"`
+	OverAccessible bool                     `json:"over_accessible"`
+	Violations     []string                 `json:"violations"`
+	Principal      *ResourcePrincipalAccess `json:"principal,omitempty"`
+	grants         []ResourceGrant
+}
+
+// DoAnalyzeResource builds and displays the access analysis of a resource.
+func DoAnalyzeResource(stdout, stderr io.Writer,
+	reportHome, customerID, accountID, format string,
+	analysisDate *core.AnalysisDate,
+	resourceARN, principalARN string,
+	services map[string]bool,
+	policy AccessibilityPolicy,
+	verbose bool) {
+
+	db, err := core.LoadLocalDB(reportHome)
+	if err != nil {
+		fmt.Fprintf(stderr, "Unable to load local database, %v\n", err)
+		os.Exit(1)
+	}
+	WarnDBIssues(stderr, &db)
+	if verbose {
+		defer DumpDBStats(stderr, &db)
+	}
+
+	report, meta, ok := db.ResolveReport(customerID, accountID, analysisDate)
+	if !ok {
+		fmt.Fprintf(stderr, "No report found for customer: %v account: %v date: %v\n", customerID, accountID, analysisDate)
+		os.Exit(1)
+	}
+	if verbose {
+		fmt.Fprintf(stderr, "Target Analysis: %v\n", meta.AnalysisTime)
+	}
+
+	analysis, err := BuildResourceAnalysis(report, resourceARN, principalARN, services, policy)
+	if err != nil {
+		fmt.Fprintf(stderr, "Unable to analyze resource %v: %v\n", resourceARN, err)
+		os.Exit(1)
+	}
+	analysis.Metadata = meta
+
+	if format == FORMAT_CSV {
+		grants := analysis.grants
+		if len(principalARN) > 0 {
+			grants = []ResourceGrant{}
+			for _, g := range analysis.grants {
+				if g.PrincipalARN == principalARN {
+					grants = append(grants, g)
+				}
+			}
+		}
+		views.Display(stdout, stderr, format, grants)
+		return
+	}
+	views.Display(stdout, stderr, format, analysis)
+}
+
+// BuildResourceAnalysis loads the resource and the principals with access to
+// it from the report. When principalARN is set the capabilities of that
+// principal are reported separately. A resource listed in the resources
+// report with conflicting rows is an error.
+func BuildResourceAnalysis(report core.LocalReport, resourceARN, principalARN string, services map[string]bool, policy AccessibilityPolicy) (ResourceAnalysis, error) {
+	analysis := ResourceAnalysis{Access: map[string][]Principal{}, Violations: []string{}}
+
+	resources := &core.ResourcesReport{}
+	if err := loadLocalReport(report, core.REPORT_TYPE_PREFIX_RESOURCES, resources); err != nil {
+		return analysis, err
+	}
+	found := false
+	for _, i := range resources.Items {
+		if i.ResourceARN != resourceARN {
+			continue
+		}
+		// repeated rows are fine, conflicting ones leave no single resource to report
+		if found && !analysis.Resource.Equivalent(i) {
+			return analysis, fmt.Errorf("ambiguous resource, the analysis at %v lists it more than once",
+				report.Timestamp.Format(core.FILENAME_TIMESTAMP_LAYOUT))
+		}
+		analysis.Resource = i
+		found = true
+	}
+
+	access := &core.ResourceAccessSummaryReport{}
+	if err := loadLocalReport(report, core.REPORT_TYPE_PREFIX_RESOURCE_ACCESS_SUMMARIES, access); err != nil {
+		return analysis, err
+	}
+	items := []core.ResourceAccessSummaryReportItem{}
+	for _, i := range access.Items {
+		if i.ResourceARN == resourceARN {
+			found = true
+			if len(services) == 0 || services[i.ServiceName] {
+				items = append(items, i)
+			}
+		}
+	}
+	if !found {
+		return analysis, fmt.Errorf("no such resource in the analysis at %v",
+			report.Timestamp.Format(core.FILENAME_TIMESTAMP_LAYOUT))
+	}
+	if len(analysis.Resource.ResourceARN) == 0 {
+		analysis.Resource.ResourceARN = resourceARN
+	}
+
+	seen := map[ResourceGrant]bool{}
+	for _, i := range items {
+		g := ResourceGrant{
+			AccessCapability: i.AccessCapability,
+			PrincipalARN:     i.PrincipalARN,
+			PrincipalName:    i.PrincipalName,
+			PrincipalType:    i.PrincipalType,
+		}
+		if !seen[g] {
+			seen[g] = true
+			analysis.grants = append(analysis.grants, g)
+		}
+	}
+	sort.Slice(analysis.grants, func(i, j int) bool {
+		if analysis.grants[i].AccessCapability != analysis.grants[j].AccessCapability {
+			return analysis.grants[i].AccessCapability < analysis.grants[j].AccessCapability
+		}
+		return analysis.grants[i].PrincipalARN < analysis.grants[j].PrincipalARN
+	})
+
+	summary := ResourceAccessSummary{ResourceARN: resourceARN, PrincipalsByCapability: analysis.Access}
+	for _, g := range analysis.grants {
+		summary.PrincipalsByCapability[g.AccessCapability] = append(summary.PrincipalsByCapability[g.AccessCapability],
+			Principal{ARN: g.PrincipalARN, Name: g.PrincipalName, Type: g.PrincipalType})
+	}
+	analysis.Violations = policy.Violations(summary)
+	analysis.OverAccessible = len(analysis.Violations) > 0
+
+	if len(principalARN) > 0 {
+		analysis.Principal = &ResourcePrincipalAccess{PrincipalARN: principalARN, Capabilities: []string{}}
+		for _, g := range analysis.grants {
+			if g.PrincipalARN == principalARN {
+				analysis.Principal.Capabilities = append(analysis.Principal.Capabilities, g.AccessCapability)
+			}
+		}
+	}
+	return analysis, nil
 }
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/k9securityio/k9-cli/core"
+)
+
+// writeReportFiles writes the files, keyed by slash separated paths relative
+// to home, and returns the local database loaded from home.
+func writeReportFiles(t *testing.T, home string, files map[string]string) core.DB {
+	for k, v := range files {
+		p := filepath.Join(home, filepath.FromSlash(k))
+		if err := os.MkdirAll(filepath.Dir(p), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(v), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := core.LoadLocalDB(home)
+	if err != nil {
+		t.Fatalf(`unexpected error loading the local database: %v`, err)
+	}
+	return db
+}
+
+func TestBuildResourceAnalysis(t *testing.T) {
+	dir := `customers/C1/reports/aws/111/2022/05/`
+	db := writeReportFiles(t, t.TempDir(), map[string]string{
+		dir + `resources.2022-05-01-0714.csv`: `analysis_time,resource_name,resource_arn,resource_type,bu,env,owner,conf,integ,avail,tags
+2022-05-01T07:14:00Z,data,arn:aws:s3:::data,S3Bucket,,prod,ops,confidential,,,
+2022-05-01T07:14:00Z,same,arn:aws:s3:::same,S3Bucket,,prod,ops,,,,
+2022-05-01T07:14:00Z,same,arn:aws:s3:::same,S3Bucket,,prod,ops,,,,
+2022-05-01T07:14:00Z,dup,arn:aws:s3:::dup,S3Bucket,,prod,ops,,,,
+2022-05-01T07:14:00Z,dup,arn:aws:s3:::dup,S3Bucket,,dev,dev,,,,
+`,
+		dir + `resource-access-summaries.2022-05-01-0714.csv`: `analysis_time,service_name,resource_name,resource_arn,access_capability,principal_type,principal_name,principal_arn,conf
+2022-05-01T07:14:00Z,S3,data,arn:aws:s3:::data,read-data,IAMRole,p1,arn:aws:iam::111:role/p1,confidential
+2022-05-01T07:14:00Z,S3,data,arn:aws:s3:::data,read-data,IAMRole,p2,arn:aws:iam::111:role/p2,confidential
+2022-05-01T07:14:00Z,S3,data,arn:aws:s3:::data,write-data,IAMRole,p1,arn:aws:iam::111:role/p1,confidential
+2022-05-01T07:14:00Z,S3,data,arn:aws:s3:::data,write-data,IAMRole,p1,arn:aws:iam::111:role/p1,confidential
+2022-05-01T07:14:00Z,KMS,logs,arn:aws:kms:::key/logs,read-data,IAMRole,p2,arn:aws:iam::111:role/p2,
+`,
+	})
+	analysis, _ := time.Parse(core.FILENAME_TIMESTAMP_LAYOUT, `2022-05-01-0714`)
+	report := db.Customers[`C1`].Accounts[`111`].Reports[analysis]
+	policy := AccessibilityPolicy{AdminCap: 5, ReadCap: 1, WriteCap: 5, DeleteCap: 5}
+
+	cases := map[string]struct {
+		ResourceARN          string
+		PrincipalARN         string
+		Services             map[string]bool
+		ExpectedErr          string
+		ExpectedOwner        string
+		ExpectedGrants       int
+		ExpectedViolations   int
+		ExpectedCapabilities string
+	}{
+		`Found`: {
+			ResourceARN: `arn:aws:s3:::data`, ExpectedOwner: `ops`,
+			ExpectedGrants: 3, ExpectedViolations: 1,
+		},
+		`Found with principal`: {
+			ResourceARN: `arn:aws:s3:::data`, PrincipalARN: `arn:aws:iam::111:role/p1`, ExpectedOwner: `ops`,
+			ExpectedGrants: 3, ExpectedViolations: 1, ExpectedCapabilities: `read-data,write-data`,
+		},
+		`Found with other service`: {
+			ResourceARN: `arn:aws:s3:::data`, Services: map[string]bool{`KMS`: true}, ExpectedOwner: `ops`,
+		},
+		`Found only in access summaries`: {ResourceARN: `arn:aws:kms:::key/logs`, ExpectedGrants: 1},
+		`Repeated rows`:                  {ResourceARN: `arn:aws:s3:::same`, ExpectedOwner: `ops`},
+		`Not found`:                      {ResourceARN: `arn:aws:s3:::missing`, ExpectedErr: `no such resource`},
+		`Ambiguous`:                      {ResourceARN: `arn:aws:s3:::dup`, ExpectedErr: `ambiguous resource`},
+	}
+	for l, c := range cases {
+		o, err := BuildResourceAnalysis(report, c.ResourceARN, c.PrincipalARN, c.Services, policy)
+		if len(c.ExpectedErr) > 0 {
+			if err == nil || !strings.Contains(err.Error(), c.ExpectedErr) {
+				t.Errorf("Case: %v, expected error %v, but was %v", l, c.ExpectedErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Case: %v, unexpected error: %v", l, err)
+			continue
+		}
+		if o.Resource.ResourceARN != c.ResourceARN {
+			t.Errorf("Case: %v, expected resource %v, but was %v", l, c.ResourceARN, o.Resource.ResourceARN)
+		}
+		if o.Resource.ResourceTagOwner != c.ExpectedOwner {
+			t.Errorf("Case: %v, expected owner %v, but was %v", l, c.ExpectedOwner, o.Resource.ResourceTagOwner)
+		}
+		if len(o.grants) != c.ExpectedGrants {
+			t.Errorf("Case: %v, expected %v grants, but was %v", l, c.ExpectedGrants, o.grants)
+		}
+		if len(o.Violations) != c.ExpectedViolations || o.OverAccessible != (c.ExpectedViolations > 0) {
+			t.Errorf("Case: %v, expected %v violations, but was %v", l, c.ExpectedViolations, o.Violations)
+		}
+		if len(c.PrincipalARN) == 0 {
+			if o.Principal != nil {
+				t.Errorf("Case: %v, expected no principal, but was %v", l, o.Principal)
+			}
+			continue
+		}
+		if o.Principal == nil || strings.Join(o.Principal.Capabilities, `,`) != c.ExpectedCapabilities {
+			t.Errorf("Case: %v, expected capabilities %v, but was %v", l, c.ExpectedCapabilities, o.Principal)
+		}
+	}
+}
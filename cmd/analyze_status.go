@@ -0,0 +1,92 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cmd contains all cobra commands
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/k9securityio/k9-cli/core"
+	"github.com/k9securityio/k9-cli/views"
+	"github.com/spf13/cobra"
+)
+
+// analyzeStatusCmd represents the status subcommand of analyze
+var analyzeStatusCmd = &cobra.Command{
+	Use:   "status [execution-id]",
+	Short: "Show the status of analyses started with analyze account",
+	Long: `Without an execution ID, lists the executions recorded in the report home,
+most recent first. With an execution ID, retrieves the current status of the
+execution from the k9 API and updates the local record. Executions that were
+not started from this report home need --customer_id and --account.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString(FLAG_FORMAT)
+		customerID := stringFlagOrConfig(cmd, FLAG_CUSTOMER_ID, CONFIG_CUSTOMER_ID)
+		accountID := stringFlagOrConfig(cmd, FLAG_ACCOUNT, CONFIG_ACCOUNT)
+		stdout := cmd.OutOrStdout()
+		stderr := cmd.ErrOrStderr()
+		logPath := core.ExecutionLogPath(getReportHome(cmd))
+
+		log, err := core.LoadExecutionLog(logPath)
+		if err != nil {
+			fmt.Fprintf(stderr, "Unable to load the execution log: %v\n", err)
+			os.Exit(1)
+		}
+		if len(args) == 0 {
+			views.Display(stdout, stderr, format, log.List())
+			return
+		}
+
+		execution, ok := log.Get(args[0])
+		if !ok {
+			if len(customerID) <= 0 || len(accountID) <= 0 {
+				fmt.Fprintf(stderr, "No record of execution %v, set --customer_id and --account to look it up\n", args[0])
+				os.Exit(1)
+			}
+			execution = core.AnalysisExecution{ExecutionID: args[0], CustomerID: customerID, Account: accountID}
+		}
+		// prefer the API that started the execution unless --api is set
+		if cmd.Flags().Changed(FLAG_API) || len(execution.APIHost) <= 0 {
+			execution.APIHost = stringFlagOrConfig(cmd, FLAG_API, CONFIG_API)
+		}
+
+		cfg := loadAWSConfig(cmd)
+		client := newAPIClient(cmd, stderr, cfg, execution.APIHost)
+		execution, err = core.GetAnalysisStatus(context.Background(), client, execution)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error retrieving analysis status: %v\n", err)
+			os.Exit(1)
+		}
+		if err = core.RecordExecution(logPath, execution); err != nil {
+			fmt.Fprintf(stderr, "Unable to record execution %v: %v\n", execution.ExecutionID, err)
+		}
+		views.Display(stdout, stderr, format, []core.AnalysisExecution{execution})
+	},
+}
+
+func init() {
+	analyzeCmd.AddCommand(analyzeStatusCmd)
+
+	analyzeStatusCmd.Flags().String(FLAG_FORMAT, FORMAT_CSV, `Output format [csv|json]`)
+	analyzeStatusCmd.Flags().String(FLAG_CUSTOMER_ID, ``, `K9 customer ID that owns the account, for executions without a local record`)
+	analyzeStatusCmd.Flags().String(FLAG_ACCOUNT, ``, `AWS account ID of the execution, for executions without a local record`)
+	analyzeStatusCmd.Flags().String(FLAG_API, ``, `K9 API to use, defaults to the API that started the execution, then the configured api`)
+	addAPIClientFlags(analyzeStatusCmd)
+}
@@ -0,0 +1,46 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/k9securityio/k9-cli/core/api"
+	"github.com/spf13/cobra"
+)
+
+// addAPIClientFlags adds the flags that tune requests to the k9 API.
+func addAPIClientFlags(cmd *cobra.Command) {
+	cmd.Flags().Duration(FLAG_API_TIMEOUT, api.DEFAULT_TIMEOUT, `Time limit for each attempt of a request to the K9 API`)
+	cmd.Flags().Int(FLAG_API_RETRIES, api.DEFAULT_RETRIES, `Number of times to retry a failed request to the K9 API`)
+}
+
+// newAPIClient returns a client for the API at host configured by the
+// flags added with addAPIClientFlags, exiting if the host is invalid.
+func newAPIClient(cmd *cobra.Command, stderr io.Writer, cfg aws.Config, host string) *api.Client {
+	timeout, _ := cmd.Flags().GetDuration(FLAG_API_TIMEOUT)
+	retries, _ := cmd.Flags().GetInt(FLAG_API_RETRIES)
+	client, err := api.New(cfg, host, api.WithTimeout(timeout), api.WithRetries(retries))
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	return client
+}
@@ -0,0 +1,85 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/k9securityio/k9-cli/core"
+	"github.com/spf13/cobra"
+)
+
+// addAWSFlags adds the flags that select AWS credentials to every command.
+func addAWSFlags(cmd *cobra.Command) {
+	flags := cmd.PersistentFlags()
+	flags.String(FLAG_AWS_PROFILE, ``, `a profile in your shared AWS config to use instead of the default credentials`)
+	flags.String(FLAG_REGION, ``, `the AWS region to use instead of the region of the AWS profile or environment`)
+	flags.String(FLAG_ROLE_ARN, ``, `an IAM role to assume, e.g. to read a secure inbox in another account`)
+	flags.String(FLAG_EXTERNAL_ID, ``, `the external ID required to assume the role`)
+	flags.String(FLAG_ROLE_SESSION_NAME, ``, `a session name for the assumed role (default: `+core.DEFAULT_ROLE_SESSION_NAME+`-<time>)`)
+	flags.Duration(FLAG_ROLE_DURATION, 0, `how long the assumed role's credentials are valid (default: 15m)`)
+	flags.String(FLAG_MFA_SERIAL, ``, `the MFA device required to assume the role`)
+	flags.String(FLAG_MFA_TOKEN, ``, `the current MFA token code, prompted for when required and not set`)
+}
+
+// awsOptions collects the AWS options from flags and configuration.
+func awsOptions(cmd *cobra.Command) core.AWSOptions {
+	duration, _ := cmd.Flags().GetDuration(FLAG_ROLE_DURATION)
+	sessionName, _ := cmd.Flags().GetString(FLAG_ROLE_SESSION_NAME)
+	return core.AWSOptions{
+		Profile:       stringFlagOrConfig(cmd, FLAG_AWS_PROFILE, CONFIG_AWS_PROFILE),
+		Region:        stringFlagOrConfig(cmd, FLAG_REGION, CONFIG_REGION),
+		RoleARN:       stringFlagOrConfig(cmd, FLAG_ROLE_ARN, CONFIG_ROLE_ARN),
+		ExternalID:    stringFlagOrConfig(cmd, FLAG_EXTERNAL_ID, CONFIG_EXTERNAL_ID),
+		SessionName:   sessionName,
+		Duration:      duration,
+		MFASerial:     stringFlagOrConfig(cmd, FLAG_MFA_SERIAL, CONFIG_MFA_SERIAL),
+		TokenProvider: mfaTokenProvider(cmd),
+	}
+}
+
+// mfaTokenProvider returns the MFA token code from the mfa-token flag, or
+// prompts for it on stderr and reads it from stdin.
+func mfaTokenProvider(cmd *cobra.Command) func() (string, error) {
+	return func() (string, error) {
+		if token, _ := cmd.Flags().GetString(FLAG_MFA_TOKEN); len(token) > 0 {
+			return token, nil
+		}
+		fmt.Fprint(cmd.ErrOrStderr(), `MFA token code: `)
+		token, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+		if len(strings.TrimSpace(token)) > 0 {
+			err = nil
+		}
+		return strings.TrimSpace(token), err
+	}
+}
+
+// loadAWSConfig loads the AWS configuration selected by the AWS flags,
+// exiting on failure.
+func loadAWSConfig(cmd *cobra.Command) aws.Config {
+	cfg, err := core.LoadAWSConfig(context.TODO(), awsOptions(cmd))
+	if err != nil {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Error retrieving AWS configuration: %v\n", err)
+		os.Exit(1)
+	}
+	return cfg
+}
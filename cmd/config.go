@@ -0,0 +1,189 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cmd contains all cobra commands
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/k9securityio/k9-cli/views"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// configKeys are the settings managed by the config command, in the order
+// they are listed.
+var configKeys = []string{
+	CONFIG_PROFILE,
+	CONFIG_CUSTOMER_ID,
+	CONFIG_ACCOUNT,
+	CONFIG_BUCKET,
+	CONFIG_API,
+	CONFIG_REPORT_HOME,
+	CONFIG_QUERY_FORMAT,
+	CONFIG_AWS_PROFILE,
+	CONFIG_REGION,
+	CONFIG_ROLE_ARN,
+	CONFIG_EXTERNAL_ID,
+	CONFIG_MFA_SERIAL,
+	CONFIG_ENDPOINT_URL,
+	CONFIG_PATH_STYLE,
+}
+
+// ConfigSetting is the effective value of a setting and where it came from.
+type ConfigSetting struct {
+	Key    string `csv:"key" json:"key"`
+	Value  string `csv:"value" json:"value"`
+	Source string `csv:"source" json:"source"`
+}
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show and change settings in the config file",
+	Long: `Settings are read from the command line, then environment variables named
+with the ` + EnvPrefix + `_ prefix, e.g. ` + EnvPrefix + `_CUSTOMER_ID, then the active profile, and
+finally the top level of the config file. A profile is a named group of
+settings under profiles in the config file, selected with --profile, ` + EnvPrefix + `_PROFILE,
+or profile in the config file:
+
+  customer_id: C123456
+  profiles:
+    prod:
+      bucket: k9-reports-prod
+      account: "123456789012"
+
+Settings are one of: ` + strings.Join(configKeys, `, `),
+
+	// set creates the profile when it does not exist yet
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return loadProfile(false)
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Save a setting in the config file, or in the active profile",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		stdout := cmd.OutOrStdout()
+		stderr := cmd.ErrOrStderr()
+		key := configKey(stderr, args[0])
+		if name := activeProfile(); len(name) > 0 && key != CONFIG_PROFILE {
+			key = profileKey(name, key)
+		}
+		path, err := writeConfigValue(key, args[1])
+		if err != nil {
+			fmt.Fprintf(stderr, "Unable to save %v to the config file: %v\n", key, err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(stdout, "Saved %v to %v\n", key, path)
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Show the effective value of a setting",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		key := configKey(cmd.ErrOrStderr(), args[0])
+		value := configValue(key)
+		if len(value) == 0 {
+			os.Exit(1)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), value)
+	},
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Show the effective value and source of each setting, and the profiles",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString(FLAG_FORMAT)
+		settings := []ConfigSetting{}
+		for _, key := range configKeys {
+			settings = append(settings, ConfigSetting{Key: key, Value: configValue(key), Source: configSource(key)})
+		}
+		names := []string{}
+		for name := range viper.GetStringMap(CONFIG_PROFILES) {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		settings = append(settings, ConfigSetting{Key: CONFIG_PROFILES, Value: strings.Join(names, ` `), Source: configSource(CONFIG_PROFILES)})
+		views.Display(cmd.OutOrStdout(), cmd.ErrOrStderr(), format, settings)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configListCmd)
+
+	configListCmd.Flags().String(FLAG_FORMAT, FORMAT_CSV, `Output format [csv|json]`)
+}
+
+// configKey validates the name of a setting, exiting if it is unknown.
+func configKey(stderr io.Writer, key string) string {
+	key = strings.ToLower(key)
+	for _, k := range configKeys {
+		if k == key {
+			return k
+		}
+	}
+	fmt.Fprintf(stderr, "Unknown setting %v, expected one of: %v\n", key, strings.Join(configKeys, `, `))
+	os.Exit(1)
+	return ``
+}
+
+// configValue returns the effective value of a setting.
+func configValue(key string) string {
+	if key == CONFIG_PROFILE {
+		return activeProfile()
+	}
+	return viper.GetString(key)
+}
+
+// configSource describes where the effective value of a setting comes from.
+func configSource(key string) string {
+	if key == CONFIG_REPORT_HOME {
+		if f := rootCmd.PersistentFlags().Lookup(FLAG_REPORT_HOME); f != nil && f.Changed {
+			return `flag`
+		}
+	}
+	if key == CONFIG_PROFILE && len(profile) > 0 {
+		return `flag`
+	}
+	if v, ok := os.LookupEnv(EnvPrefix + `_` + strings.ToUpper(key)); ok && len(v) > 0 {
+		return `env`
+	}
+	if name := activeProfile(); len(name) > 0 && key != CONFIG_PROFILE && viper.IsSet(profileKey(name, key)) {
+		return `profile ` + name
+	}
+	if viper.InConfig(key) {
+		return `config file`
+	}
+	if len(viper.GetString(key)) > 0 {
+		return `default`
+	}
+	return ``
+}
@@ -10,6 +10,31 @@ const (
 	EnvPrefix = `K9`
 )
 
+// configuration keys, these are also matched to environment variables with
+// the EnvPrefix, e.g. K9_REPORT_HOME
+const (
+	CONFIG_REPORT_HOME  = `report_home`
+	CONFIG_CUSTOMER_ID  = `customer_id`
+	CONFIG_ACCOUNT      = `account`
+	CONFIG_BUCKET       = `bucket`
+	CONFIG_API          = `api`
+	CONFIG_QUERY_FORMAT = `query_format`
+
+	CONFIG_AWS_PROFILE = `aws_profile`
+	CONFIG_REGION      = `region`
+	CONFIG_ROLE_ARN    = `role_arn`
+	CONFIG_EXTERNAL_ID = `external_id`
+	CONFIG_MFA_SERIAL  = `mfa_serial`
+
+	CONFIG_ENDPOINT_URL = `endpoint_url`
+	CONFIG_PATH_STYLE   = `path_style`
+
+	// CONFIG_PROFILE selects one of the CONFIG_PROFILES, a map of profile
+	// names to settings that take precedence over the top level settings.
+	CONFIG_PROFILE  = `profile`
+	CONFIG_PROFILES = `profiles`
+)
+
 const (
 	FLAG_CUSTOMER_ID   = `customer_id`
 	FLAG_VERBOSE       = `verbose`
@@ -17,10 +42,45 @@ const (
 	FLAG_FORMAT        = `format`
 	FLAG_ANALYSIS_DATE = `analysis-date`
 	FLAG_REPORT_HOME   = `report-home`
+	FLAG_CSV_NESTED    = `csv-nested`
+	FLAG_WITH_METADATA = `with-metadata`
+	FLAG_API           = `api`
+	FLAG_API_TIMEOUT   = `api-timeout`
+	FLAG_API_RETRIES   = `api-retries`
+	FLAG_BUCKET        = `bucket`
+	FLAG_PROFILE       = `profile`
+
+	FLAG_AWS_PROFILE       = `aws-profile`
+	FLAG_REGION            = `region`
+	FLAG_ROLE_ARN          = `role-arn`
+	FLAG_EXTERNAL_ID       = `external-id`
+	FLAG_ROLE_SESSION_NAME = `role-session-name`
+	FLAG_ROLE_DURATION     = `role-duration`
+	FLAG_MFA_SERIAL        = `mfa-serial`
+	FLAG_MFA_TOKEN         = `mfa-token`
+
+	FLAG_ENDPOINT_URL = `endpoint-url`
+	FLAG_PATH_STYLE   = `path-style`
+
+	FLAG_WAIT          = `wait`
+	FLAG_POLL_INTERVAL = `poll-interval`
+	FLAG_TIMEOUT       = `timeout`
+
+	FLAG_ALL           = `all`
+	FLAG_ACCOUNTS_FILE = `accounts-file`
+	FLAG_CONCURRENCY   = `concurrency`
+	FLAG_RATE          = `rate`
+
+	FLAG_EXACT   = `exact`
+	FLAG_AS_OF   = `as-of`
+	FLAG_NEAREST = `nearest`
 
 	FLAG_ARN  = `arn`
 	FLAG_ARNS = `arns`
 
+	FLAG_RESOURCE_ARN  = `resource-arn`
+	FLAG_PRINCIPAL_ARN = `principal-arn`
+
 	FLAG_NAME  = `name`
 	FLAG_NAMES = `names`
 
@@ -32,4 +92,32 @@ const (
 	FLAG_MAX_READ   = `max-read`
 	FLAG_MAX_WRITE  = `max-write`
 	FLAG_MAX_DELETE = `max-delete`
+
+	FLAG_SINCE        = `since`
+	FLAG_UNTIL        = `until`
+	FLAG_CONFIDENTIAL = `confidential`
+
+	FLAG_CHANGES          = `changes`
+	FLAG_REMOVE_PRINCIPAL = `remove-principal`
+	FLAG_REVOKE           = `revoke`
+	FLAG_DELETE_RESOURCE  = `delete-resource`
+	FLAG_SHOW_REMAINING   = `show-remaining`
+
+	FLAG_HISTORY                  = `history`
+	FLAG_MAX_CREDENTIAL_AGE_DAYS  = `max-credential-age-days`
+	FLAG_MAX_CREDENTIAL_IDLE_DAYS = `max-credential-idle-days`
+)
+
+const (
+	FORMAT_CSV   = `csv`
+	FORMAT_JSON  = `json`
+	FORMAT_JUNIT = `junit`
+	FORMAT_CHART = `chart`
+)
+
+const (
+	PROGRESS_AUTO = `auto`
+	PROGRESS_TTY  = `tty`
+	PROGRESS_JSON = `json`
+	PROGRESS_NONE = `none`
 )
@@ -0,0 +1,66 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cmd contains all cobra commands
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/k9securityio/k9-cli/core"
+	"github.com/k9securityio/k9-cli/views"
+)
+
+// dbCheckCmd represents the db check command
+var dbCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check the local database for incomplete, stray, and damaged reports",
+	Long: `Check the local database for incomplete, stray, and damaged reports.
+
+Reports missing one of the required report kinds, files that are not
+recognizable reports, duplicate copies of the same report, and report files
+that are empty or end with an incomplete record are listed. The command
+exits with a non-zero status if any issue is found.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString(FLAG_FORMAT)
+		stdout := cmd.OutOrStdout()
+		stderr := cmd.ErrOrStderr()
+
+		db, err := core.LoadLocalDB(getReportHome(cmd))
+		if err != nil {
+			fmt.Fprintf(stderr, "Unable to load local database, %v\n", err)
+			os.Exit(1)
+		}
+
+		issues := core.CheckLocalDB(db)
+		if len(issues) <= 0 {
+			fmt.Fprintln(stderr, `No issues found`)
+			return
+		}
+		views.Display(stdout, stderr, format, issues)
+		fmt.Fprintf(stderr, "%v issues found\n", len(issues))
+		os.Exit(1)
+	},
+}
+
+// init defines and wires flags
+func init() {
+	dbCmd.AddCommand(dbCheckCmd)
+	dbCheckCmd.Flags().String(FLAG_FORMAT, FORMAT_CSV, `Output format: [csv|json]`)
+}
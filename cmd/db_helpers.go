@@ -3,8 +3,12 @@ package cmd
 import (
 	"fmt"
 	"io"
+	"os"
+
+	"github.com/spf13/cobra"
 
 	"github.com/k9securityio/k9-cli/core"
+	"github.com/k9securityio/k9-cli/views"
 )
 
 func DumpDBStats(o io.Writer, db *core.DB) {
@@ -12,3 +16,84 @@ func DumpDBStats(o io.Writer, db *core.DB) {
 	fmt.Fprintf(o, "Local database:\n\tCustomers:\t\t%v\n\tAccounts:\t\t%v\n\tTotal analysis dates: \t%v\n",
 		customers, accounts, total)
 }
+
+// WarnDBIssues notes any files that were skipped while loading the local
+// database so that stray files do not go unnoticed.
+func WarnDBIssues(o io.Writer, db *core.DB) {
+	if len(db.Issues) > 0 {
+		fmt.Fprintf(o, "Warning: skipped %v files in the local database, run `k9 db check` for details\n",
+			len(db.Issues))
+	}
+}
+
+// addResolutionFlags defines the flags that select how an analysis date is
+// resolved to a report.
+func addResolutionFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().Bool(FLAG_EXACT, false,
+		`Use only a report from the analysis date, this is the default`)
+	cmd.PersistentFlags().Bool(FLAG_AS_OF, false,
+		`Use the most recent report on or before the analysis date`)
+	cmd.PersistentFlags().Bool(FLAG_NEAREST, false,
+		`Use the report closest to the analysis date`)
+}
+
+// getAnalysisDate parses the analysis-date flag along with the resolution
+// mode selected by the as-of, nearest, or exact flags. A nil result selects
+// the latest report.
+func getAnalysisDate(cmd *cobra.Command) *core.AnalysisDate {
+	analysisDate, _ := cmd.Flags().GetString(FLAG_ANALYSIS_DATE)
+	date, err := core.ParseAnalysisDate(analysisDate)
+	if err != nil {
+		fmt.Fprintf(cmd.ErrOrStderr(), "invalid analysis-date: %v\n", analysisDate)
+		os.Exit(1)
+	}
+
+	resolution := ``
+	for flag, mode := range map[string]string{
+		FLAG_EXACT:   core.RESOLUTION_EXACT,
+		FLAG_AS_OF:   core.RESOLUTION_AS_OF,
+		FLAG_NEAREST: core.RESOLUTION_NEAREST,
+	} {
+		if set, _ := cmd.Flags().GetBool(flag); !set {
+			continue
+		}
+		if len(resolution) > 0 {
+			fmt.Fprintf(cmd.ErrOrStderr(), "only one of --%v, --%v, or --%v may be set\n",
+				FLAG_EXACT, FLAG_AS_OF, FLAG_NEAREST)
+			os.Exit(1)
+		}
+		resolution = mode
+	}
+	if date != nil {
+		date.Resolution = resolution
+	}
+	return date
+}
+
+// resolveReportPath returns the path of the report kind selected by the
+// analysis date along with a description of the chosen report. The chosen
+// analysis time is echoed when verbose.
+func resolveReportPath(stderr io.Writer, db *core.DB, customerID, accountID string,
+	date *core.AnalysisDate, kind string, verbose bool) (*string, core.ReportMetadata) {
+
+	_, meta, ok := db.ResolveReport(customerID, accountID, date)
+	if verbose && ok {
+		requested := `latest`
+		if date != nil {
+			requested = date.String()
+		}
+		fmt.Fprintf(stderr, "Resolved analysis date %v (%v) to the analysis at %v\n",
+			requested, meta.Resolution, meta.AnalysisTime)
+	}
+	return db.GetPathForCustomerAccountTimeKind(customerID, accountID, date, kind), meta
+}
+
+// displayOptions returns the view options for the report described by meta,
+// including the metadata in json output when requested.
+func displayOptions(csvNested string, meta core.ReportMetadata, withMetadata bool) views.Options {
+	opts := views.Options{CSVNested: csvNested}
+	if withMetadata {
+		opts.Metadata = meta
+	}
+	return opts
+}
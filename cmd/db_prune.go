@@ -0,0 +1,118 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cmd contains all cobra commands
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/k9securityio/k9-cli/core"
+)
+
+// dbPruneCmd represents the db prune command
+var dbPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove or archive old reports from the local database",
+	Long: `Remove or archive old reports from the local database according to a
+retention policy. For each of the most recent days, weeks, and months that
+have reports, the newest report in that period is kept. The most recent
+report of each account is always kept.
+
+Pruned reports are downloaded again by a later sync unless the sync is
+narrowed with --since or --latest-only.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		reportHome := getReportHome(cmd)
+		customerID, _ := cmd.Flags().GetString(FLAG_CUSTOMER_ID)
+		accountID, _ := cmd.Flags().GetString(FLAG_ACCOUNT)
+		keepDaily, _ := cmd.Flags().GetInt(`keep-daily`)
+		keepWeekly, _ := cmd.Flags().GetInt(`keep-weekly`)
+		keepMonthly, _ := cmd.Flags().GetInt(`keep-monthly`)
+		dryrun, _ := cmd.Flags().GetBool(`dryrun`)
+		archive, _ := cmd.Flags().GetString(`archive`)
+		stdout := cmd.OutOrStdout()
+		stderr := cmd.ErrOrStderr()
+
+		db, err := core.LoadLocalDB(reportHome)
+		if err != nil {
+			fmt.Fprintf(stderr, "Unable to load the local database: %v\n", err)
+			os.Exit(1)
+		}
+
+		accounts := []core.AccountKey{}
+		for _, a := range db.AccountKeys(customerID) {
+			if len(accountID) <= 0 || a.Account == accountID {
+				accounts = append(accounts, a)
+			}
+		}
+
+		summaries, err := core.Prune(db, reportHome, accounts,
+			core.RetentionPolicy{KeepDaily: keepDaily, KeepWeekly: keepWeekly, KeepMonthly: keepMonthly},
+			core.PruneOptions{DryRun: dryrun, Archive: archive})
+		if dryrun {
+			for _, s := range summaries {
+				for _, p := range s.Paths {
+					fmt.Fprintf(stdout, "would prune %v\n", p)
+				}
+			}
+		}
+		if summaries != nil {
+			printPruneSummaries(stdout, summaries)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "%v\n", err)
+			var aggregate *core.AggregateError
+			if errors.As(err, &aggregate) && aggregate.IsPartial() {
+				fmt.Fprintf(stderr, "Prune partially failed, %v errors\n", len(aggregate.Errors()))
+			}
+			os.Exit(1)
+		}
+	},
+}
+
+// init defines and wires flags
+func init() {
+	dbCmd.AddCommand(dbPruneCmd)
+
+	dbPruneCmd.Flags().String(FLAG_CUSTOMER_ID, ``, `only prune reports of the specified K9 customer ID (default: all)`)
+	dbPruneCmd.Flags().String(FLAG_ACCOUNT, ``, `only prune reports of the specified AWS account (default: all)`)
+	dbPruneCmd.Flags().Int(`keep-daily`, 0, `number of most recent days for which to keep the newest report`)
+	dbPruneCmd.Flags().Int(`keep-weekly`, 0, `number of most recent weeks for which to keep the newest report`)
+	dbPruneCmd.Flags().Int(`keep-monthly`, 0, `number of most recent months for which to keep the newest report`)
+	dbPruneCmd.Flags().Bool(`dryrun`, false, `list the reports that would be pruned without removing them`)
+	dbPruneCmd.Flags().String(`archive`, ``, `move pruned reports into a new tar.gz archive at the specified path rather than deleting them`)
+}
+
+// printPruneSummaries writes a table of the per-account prune outcomes
+// followed by the totals.
+func printPruneSummaries(o io.Writer, summaries []core.PruneSummary) {
+	w := tabwriter.NewWriter(o, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CUSTOMER\tACCOUNT\tKEPT\tPRUNED")
+	total := core.PruneSummary{}
+	for _, s := range summaries {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", s.CustomerID, s.Account, s.Kept, s.Pruned)
+		total.Kept += s.Kept
+		total.Pruned += s.Pruned
+	}
+	fmt.Fprintf(w, "TOTAL\t%v\t%v\t%v\n", len(summaries), total.Kept, total.Pruned)
+	w.Flush()
+}
@@ -21,8 +21,6 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/k9securityio/k9-cli/core"
 	"github.com/spf13/cobra"
 )
@@ -32,7 +30,7 @@ var debugEnvCmd = &cobra.Command{
 	Hidden: true,
 	Run: func(cmd *cobra.Command, args []string) {
 		// fmt.Println("debug-env called")
-		cfg, err := config.LoadDefaultConfig(context.TODO())
+		cfg, err := core.LoadAWSConfig(context.TODO(), awsOptions(cmd))
 		if err != nil {
 			fmt.Printf("Error retrieving AWS configuration: %+v\n", err)
 		} else {
@@ -40,10 +38,9 @@ var debugEnvCmd = &cobra.Command{
 			//			fmt.Printf("AWS Credentials: %+v\n", cfg.Credentials)
 		}
 
-		bucket, _ := cmd.Flags().GetString(`bucket`)
+		bucket := stringFlagOrConfig(cmd, FLAG_BUCKET, CONFIG_BUCKET)
 		if len(bucket) > 0 {
-			client := s3.NewFromConfig(cfg)
-			s3db, err := core.LoadS3DB(client, bucket, core.ReportTypeSelector{core.EXT_CSV, core.EXT_XLSX})
+			s3db, err := core.LoadStoreDB(context.TODO(), openReportStore(cmd, cfg, bucket), core.ReportTypeSelector{core.EXT_CSV, core.EXT_XLSX})
 			if err != nil {
 				fmt.Fprintf(cmd.ErrOrStderr(), "Unable to load s3 database, %v\n", err)
 			} else {
@@ -51,7 +48,7 @@ var debugEnvCmd = &cobra.Command{
 				s3db.Dump(cmd.OutOrStdout(), true)
 			}
 		} else {
-			db, err := core.LoadLocalDB(cmd.Flags().Lookup(`report-home`).Value.String())
+			db, err := core.LoadLocalDB(getReportHome(cmd))
 			if err != nil {
 				fmt.Fprintf(cmd.ErrOrStderr(), "Unable to load local database, %v\n", err)
 			} else {
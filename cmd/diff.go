@@ -18,6 +18,7 @@ limitations under the License.
 package cmd
 
 import (
+	"github.com/k9securityio/k9-cli/core"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -34,10 +35,11 @@ func init() {
 	diffCmd.PersistentFlags().String(`format`, `csv`, `Output format: [csv]`)
 	viper.BindPFlag(`diff_format`, diffCmd.PersistentFlags().Lookup(`format`))
 
-	diffCmd.PersistentFlags().String(`analysis-date`, ``, `Use snapshot from the specified date in YYYY-MM-DD (required)`)
+	diffCmd.PersistentFlags().String(`analysis-date`, ``, `Select the snapshot by date expression (required): `+core.DATE_EXPRESSION_HELP)
 	diffCmd.MarkFlagRequired(`analysis-date`)
+	addResolutionFlags(diffCmd)
 	diffCmd.PersistentFlags().String(`customer_id`, ``, `K9 customer ID for analysis (required)`)
-	diffCmd.MarkFlagRequired(`customer_id`)
+	markFlagRequiredOrConfig(diffCmd.PersistentFlags(), FLAG_CUSTOMER_ID, CONFIG_CUSTOMER_ID)
 	diffCmd.PersistentFlags().String(`account`, ``, `AWS account ID for analysis (required)`)
-	diffCmd.MarkFlagRequired(`account`)
+	markFlagRequiredOrConfig(diffCmd.PersistentFlags(), FLAG_ACCOUNT, CONFIG_ACCOUNT)
 }
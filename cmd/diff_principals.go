@@ -21,7 +21,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"time"
 
 	"github.com/k9securityio/k9-cli/core"
 	"github.com/k9securityio/k9-cli/views"
@@ -34,10 +33,10 @@ var diffPrincipalsCmd = &cobra.Command{
 	Short: `Calculate the difference between a principals snapshot and last scan`,
 	Run: func(cmd *cobra.Command, args []string) {
 		verbose, _ := cmd.Flags().GetBool(`verbose`)
-		customerID, _ := cmd.Flags().GetString(`customer_id`)
-		accountID, _ := cmd.Flags().GetString(`account`)
+		customerID := stringFlagOrConfig(cmd, FLAG_CUSTOMER_ID, CONFIG_CUSTOMER_ID)
+		accountID := stringFlagOrConfig(cmd, FLAG_ACCOUNT, CONFIG_ACCOUNT)
 		analysisDate, _ := cmd.Flags().GetString(`analysis-date`)
-		reportHome, _ := cmd.Flags().GetString(`report-home`)
+		reportHome := getReportHome(cmd)
 		stdout := cmd.OutOrStdout()
 		stderr := cmd.ErrOrStderr()
 
@@ -46,11 +45,7 @@ var diffPrincipalsCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		reportDateTime, err := time.Parse(core.FILENAME_TIMESTAMP_ANALYSIS_DATE_LAYOUT, analysisDate)
-		if err != nil {
-			fmt.Fprintf(stderr, "invalid analysis-date: %v\n", analysisDate)
-			os.Exit(1)
-		}
+		reportDateTime := getAnalysisDate(cmd)
 
 		DoDiffPrincipals(stdout, stderr, reportHome, customerID, accountID, reportDateTime, verbose)
 	},
@@ -62,13 +57,14 @@ func init() {
 }
 
 // DoDiffPrincipals
-func DoDiffPrincipals(stdout, stderr io.Writer, reportHome, customerID, accountID string, analysisDate time.Time, verbose bool) {
+func DoDiffPrincipals(stdout, stderr io.Writer, reportHome, customerID, accountID string, analysisDate *core.AnalysisDate, verbose bool) {
 	// load the local report database
 	db, err := core.LoadLocalDB(reportHome)
 	if err != nil {
 		fmt.Fprintf(stderr, "Unable to load local database, %v\n", err)
 		os.Exit(1)
 	}
+	WarnDBIssues(stderr, &db)
 
 	// get the latest analysis
 	var latestReportPath, targetReportPath string
@@ -85,15 +81,15 @@ func DoDiffPrincipals(stdout, stderr io.Writer, reportHome, customerID, accountI
 
 	// get the target analysis
 	// determine the file name for the desired report
-	if qr := db.GetPathForCustomerAccountTimeKind(
-		customerID, accountID, &analysisDate,
-		core.REPORT_TYPE_PREFIX_PRINCIPALS); qr != nil {
+	if qr, _ := resolveReportPath(stderr, &db,
+		customerID, accountID, analysisDate,
+		core.REPORT_TYPE_PREFIX_PRINCIPALS, verbose); qr != nil {
 		targetReportPath = *qr
 	} else {
 		fmt.Fprintf(stderr,
 			"No such target report: %v, %v, %v, total records: %v\n",
 			customerID, accountID,
-			analysisDate.Format(core.FILENAME_TIMESTAMP_ANALYSIS_DATE_LAYOUT),
+			analysisDate,
 			db.Size())
 		os.Exit(1)
 	}
@@ -154,5 +150,8 @@ func DoDiffPrincipals(stdout, stderr io.Writer, reportHome, customerID, accountI
 			diffs = append(diffs, ri.DeletedDiff())
 		}
 	}
-	views.WriteCSVTo(stdout, stderr, diffs)
+	if err = views.WriteCSVTo(stdout, diffs); err != nil {
+		fmt.Fprintf(stderr, "Unable to write the difference report: %v\n", err)
+		os.Exit(1)
+	}
 }
@@ -18,35 +18,50 @@ limitations under the License.
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"os"
 
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 
 	"github.com/k9securityio/k9-cli/core"
 )
 
-// TODO take in path to list with, select date to pull for, perform the list
-
 // listCmd represents the list command
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List customers, accounts, or reports in a local or remote repository.",
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.LoadDefaultConfig(context.TODO())
-		if err != nil {
-			fmt.Fprintf(cmd.ErrOrStderr(), "Error retrieving AWS configuration: %v+\n", err)
+		local, _ := cmd.Flags().GetBool(`local`)
+		bucket := stringFlagOrConfig(cmd, FLAG_BUCKET, CONFIG_BUCKET)
+		// customer_id and account narrow the listing, so only the flags count
+		// and a configured default doesn't hide the other customers and accounts
+		customerID, _ := cmd.Flags().GetString(FLAG_CUSTOMER_ID)
+		accountID, _ := cmd.Flags().GetString(FLAG_ACCOUNT)
+
+		if local {
+			db, err := core.LoadLocalDB(getReportHome(cmd))
+			if err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Unable to load local database, %v\n", err)
+				os.Exit(1)
+			}
+			WarnDBIssues(cmd.ErrOrStderr(), &db)
+			if err = core.ListLocal(cmd.OutOrStdout(), db, customerID, accountID); err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Error listing the local database: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+		if len(bucket) <= 0 {
+			fmt.Fprintln(cmd.ErrOrStderr(), `a bucket is required unless --local is set`)
 			os.Exit(1)
 		}
-		err = core.List(
+
+		cfg := loadAWSConfig(cmd)
+		err := core.List(
 			os.Stdout,
-			cfg,
-			cmd.Flags().Lookup(`bucket`).Value.String(),
-			cmd.Flags().Lookup(`customer_id`).Value.String(),
-			cmd.Flags().Lookup(`account`).Value.String())
+			openReportStore(cmd, cfg, bucket),
+			customerID,
+			accountID)
 		if err != nil {
 			fmt.Fprintf(cmd.ErrOrStderr(), "Error retrieving the qualified list of reports: %v+\n", err)
 			os.Exit(1)
@@ -58,19 +73,12 @@ var listCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(listCmd)
 
-	listCmd.Flags().StringP(`local`, `l`, ``, `list local resources`)
-
-	listCmd.Flags().String(`path`, `.`, `local path where reports will be stored`)
-	viper.BindPFlag(`local-path`, listCmd.Flags().Lookup(`path`))
+	listCmd.Flags().BoolP(`local`, `l`, false, `list the customers, accounts, or analysis times in the local database`)
 
-	listCmd.Flags().String(`bucket`, ``, `S3 bucket localtion of your K9 secure-inbox (required)`)
-	listCmd.MarkFlagRequired(`bucket`)
-	viper.BindPFlag(`bucket`, listCmd.Flags().Lookup(`bucket`))
+	listCmd.Flags().String(`bucket`, ``, `location of your K9 secure inbox, an S3 bucket name, s3://bucket, or a file:// mirror (required unless --local)`)
 
 	listCmd.Flags().String(`account`, ``, `AWS account for which reports will be downloaded`)
-	viper.BindPFlag(`account`, listCmd.Flags().Lookup(`account`))
 
 	listCmd.Flags().String(`customer_id`, ``, `K9 customer ID reports to download`)
-	viper.BindPFlag(`customer_id`, listCmd.Flags().Lookup(`customer_id`))
 
 }
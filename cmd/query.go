@@ -18,8 +18,8 @@ limitations under the License.
 package cmd
 
 import (
+	"github.com/k9securityio/k9-cli/core"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // queryCmd represents the query command
@@ -31,13 +31,16 @@ var queryCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(queryCmd)
 
-	queryCmd.PersistentFlags().String(FLAG_ANALYSIS_DATE, ``, `Use snapshot from the specified date in YYYY-MM-DD (required)`)
+	queryCmd.PersistentFlags().String(FLAG_ANALYSIS_DATE, ``, `Select the snapshot by date expression (required): `+core.DATE_EXPRESSION_HELP)
+
+	addResolutionFlags(queryCmd)
+	queryCmd.PersistentFlags().Bool(FLAG_WITH_METADATA, false,
+		`Wrap json output in an object that records the analysis time of the report used`)
 
 	queryCmd.PersistentFlags().String(FLAG_FORMAT, `json`, `Output format [csv|json] (default: json)`)
-	viper.BindPFlag(`query_format`, queryResourceCmd.Flags().Lookup(FLAG_FORMAT))
 
 	queryCmd.PersistentFlags().String(FLAG_CUSTOMER_ID, ``, `K9 customer ID for analysis (required)`)
-	queryCmd.MarkPersistentFlagRequired(FLAG_CUSTOMER_ID)
+	markFlagRequiredOrConfig(queryCmd.PersistentFlags(), FLAG_CUSTOMER_ID, CONFIG_CUSTOMER_ID)
 	queryCmd.PersistentFlags().String(FLAG_ACCOUNT, ``, `AWS account ID for analysis (required)`)
-	queryCmd.MarkPersistentFlagRequired(FLAG_ACCOUNT)
+	markFlagRequiredOrConfig(queryCmd.PersistentFlags(), FLAG_ACCOUNT, CONFIG_ACCOUNT)
 }
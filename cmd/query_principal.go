@@ -21,7 +21,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"time"
 
 	"github.com/k9securityio/k9-cli/core"
 	"github.com/k9securityio/k9-cli/views"
@@ -35,26 +34,18 @@ var queryPrincipalCmd = &cobra.Command{
 	Short:   "Lookup one or more principals",
 	Run: func(cmd *cobra.Command, args []string) {
 		verbose, _ := cmd.Flags().GetBool(FLAG_VERBOSE)
-		format, _ := cmd.Flags().GetString(FLAG_FORMAT)
-		customerID, _ := cmd.Flags().GetString(FLAG_CUSTOMER_ID)
-		accountID, _ := cmd.Flags().GetString(FLAG_ACCOUNT)
-		analysisDate, _ := cmd.Flags().GetString(FLAG_ANALYSIS_DATE)
-		reportHome, _ := cmd.Flags().GetString(FLAG_REPORT_HOME)
+		withMetadata, _ := cmd.Flags().GetBool(FLAG_WITH_METADATA)
+		format := stringFlagOrConfig(cmd, FLAG_FORMAT, CONFIG_QUERY_FORMAT)
+		customerID := stringFlagOrConfig(cmd, FLAG_CUSTOMER_ID, CONFIG_CUSTOMER_ID)
+		accountID := stringFlagOrConfig(cmd, FLAG_ACCOUNT, CONFIG_ACCOUNT)
+		reportHome := getReportHome(cmd)
 		stdout := cmd.OutOrStdout()
 		stderr := cmd.ErrOrStderr()
 		arns, _ := cmd.Flags().GetStringSlice(FLAG_ARNS)
 		names, _ := cmd.Flags().GetStringSlice(FLAG_NAMES)
 		principalsFilter := map[string]bool{}
 
-		var reportDateTime *time.Time
-		if len(analysisDate) > 0 {
-			td, err := time.Parse(core.FILENAME_TIMESTAMP_ANALYSIS_DATE_LAYOUT, analysisDate)
-			if err != nil {
-				fmt.Fprintf(stderr, "invalid analysis-date: %v\n", analysisDate)
-				os.Exit(1)
-			}
-			reportDateTime = &td
-		}
+		reportDateTime := getAnalysisDate(cmd)
 
 		for _, p := range arns {
 			principalsFilter[p] = true
@@ -66,7 +57,7 @@ var queryPrincipalCmd = &cobra.Command{
 		DoQueryPrincipal(stdout, stderr,
 			reportHome, customerID, accountID, format,
 			reportDateTime,
-			verbose,
+			verbose, withMetadata,
 			principalsFilter)
 
 	},
@@ -82,8 +73,8 @@ func init() {
 // DoQueryPrincipal is the high-level query and filtering logic for querying principal reports. Externalized for testability.
 func DoQueryPrincipal(stdout, stderr io.Writer,
 	reportHome, customerID, accountID, format string,
-	analysisDate *time.Time,
-	verbose bool,
+	analysisDate *core.AnalysisDate,
+	verbose, withMetadata bool,
 	principals map[string]bool) {
 
 	// load the local report database
@@ -92,13 +83,14 @@ func DoQueryPrincipal(stdout, stderr io.Writer,
 		fmt.Fprintf(stderr, "Unable to load local database, %v\n", err)
 		os.Exit(1)
 	}
+	WarnDBIssues(stderr, &db)
 
 	if verbose {
 		defer DumpDBStats(stderr, &db)
 	}
 
 	// determine the file name for the desired report
-	path := db.GetPathForCustomerAccountTimeKind(customerID, accountID, analysisDate, core.REPORT_TYPE_PREFIX_PRINCIPALS)
+	path, meta := resolveReportPath(stderr, &db, customerID, accountID, analysisDate, core.REPORT_TYPE_PREFIX_PRINCIPALS, verbose)
 	if path == nil || len(*path) <= 0 {
 		fmt.Fprintf(stderr, "No report found for customer: %v account: %v date: %v\n", customerID, accountID, analysisDate)
 		os.Exit(1)
@@ -122,7 +114,7 @@ func DoQueryPrincipal(stdout, stderr io.Writer,
 	}
 
 	if len(principals) <= 0 {
-		views.Display(stdout, stderr, format, report.Items)
+		views.DisplayWithOptions(stdout, stderr, format, report.Items, displayOptions(views.CSV_NESTED_FLATTEN, meta, withMetadata))
 		return
 	}
 
@@ -137,5 +129,5 @@ func DoQueryPrincipal(stdout, stderr io.Writer,
 			continue
 		}
 	}
-	views.Display(stdout, stderr, format, results)
+	views.DisplayWithOptions(stdout, stderr, format, results, displayOptions(views.CSV_NESTED_FLATTEN, meta, withMetadata))
 }
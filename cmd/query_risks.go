@@ -20,8 +20,9 @@ package cmd
 import (
 	"fmt"
 
+	"github.com/k9securityio/k9-cli/core"
+	"github.com/k9securityio/k9-cli/views"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // queryRisksCmd represents the risks command
@@ -36,14 +37,36 @@ var queryRisksCmd = &cobra.Command{
 func init() {
 	queryCmd.AddCommand(queryRisksCmd)
 
-	queryRisksCmd.PersistentFlags().String(`format`, `json`, `Output format as one of: [ json | csv | tap | pdf ]`)
-	viper.BindPFlag(`query_format`, queryRisksCmd.Flags().Lookup(`format`))
+	queryRisksCmd.PersistentFlags().String(`format`, `json`, `Output format as one of: [ json | csv | junit | tap | pdf ]`)
+	queryRisksCmd.PersistentFlags().String(FLAG_CSV_NESTED, views.CSV_NESTED_FLATTEN,
+		`Encoding of nested access summaries in csv output: [ flatten | count ]`)
 	queryRisksCmd.PersistentFlags().String(`analysis-date`, ``,
-		`Use snapshot from the specified date in YYYY-MM-DD (required)`)
+		`Select the snapshot by date expression (required): `+core.DATE_EXPRESSION_HELP)
 	queryRisksCmd.MarkFlagRequired(`analysis-date`)
 
 	queryRisksCmd.PersistentFlags().String(`customer_id`, ``, `K9 customer ID for analysis (required)`)
-	queryRisksCmd.MarkFlagRequired(`customer_id`)
+	markFlagRequiredOrConfig(queryRisksCmd.PersistentFlags(), FLAG_CUSTOMER_ID, CONFIG_CUSTOMER_ID)
 	queryRisksCmd.PersistentFlags().String(`account`, ``, `AWS account ID for analysis (required)`)
-	queryRisksCmd.MarkFlagRequired(`account`)
+	markFlagRequiredOrConfig(queryRisksCmd.PersistentFlags(), FLAG_ACCOUNT, CONFIG_ACCOUNT)
+}
+
+// riskCapabilities are the capabilities limited by the access risk policies.
+var riskCapabilities = []string{
+	core.ACCESS_CAPABILITY_RESOURCE_ADMIN,
+	core.ACCESS_CAPABILITY_READ_DATA,
+	core.ACCESS_CAPABILITY_WRITE_DATA,
+	core.ACCESS_CAPABILITY_DELETE_DATA,
+}
+
+// capabilityViolations compares per-capability access counts against the
+// provided caps and describes each violation, e.g. "read-data: 7 > 5". The
+// output is ordered by capability so that reports are stable between runs.
+func capabilityViolations(counts, caps map[string]int) []string {
+	out := []string{}
+	for _, c := range riskCapabilities {
+		if counts[c] > caps[c] {
+			out = append(out, fmt.Sprintf("%s: %d > %d", c, counts[c], caps[c]))
+		}
+	}
+	return out
 }
@@ -21,7 +21,7 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"time"
+	"sort"
 
 	"github.com/k9securityio/k9-cli/core"
 	"github.com/k9securityio/k9-cli/views"
@@ -35,11 +35,12 @@ var queryRisksOverAccessibleResourcesCmd = &cobra.Command{
 	Short:   "Show over accessible resource risks",
 	Run: func(cmd *cobra.Command, args []string) {
 		verbose, _ := cmd.Flags().GetBool(FLAG_VERBOSE)
-		format, _ := cmd.Flags().GetString(FLAG_FORMAT)
-		customerID, _ := cmd.Flags().GetString(FLAG_CUSTOMER_ID)
-		accountID, _ := cmd.Flags().GetString(FLAG_ACCOUNT)
-		analysisDate, _ := cmd.Flags().GetString(FLAG_ANALYSIS_DATE)
-		reportHome, _ := cmd.Flags().GetString(FLAG_REPORT_HOME)
+		withMetadata, _ := cmd.Flags().GetBool(FLAG_WITH_METADATA)
+		format := stringFlagOrConfig(cmd, FLAG_FORMAT, CONFIG_QUERY_FORMAT)
+		customerID := stringFlagOrConfig(cmd, FLAG_CUSTOMER_ID, CONFIG_CUSTOMER_ID)
+		accountID := stringFlagOrConfig(cmd, FLAG_ACCOUNT, CONFIG_ACCOUNT)
+		reportHome := getReportHome(cmd)
+		csvNested, _ := cmd.Flags().GetString(FLAG_CSV_NESTED)
 		stdout := cmd.OutOrStdout()
 		stderr := cmd.ErrOrStderr()
 		services, _ := cmd.Flags().GetStringSlice(FLAG_SERVICE)
@@ -56,15 +57,7 @@ var queryRisksOverAccessibleResourcesCmd = &cobra.Command{
 			DeleteCap: maxDelete,
 		}
 
-		var reportDateTime *time.Time
-		if len(analysisDate) > 0 {
-			td, err := time.Parse(core.FILENAME_TIMESTAMP_ANALYSIS_DATE_LAYOUT, analysisDate)
-			if err != nil {
-				fmt.Fprintf(stderr, "invalid analysis-date: %v\n", analysisDate)
-				os.Exit(1)
-			}
-			reportDateTime = &td
-		}
+		reportDateTime := getAnalysisDate(cmd)
 
 		serviceMap := map[string]bool{}
 		for _, s := range services {
@@ -72,9 +65,9 @@ var queryRisksOverAccessibleResourcesCmd = &cobra.Command{
 		}
 
 		DoQueryOverAccessibleResources(stdout, stderr,
-			reportHome, customerID, accountID, format,
+			reportHome, customerID, accountID, format, csvNested,
 			reportDateTime,
-			verbose,
+			verbose, withMetadata,
 			serviceMap,
 			policy)
 	},
@@ -93,9 +86,9 @@ func init() {
 }
 
 func DoQueryOverAccessibleResources(stdout, stderr io.Writer,
-	reportHome, customerID, accountID, format string,
-	analysisDate *time.Time,
-	verbose bool,
+	reportHome, customerID, accountID, format, csvNested string,
+	analysisDate *core.AnalysisDate,
+	verbose, withMetadata bool,
 	services map[string]bool,
 	policy AccessibilityPolicy) {
 
@@ -105,13 +98,14 @@ func DoQueryOverAccessibleResources(stdout, stderr io.Writer,
 		fmt.Fprintf(stderr, "Unable to load local database, %v\n", err)
 		os.Exit(1)
 	}
+	WarnDBIssues(stderr, &db)
 
 	if verbose {
 		defer DumpDBStats(stderr, &db)
 	}
 
 	// determine the file name fo rthe desired report
-	path := db.GetPathForCustomerAccountTimeKind(customerID, accountID, analysisDate, core.REPORT_TYPE_PREFIX_RESOURCE_ACCESS_SUMMARIES)
+	path, meta := resolveReportPath(stderr, &db, customerID, accountID, analysisDate, core.REPORT_TYPE_PREFIX_RESOURCE_ACCESS_SUMMARIES, verbose)
 	if path == nil || len(*path) <= 0 {
 		fmt.Fprintf(stderr, "No report found for customer: %v account: %v date: %v\n", customerID, accountID, analysisDate)
 		os.Exit(1)
@@ -134,15 +128,20 @@ func DoQueryOverAccessibleResources(stdout, stderr io.Writer,
 		fmt.Fprintf(stderr, "Target Analysis: %v, records: %v\n", analysisDate, len(report.Items))
 	}
 
-	violations := []ResourceAccessSummary{}
 	summaries := BuildResourceAccessSummaries(stderr, report.Items, services, verbose)
+	if format == FORMAT_JUNIT {
+		views.Display(stdout, stderr, format, policy.Suite(summaries))
+		return
+	}
+
+	violations := []ResourceAccessSummary{}
 	for _, summary := range summaries {
 		if !policy.IsCompliant(summary) {
 			violations = append(violations, summary)
 		}
 	}
 
-	views.Display(stdout, stderr, format, violations)
+	views.DisplayWithOptions(stdout, stderr, format, violations, displayOptions(csvNested, meta, withMetadata))
 }
 
 type AccessibilityPolicy struct {
@@ -152,26 +151,38 @@ type AccessibilityPolicy struct {
 	DeleteCap int
 }
 
-func (p AccessibilityPolicy) IsCompliant(s ResourceAccessSummary) bool {
-	if len(s.PrincipalsByCapability[core.ACCESS_CAPABILITY_RESOURCE_ADMIN]) > p.AdminCap {
-		return false
-	}
-	if len(s.PrincipalsByCapability[core.ACCESS_CAPABILITY_READ_DATA]) > p.ReadCap {
-		return false
+func (p AccessibilityPolicy) caps() map[string]int {
+	return map[string]int{
+		core.ACCESS_CAPABILITY_RESOURCE_ADMIN: p.AdminCap,
+		core.ACCESS_CAPABILITY_READ_DATA:      p.ReadCap,
+		core.ACCESS_CAPABILITY_WRITE_DATA:     p.WriteCap,
+		core.ACCESS_CAPABILITY_DELETE_DATA:    p.DeleteCap,
 	}
-	if len(s.PrincipalsByCapability[core.ACCESS_CAPABILITY_WRITE_DATA]) > p.WriteCap {
-		return false
-	}
-	if len(s.PrincipalsByCapability[core.ACCESS_CAPABILITY_DELETE_DATA]) > p.DeleteCap {
-		return false
+}
+
+func (p AccessibilityPolicy) IsCompliant(s ResourceAccessSummary) bool {
+	return len(p.Violations(s)) == 0
+}
+
+// Suite evaluates each summary against the policy as a JUnit test case.
+func (p AccessibilityPolicy) Suite(summaries []ResourceAccessSummary) views.JUnitTestSuite {
+	suite := views.NewJUnitTestSuite(`over-accessible-resources`)
+	for _, summary := range summaries {
+		suite.Check(summary.ServiceName, summary.ResourceARN, p.Violations(summary))
 	}
-	return true
+	return suite
+}
+
+// Violations describes each capability for which the number of principals
+// with access to the resource exceeds the policy cap.
+func (p AccessibilityPolicy) Violations(s ResourceAccessSummary) []string {
+	return capabilityViolations(s.capabilityCounts(), p.caps())
 }
 
 type Principal struct {
-	ARN  string `json:"principal_arn"`
-	Name string `json:"principal_name"`
-	Type string `json:"principal_type"`
+	ARN  string `csv:"principal_arn" json:"principal_arn"`
+	Name string `csv:"principal_name" json:"principal_name"`
+	Type string `csv:"principal_type" json:"principal_type"`
 }
 
 type ResourceAccessSummary struct {
@@ -179,7 +190,17 @@ type ResourceAccessSummary struct {
 	ResourceName string `csv:"resource_name" json:"resource_name"`
 	ResourceARN  string `csv:"resource_arn" json:"resource_arn"`
 
-	PrincipalsByCapability map[string][]Principal `csv:"principals_by_capability" json:"principals_by_capability"`
+	PrincipalsByCapability map[string][]Principal `csv:"principals_by_capability" csvkey:"access_capability" json:"principals_by_capability"`
+}
+
+// capabilityCounts returns the number of principals that can access the
+// resource with each capability.
+func (s ResourceAccessSummary) capabilityCounts() map[string]int {
+	out := map[string]int{}
+	for c, principals := range s.PrincipalsByCapability {
+		out[c] = len(principals)
+	}
+	return out
 }
 
 func BuildResourceAccessSummaries(stderr io.Writer,
@@ -224,5 +245,7 @@ func BuildResourceAccessSummaries(stderr io.Writer,
 	for _, v := range indexedSummaries {
 		summaries = append(summaries, v)
 	}
+	// order by ARN so that the output is stable from run to run
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].ResourceARN < summaries[j].ResourceARN })
 	return summaries
 }
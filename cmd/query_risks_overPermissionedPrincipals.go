@@ -21,7 +21,7 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"time"
+	"sort"
 
 	"github.com/k9securityio/k9-cli/core"
 	"github.com/k9securityio/k9-cli/views"
@@ -34,11 +34,12 @@ var queryRisksOverPermissionedPrincipalsCmd = &cobra.Command{
 	Short: "Show over-permissioned principal risks",
 	Run: func(cmd *cobra.Command, args []string) {
 		verbose, _ := cmd.Flags().GetBool(FLAG_VERBOSE)
-		format, _ := cmd.Flags().GetString(FLAG_FORMAT)
-		customerID, _ := cmd.Flags().GetString(FLAG_CUSTOMER_ID)
-		accountID, _ := cmd.Flags().GetString(FLAG_ACCOUNT)
-		analysisDate, _ := cmd.Flags().GetString(FLAG_ANALYSIS_DATE)
-		reportHome, _ := cmd.Flags().GetString(FLAG_REPORT_HOME)
+		withMetadata, _ := cmd.Flags().GetBool(FLAG_WITH_METADATA)
+		format := stringFlagOrConfig(cmd, FLAG_FORMAT, CONFIG_QUERY_FORMAT)
+		customerID := stringFlagOrConfig(cmd, FLAG_CUSTOMER_ID, CONFIG_CUSTOMER_ID)
+		accountID := stringFlagOrConfig(cmd, FLAG_ACCOUNT, CONFIG_ACCOUNT)
+		reportHome := getReportHome(cmd)
+		csvNested, _ := cmd.Flags().GetString(FLAG_CSV_NESTED)
 		stdout := cmd.OutOrStdout()
 		stderr := cmd.ErrOrStderr()
 		services, _ := cmd.Flags().GetStringSlice(FLAG_SERVICE)
@@ -55,15 +56,7 @@ var queryRisksOverPermissionedPrincipalsCmd = &cobra.Command{
 			DeleteCap: maxDelete,
 		}
 
-		var reportDateTime *time.Time
-		if len(analysisDate) > 0 {
-			td, err := time.Parse(core.FILENAME_TIMESTAMP_ANALYSIS_DATE_LAYOUT, analysisDate)
-			if err != nil {
-				fmt.Fprintf(stderr, "invalid analysis-date: %v\n", analysisDate)
-				os.Exit(1)
-			}
-			reportDateTime = &td
-		}
+		reportDateTime := getAnalysisDate(cmd)
 
 		serviceMap := map[string]bool{}
 		for _, s := range services {
@@ -71,9 +64,9 @@ var queryRisksOverPermissionedPrincipalsCmd = &cobra.Command{
 		}
 
 		DoQueryOverPermissionedPrincipals(stdout, stderr,
-			reportHome, customerID, accountID, format,
+			reportHome, customerID, accountID, format, csvNested,
 			reportDateTime,
-			verbose,
+			verbose, withMetadata,
 			serviceMap,
 			policy)
 
@@ -94,9 +87,9 @@ func init() {
 }
 
 func DoQueryOverPermissionedPrincipals(stdout, stderr io.Writer,
-	reportHome, customerID, accountID, format string,
-	analysisDate *time.Time,
-	verbose bool,
+	reportHome, customerID, accountID, format, csvNested string,
+	analysisDate *core.AnalysisDate,
+	verbose, withMetadata bool,
 	services map[string]bool,
 	policy CapabilityLimitPolicy) {
 
@@ -106,13 +99,14 @@ func DoQueryOverPermissionedPrincipals(stdout, stderr io.Writer,
 		fmt.Fprintf(stderr, "Unable to load local database, %v\n", err)
 		os.Exit(1)
 	}
+	WarnDBIssues(stderr, &db)
 
 	if verbose {
 		defer DumpDBStats(stderr, &db)
 	}
 
 	// determine the file name fo rthe desired report
-	path := db.GetPathForCustomerAccountTimeKind(customerID, accountID, analysisDate, core.REPORT_TYPE_PREFIX_PRINCIPAL_ACCESS_SUMMARIES)
+	path, meta := resolveReportPath(stderr, &db, customerID, accountID, analysisDate, core.REPORT_TYPE_PREFIX_PRINCIPAL_ACCESS_SUMMARIES, verbose)
 	if path == nil || len(*path) <= 0 {
 		fmt.Fprintf(stderr, "No report found for customer: %v account: %v date: %v\n", customerID, accountID, analysisDate)
 		os.Exit(1)
@@ -135,15 +129,20 @@ func DoQueryOverPermissionedPrincipals(stdout, stderr io.Writer,
 		fmt.Fprintf(stderr, "Target Analysis: %v, records: %v\n", analysisDate, len(report.Items))
 	}
 
-	violations := []PrincipalAccessSummary{}
 	summaries := BuildPrincipalAccessSummaries(stderr, report.Items, services, verbose)
+	if format == FORMAT_JUNIT {
+		views.Display(stdout, stderr, format, policy.Suite(summaries))
+		return
+	}
+
+	violations := []PrincipalAccessSummary{}
 	for _, summary := range summaries {
 		if !policy.IsCompliant(summary) {
 			violations = append(violations, summary)
 		}
 	}
 
-	views.Display(stdout, stderr, format, violations)
+	views.DisplayWithOptions(stdout, stderr, format, violations, displayOptions(csvNested, meta, withMetadata))
 
 }
 
@@ -154,25 +153,37 @@ type CapabilityLimitPolicy struct {
 	DeleteCap int
 }
 
-func (p CapabilityLimitPolicy) IsCompliant(s PrincipalAccessSummary) bool {
-	if len(s.ResourceAccessByCapability[core.ACCESS_CAPABILITY_RESOURCE_ADMIN]) > p.AdminCap {
-		return false
-	}
-	if len(s.ResourceAccessByCapability[core.ACCESS_CAPABILITY_READ_DATA]) > p.ReadCap {
-		return false
+func (p CapabilityLimitPolicy) caps() map[string]int {
+	return map[string]int{
+		core.ACCESS_CAPABILITY_RESOURCE_ADMIN: p.AdminCap,
+		core.ACCESS_CAPABILITY_READ_DATA:      p.ReadCap,
+		core.ACCESS_CAPABILITY_WRITE_DATA:     p.WriteCap,
+		core.ACCESS_CAPABILITY_DELETE_DATA:    p.DeleteCap,
 	}
-	if len(s.ResourceAccessByCapability[core.ACCESS_CAPABILITY_WRITE_DATA]) > p.WriteCap {
-		return false
-	}
-	if len(s.ResourceAccessByCapability[core.ACCESS_CAPABILITY_DELETE_DATA]) > p.DeleteCap {
-		return false
+}
+
+func (p CapabilityLimitPolicy) IsCompliant(s PrincipalAccessSummary) bool {
+	return len(p.Violations(s)) == 0
+}
+
+// Suite evaluates each summary against the policy as a JUnit test case.
+func (p CapabilityLimitPolicy) Suite(summaries []PrincipalAccessSummary) views.JUnitTestSuite {
+	suite := views.NewJUnitTestSuite(`over-permissioned-principals`)
+	for _, summary := range summaries {
+		suite.Check(summary.Type, summary.ARN, p.Violations(summary))
 	}
-	return true
+	return suite
+}
+
+// Violations describes each capability for which the summary exceeds the
+// policy cap, e.g. "read-data: 7 > 5".
+func (p CapabilityLimitPolicy) Violations(s PrincipalAccessSummary) []string {
+	return capabilityViolations(s.capabilityCounts(), p.caps())
 }
 
 type Resource struct {
-	ARN         string `json:"resource_arn"`
-	ServiceName string `json:"service_name"`
+	ARN         string `csv:"resource_arn" json:"resource_arn"`
+	ServiceName string `csv:"service_name" json:"service_name"`
 }
 
 type PrincipalAccessSummary struct {
@@ -180,7 +191,17 @@ type PrincipalAccessSummary struct {
 	Name string `csv:"principal_name" json:"principal_name"`
 	Type string `csv:"principal_type" json:"principal_type"`
 
-	ResourceAccessByCapability map[string][]Resource `csv:"resources_by_capability" json:"resources_by_capability"`
+	ResourceAccessByCapability map[string][]Resource `csv:"resources_by_capability" csvkey:"access_capability" json:"resources_by_capability"`
+}
+
+// capabilityCounts returns the number of resources the principal can access
+// with each capability.
+func (s PrincipalAccessSummary) capabilityCounts() map[string]int {
+	out := map[string]int{}
+	for c, resources := range s.ResourceAccessByCapability {
+		out[c] = len(resources)
+	}
+	return out
 }
 
 func BuildPrincipalAccessSummaries(stderr io.Writer, reportItems []core.PrincipalAccessSummaryReportItem, services map[string]bool, verbose bool) []PrincipalAccessSummary {
@@ -221,5 +242,7 @@ func BuildPrincipalAccessSummaries(stderr io.Writer, reportItems []core.Principa
 	for _, v := range indexedSummaries {
 		summaries = append(summaries, v)
 	}
+	// order by ARN so that the output is stable from run to run
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].ARN < summaries[j].ARN })
 	return summaries
 }
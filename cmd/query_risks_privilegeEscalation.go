@@ -21,7 +21,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"time"
 
 	"github.com/k9securityio/k9-cli/core"
 	"github.com/k9securityio/k9-cli/views"
@@ -35,24 +34,17 @@ var queryRisksPrivilegeEscalationCmd = &cobra.Command{
 	Short:   "Show privilege escalation risks",
 	Run: func(cmd *cobra.Command, args []string) {
 		verbose, _ := cmd.Flags().GetBool(FLAG_VERBOSE)
-		format, _ := cmd.Flags().GetString(FLAG_FORMAT)
-		customerID, _ := cmd.Flags().GetString(FLAG_CUSTOMER_ID)
-		accountID, _ := cmd.Flags().GetString(FLAG_ACCOUNT)
-		analysisDate, _ := cmd.Flags().GetString(FLAG_ANALYSIS_DATE)
-		reportHome, _ := cmd.Flags().GetString(FLAG_REPORT_HOME)
+		withMetadata, _ := cmd.Flags().GetBool(FLAG_WITH_METADATA)
+		format := stringFlagOrConfig(cmd, FLAG_FORMAT, CONFIG_QUERY_FORMAT)
+		customerID := stringFlagOrConfig(cmd, FLAG_CUSTOMER_ID, CONFIG_CUSTOMER_ID)
+		accountID := stringFlagOrConfig(cmd, FLAG_ACCOUNT, CONFIG_ACCOUNT)
+		reportHome := getReportHome(cmd)
 		stdout := cmd.OutOrStdout()
 		stderr := cmd.ErrOrStderr()
 
-		var reportDateTime *time.Time
-		if len(analysisDate) > 0 {
-			td, err := time.Parse(core.FILENAME_TIMESTAMP_ANALYSIS_DATE_LAYOUT, analysisDate)
-			if err != nil {
-				fmt.Fprintf(stderr, "invalid analysis-date: %v\n", analysisDate)
-			}
-			reportDateTime = &td
-		}
+		reportDateTime := getAnalysisDate(cmd)
 
-		DoQueryRisksPrivilegeEscalation(stdout, stderr, reportHome, customerID, accountID, format, reportDateTime, verbose)
+		DoQueryRisksPrivilegeEscalation(stdout, stderr, reportHome, customerID, accountID, format, reportDateTime, verbose, withMetadata)
 	},
 }
 
@@ -61,19 +53,20 @@ func init() {
 }
 
 // DoQueryRisksPrivilegeEscalation
-func DoQueryRisksPrivilegeEscalation(stdout, stderr io.Writer, reportHome, customerID, accountID, format string, analysisDate *time.Time, verbose bool) {
+func DoQueryRisksPrivilegeEscalation(stdout, stderr io.Writer, reportHome, customerID, accountID, format string, analysisDate *core.AnalysisDate, verbose, withMetadata bool) {
 	// load the local report database
 	db, err := core.LoadLocalDB(reportHome)
 	if err != nil {
 		fmt.Printf("Unable to load local database, %v\n", err)
 		os.Exit(1)
 	}
+	WarnDBIssues(stderr, &db)
 	if verbose {
 		defer DumpDBStats(stderr, &db)
 	}
 
 	// determine the file name for the desired report
-	path := db.GetPathForCustomerAccountTimeKind(customerID, accountID, analysisDate, core.REPORT_TYPE_PREFIX_PRINCIPALS)
+	path, meta := resolveReportPath(stderr, &db, customerID, accountID, analysisDate, core.REPORT_TYPE_PREFIX_PRINCIPALS, verbose)
 	if path == nil || len(*path) <= 0 {
 		fmt.Fprintf(stderr, "No report found for customer: %v account: %v date: %v\n", customerID, accountID, analysisDate)
 		os.Exit(1)
@@ -93,6 +86,19 @@ func DoQueryRisksPrivilegeEscalation(stdout, stderr io.Writer, reportHome, custo
 		os.Exit(1)
 	}
 
+	if format == FORMAT_JUNIT {
+		suite := views.NewJUnitTestSuite(`privilege-escalation`)
+		for _, r := range records.Items {
+			if r.PrincipalIsIAMAdmin {
+				suite.Fail(r.PrincipalType, r.PrincipalARN, `principal is an IAM admin`)
+			} else {
+				suite.Pass(r.PrincipalType, r.PrincipalARN)
+			}
+		}
+		views.Display(stdout, stderr, format, suite)
+		return
+	}
+
 	// reducer - apply filtering or detective logic
 	output := []core.PrincipalsReportItem{}
 	for _, r := range records.Items {
@@ -100,5 +106,5 @@ func DoQueryRisksPrivilegeEscalation(stdout, stderr io.Writer, reportHome, custo
 			output = append(output, r)
 		}
 	}
-	views.Display(stdout, stderr, format, output)
+	views.DisplayWithOptions(stdout, stderr, format, output, displayOptions(views.CSV_NESTED_FLATTEN, meta, withMetadata))
 }
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/k9securityio/k9-cli/core"
+	"github.com/k9securityio/k9-cli/views"
+)
+
+// junitCaseNames renders the suite and returns the names of its test cases
+// in document order.
+func junitCaseNames(t *testing.T, suite views.JUnitTestSuite) []string {
+	o := &bytes.Buffer{}
+	views.Display(o, io.Discard, FORMAT_JUNIT, suite)
+	doc := views.JUnitTestSuites{}
+	if err := xml.Unmarshal(o.Bytes(), &doc); err != nil {
+		t.Fatalf(`unexpected error parsing junit output: %v`, err)
+	}
+	names := []string{}
+	for _, s := range doc.Suites {
+		for _, c := range s.Cases {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+func TestRiskJUnitOrder(t *testing.T) {
+	arns := []string{`arn:aws:s3:::c`, `arn:aws:s3:::a`, `arn:aws:s3:::e`, `arn:aws:s3:::b`, `arn:aws:s3:::d`}
+	expected := `arn:aws:s3:::a,arn:aws:s3:::b,arn:aws:s3:::c,arn:aws:s3:::d,arn:aws:s3:::e`
+
+	principalItems := []core.PrincipalAccessSummaryReportItem{}
+	resourceItems := []core.ResourceAccessSummaryReportItem{}
+	for i, arn := range arns {
+		principalItems = append(principalItems, core.PrincipalAccessSummaryReportItem{
+			PrincipalARN: arn, PrincipalType: `IAMRole`, ServiceName: `s3`,
+			AccessCapability: core.ACCESS_CAPABILITY_READ_DATA, ResourceARN: fmt.Sprintf(`r%v`, i),
+		})
+		resourceItems = append(resourceItems, core.ResourceAccessSummaryReportItem{
+			ResourceARN: arn, ServiceName: `s3`,
+			AccessCapability: core.ACCESS_CAPABILITY_READ_DATA, PrincipalARN: fmt.Sprintf(`p%v`, i),
+		})
+	}
+	services := map[string]bool{`s3`: true}
+
+	cases := map[string]func() views.JUnitTestSuite{
+		`over-permissioned-principals`: func() views.JUnitTestSuite {
+			return CapabilityLimitPolicy{}.Suite(BuildPrincipalAccessSummaries(io.Discard, principalItems, services, false))
+		},
+		`over-accessible-resources`: func() views.JUnitTestSuite {
+			return AccessibilityPolicy{}.Suite(BuildResourceAccessSummaries(io.Discard, resourceItems, services, false))
+		},
+	}
+	for l, suite := range cases {
+		// map iteration order varies, so repeat to catch an unstable order
+		for i := 0; i < 20; i++ {
+			if o := strings.Join(junitCaseNames(t, suite()), `,`); o != expected {
+				t.Errorf("Case: %v, expected %v, but was %v", l, expected, o)
+				break
+			}
+		}
+	}
+}
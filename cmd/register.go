@@ -18,8 +18,13 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
 
+	"github.com/k9securityio/k9-cli/core"
+	"github.com/k9securityio/k9-cli/core/api"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -28,11 +33,47 @@ import (
 var registerCmd = &cobra.Command{
 	Use:   "register",
 	Short: "Register with k9",
+	Long: `Registers a new customer with the k9 Security API and saves the returned
+customer ID as customer_id in the config file, or in the active profile, so
+later commands need not specify it. The request is authorized by your AWS
+credentials.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("register called for %v at %v\n",
-			cmd.Flag(`customer-name`).Value,
-			cmd.Flag(`technical-contact-email`).Value)
-		// client.Register(cmd.Flag(`customer-name).Value, cmd.Flag(`technical-contact-email`).Value)
+		customerName, _ := cmd.Flags().GetString(`customer-name`)
+		email, _ := cmd.Flags().GetString(`technical-contact-email`)
+		apiHost := stringFlagOrConfig(cmd, FLAG_API, CONFIG_API)
+		stdout := cmd.OutOrStdout()
+		stderr := cmd.ErrOrStderr()
+
+		registration := core.RegistrationRequest{CustomerName: customerName, TechnicalContactEmail: email}
+		if err := registration.Validate(); err != nil {
+			fmt.Fprintf(stderr, "Invalid registration: %v\n", err)
+			os.Exit(1)
+		}
+
+		cfg := loadAWSConfig(cmd)
+
+		client := newAPIClient(cmd, stderr, cfg, apiHost)
+		response, err := core.Register(context.Background(), client, registration)
+		var ce *api.ClientError
+		if errors.As(err, &ce) && api.IsConflict(err) {
+			fmt.Fprintf(stderr, "%v is already registered: %v\n", customerName, ce.Message)
+			os.Exit(1)
+		} else if err != nil {
+			fmt.Fprintf(stderr, "Unable to register %v: %v\n", customerName, err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(stdout, "Registered %v with customer ID: %v\n", customerName, response.CustomerID)
+
+		key := CONFIG_CUSTOMER_ID
+		if name := activeProfile(); len(name) > 0 {
+			key = profileKey(name, CONFIG_CUSTOMER_ID)
+		}
+		path, err := writeConfigValue(key, response.CustomerID)
+		if err != nil {
+			fmt.Fprintf(stderr, "Unable to save the customer ID to the config file: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(stdout, "Saved %v to %v\n", key, path)
 	},
 }
 
@@ -48,4 +89,7 @@ func init() {
 		"A valid email address for the customer's technical contact (required)")
 	registerCmd.MarkFlagRequired(`technical-contact-email`)
 	viper.BindPFlag(`technical_contact_email`, registerCmd.Flags().Lookup(`technical-contact-email`))
+
+	registerCmd.Flags().String(FLAG_API, api.DEFAULT_HOST, `K9 API to use for registration`)
+	addAPIClientFlags(registerCmd)
 }
@@ -0,0 +1,53 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/k9securityio/k9-cli/core"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// addStoreFlags adds the flags that select an S3-compatible service in
+// place of AWS S3 to every command.
+func addStoreFlags(cmd *cobra.Command) {
+	flags := cmd.PersistentFlags()
+	flags.String(FLAG_ENDPOINT_URL, ``, `the URL of an S3-compatible service holding the reports, e.g. a MinIO mirror of the secure inbox`)
+	flags.Bool(FLAG_PATH_STYLE, false, `address the bucket in the URL path, as most S3-compatible services require`)
+}
+
+// openReportStore opens the report store at the location, a bucket name,
+// s3:// URL, or file:// URL, exiting if it is invalid.
+func openReportStore(cmd *cobra.Command, cfg aws.Config, location string) core.ReportStore {
+	pathStyle, _ := cmd.Flags().GetBool(FLAG_PATH_STYLE)
+	if f := cmd.Flags().Lookup(FLAG_PATH_STYLE); f == nil || !f.Changed {
+		pathStyle = pathStyle || viper.GetBool(CONFIG_PATH_STYLE)
+	}
+	store, err := core.OpenReportStore(cfg, location, core.S3Options{
+		EndpointURL: stringFlagOrConfig(cmd, FLAG_ENDPOINT_URL, CONFIG_ENDPOINT_URL),
+		PathStyle:   pathStyle,
+	})
+	if err != nil {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Invalid report store: %v\n", err)
+		os.Exit(1)
+	}
+	return store
+}
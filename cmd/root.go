@@ -18,19 +18,36 @@ limitations under the License.
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/k9securityio/k9-cli/core"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 var cfgFile string
+var profile string
+
+// configKeyAnnotation marks a flag that must be set, either on the command
+// line or by the configuration key named in the annotation.
+const configKeyAnnotation = `k9_config_key`
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "k9-cli",
 	Short: "A command line suite for accessing and inspecting k9 reports for AWS IAM.",
+
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadProfile(true); err != nil {
+			return err
+		}
+		return checkRequiredConfig(cmd)
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -46,9 +63,72 @@ func init() {
 	cobra.OnInitialize(initConfig)
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.k9-cli.yaml)")
+	rootCmd.PersistentFlags().StringVar(&profile, FLAG_PROFILE, ``,
+		`a profile in the config file that supplies defaults such as customer_id, account, and bucket, `+
+			`may also be set with profile in the config file or `+EnvPrefix+`_PROFILE`)
 	rootCmd.PersistentFlags().BoolP(`verbose`, `v`, false, `enable verbose reporting on STDERR`)
-	rootCmd.PersistentFlags().String(`report-home`, `.`, `a directory where a K9 report database has been downloaded`)
-	rootCmd.MarkFlagRequired(`report-home`)
+	rootCmd.PersistentFlags().String(FLAG_REPORT_HOME, core.DEFAULT_REPORT_HOME,
+		`a directory where a K9 report database has been downloaded, `+
+			`may also be set with report_home in the config file or `+EnvPrefix+`_REPORT_HOME`)
+	viper.BindPFlag(CONFIG_REPORT_HOME, rootCmd.PersistentFlags().Lookup(FLAG_REPORT_HOME))
+	addAWSFlags(rootCmd)
+	addStoreFlags(rootCmd)
+}
+
+// getReportHome resolves the configured report home to an absolute path. The
+// report home may be set with the report-home flag, the K9_REPORT_HOME
+// environment variable, or report_home in the config file, in that order of
+// precedence.
+func getReportHome(cmd *cobra.Command) string {
+	reportHome, err := core.ResolveReportHome(viper.GetString(CONFIG_REPORT_HOME))
+	if err != nil {
+		fmt.Fprintf(cmd.ErrOrStderr(), "invalid report-home: %v\n", err)
+		os.Exit(1)
+	}
+	return reportHome
+}
+
+// stringFlagOrConfig returns the value of a flag when it was set on the
+// command line, otherwise the value of the configuration key from the
+// environment, the active profile, or the config file, in that order, and
+// finally the default value of the flag. Flags are read here rather than
+// bound to viper because several commands share each key and viper only
+// sees the last flag bound to a key.
+func stringFlagOrConfig(cmd *cobra.Command, flag, key string) string {
+	f := cmd.Flags().Lookup(flag)
+	if f != nil && f.Changed {
+		return f.Value.String()
+	}
+	if v := viper.GetString(key); len(v) > 0 {
+		return v
+	}
+	if f != nil {
+		return f.Value.String()
+	}
+	return ``
+}
+
+// markFlagRequiredOrConfig requires that the flag is set on the command line
+// or that the configuration key has a value, see stringFlagOrConfig.
+func markFlagRequiredOrConfig(flags *pflag.FlagSet, flag, key string) {
+	flags.SetAnnotation(flag, configKeyAnnotation, []string{key})
+}
+
+// checkRequiredConfig fails when a flag marked with markFlagRequiredOrConfig
+// has no value from the command line or configuration.
+func checkRequiredConfig(cmd *cobra.Command) error {
+	missing := []string{}
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		keys := f.Annotations[configKeyAnnotation]
+		if len(keys) > 0 && len(stringFlagOrConfig(cmd, f.Name, keys[0])) == 0 {
+			missing = append(missing, fmt.Sprintf(`--%v (or %v_%v, or %v in the config file)`,
+				f.Name, EnvPrefix, strings.ToUpper(keys[0]), keys[0]))
+		}
+	})
+	if len(missing) > 0 {
+		return fmt.Errorf(`required flag(s) not set: %v`, strings.Join(missing, `, `))
+	}
+	return nil
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -76,3 +156,78 @@ func initConfig() {
 		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
 }
+
+// loadProfile merges the settings of the active profile over the top level
+// settings of the config file, they still yield to the environment. When
+// required is false a profile missing from the config file is not an error,
+// so that it can be created.
+func loadProfile(required bool) error {
+	name := activeProfile()
+	if len(name) == 0 {
+		return nil
+	}
+	settings := viper.Sub(profileKey(name, ``))
+	if settings == nil {
+		if required {
+			return fmt.Errorf(`no profile %v in the config file`, name)
+		}
+		return nil
+	}
+	fmt.Fprintln(os.Stderr, "Using profile:", name)
+	return viper.MergeConfigMap(settings.AllSettings())
+}
+
+// activeProfile returns the name of the profile selected with the profile
+// flag, the environment, or the config file.
+func activeProfile() string {
+	if len(profile) > 0 {
+		return profile
+	}
+	return viper.GetString(CONFIG_PROFILE)
+}
+
+// profileKey returns the config file key of a setting in the named profile,
+// or of the profile itself when key is empty.
+func profileKey(name, key string) string {
+	if len(key) == 0 {
+		return CONFIG_PROFILES + `.` + name
+	}
+	return CONFIG_PROFILES + `.` + name + `.` + key
+}
+
+// configFilePath returns the config file in use, or the default config file
+// in the home directory when none was found.
+func configFilePath() (string, error) {
+	if used := viper.ConfigFileUsed(); len(used) > 0 {
+		return used, nil
+	}
+	if cfgFile != "" {
+		return cfgFile, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ``, err
+	}
+	return filepath.Join(home, `.k9-cli.yaml`), nil
+}
+
+// writeConfigValue sets a single key in the config file, creating the file
+// if needed, and returns its path. Only the contents of the file are
+// rewritten, flags and environment variables are not persisted.
+func writeConfigValue(key, value string) (string, error) {
+	path, err := configFilePath()
+	if err != nil {
+		return ``, err
+	}
+	file := viper.New()
+	file.SetConfigFile(path)
+	if filepath.Ext(path) == `` {
+		file.SetConfigType(`yaml`)
+	}
+	if err = file.ReadInConfig(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return ``, err
+	}
+	file.Set(key, value)
+	viper.Set(key, value)
+	return path, file.WriteConfigAs(path)
+}
@@ -19,19 +19,330 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"sort"
 
+	"github.com/k9securityio/k9-cli/core"
+	"github.com/k9securityio/k9-cli/views"
 	"github.com/spf13/cobra"
 )
 
+// simulation outcomes
+const (
+	OUTCOME_RESOLVED   = `resolved`
+	OUTCOME_INTRODUCED = `introduced`
+	OUTCOME_REMAINING  = `remaining`
+)
+
+// risk checks evaluated by simulate
+const (
+	CHECK_OVER_PERMISSIONED_PRINCIPALS = `over-permissioned-principals`
+	CHECK_OVER_ACCESSIBLE_RESOURCES    = `over-accessible-resources`
+	CHECK_PRIVILEGE_ESCALATION         = `privilege-escalation`
+
+	// capabilityIAMAdmin labels privilege escalation findings
+	capabilityIAMAdmin = `iam-admin`
+)
+
 // simulateCmd represents the simulate command
 var simulateCmd = &cobra.Command{
 	Use:   "simulate",
-	Short: "Perform a live simulation",
+	Short: "Simulate access changes and show the risk findings they resolve or introduce",
+	Long: `Applies hypothetical access changes to an analysis in the local database,
+re-runs the over-permissioned principals, over-accessible resources, and
+privilege escalation risk checks, and lists the findings that the changes
+would resolve or introduce. Nothing is changed in AWS.
+
+Changes are given with --remove-principal, --revoke, and --delete-resource,
+or as a JSON array in a file named by --changes, for example:
+
+  [{"action": "remove-principal", "principal_arn": "arn:aws:iam::123456789012:user/ci"},
+   {"action": "revoke", "principal_arn": "arn:aws:iam::123456789012:role/app",
+    "capability": "write-data", "service": "S3"},
+   {"action": "delete-resource", "resource_arn": "arn:aws:s3:::old-bucket"}]`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("simulate called")
+		verbose, _ := cmd.Flags().GetBool(FLAG_VERBOSE)
+		format, _ := cmd.Flags().GetString(FLAG_FORMAT)
+		customerID := stringFlagOrConfig(cmd, FLAG_CUSTOMER_ID, CONFIG_CUSTOMER_ID)
+		accountID := stringFlagOrConfig(cmd, FLAG_ACCOUNT, CONFIG_ACCOUNT)
+		changesFile, _ := cmd.Flags().GetString(FLAG_CHANGES)
+		removePrincipals, _ := cmd.Flags().GetStringArray(FLAG_REMOVE_PRINCIPAL)
+		revocations, _ := cmd.Flags().GetStringArray(FLAG_REVOKE)
+		deleteResources, _ := cmd.Flags().GetStringArray(FLAG_DELETE_RESOURCE)
+		showRemaining, _ := cmd.Flags().GetBool(FLAG_SHOW_REMAINING)
+		services, _ := cmd.Flags().GetStringSlice(FLAG_SERVICE)
+		maxAdmins, _ := cmd.Flags().GetInt(FLAG_MAX_ADMIN)
+		maxRead, _ := cmd.Flags().GetInt(FLAG_MAX_READ)
+		maxWrite, _ := cmd.Flags().GetInt(FLAG_MAX_WRITE)
+		maxDelete, _ := cmd.Flags().GetInt(FLAG_MAX_DELETE)
+		reportHome := getReportHome(cmd)
+		stdout := cmd.OutOrStdout()
+		stderr := cmd.ErrOrStderr()
+
+		changes := []core.AccessChange{}
+		if len(changesFile) > 0 {
+			in := io.Reader(os.Stdin)
+			if changesFile != `-` {
+				f, err := os.Open(changesFile)
+				if err != nil {
+					fmt.Fprintf(stderr, "Unable to open changes: %v\n", err)
+					os.Exit(1)
+				}
+				defer f.Close()
+				in = f
+			}
+			parsed, err := core.ParseAccessChanges(in)
+			if err != nil {
+				fmt.Fprintf(stderr, "Invalid changes: %v\n", err)
+				os.Exit(1)
+			}
+			changes = append(changes, parsed...)
+		}
+		for _, p := range removePrincipals {
+			changes = append(changes, core.AccessChange{Action: core.CHANGE_REMOVE_PRINCIPAL, PrincipalARN: p})
+		}
+		for _, r := range revocations {
+			c, err := core.ParseRevocation(r)
+			if err != nil {
+				fmt.Fprintf(stderr, "Invalid revocation: %v\n", err)
+				os.Exit(1)
+			}
+			changes = append(changes, c)
+		}
+		for _, r := range deleteResources {
+			changes = append(changes, core.AccessChange{Action: core.CHANGE_DELETE_RESOURCE, ResourceARN: r})
+		}
+		if len(changes) == 0 {
+			fmt.Fprintln(stderr, `at least one change is required, see --changes, --remove-principal, --revoke, and --delete-resource`)
+			os.Exit(1)
+		}
+
+		checks := RiskChecks{
+			Services:      map[string]bool{},
+			Permissions:   CapabilityLimitPolicy{AdminCap: maxAdmins, ReadCap: maxRead, WriteCap: maxWrite, DeleteCap: maxDelete},
+			Accessibility: AccessibilityPolicy{AdminCap: maxAdmins, ReadCap: maxRead, WriteCap: maxWrite, DeleteCap: maxDelete},
+		}
+		for _, s := range services {
+			checks.Services[s] = true
+		}
+
+		DoSimulate(stdout, stderr,
+			reportHome, customerID, accountID, format,
+			getAnalysisDate(cmd),
+			changes, checks, showRemaining,
+			verbose)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(simulateCmd)
+
+	simulateCmd.Flags().String(FLAG_CUSTOMER_ID, ``, `K9 customer ID for analysis (required)`)
+	markFlagRequiredOrConfig(simulateCmd.Flags(), FLAG_CUSTOMER_ID, CONFIG_CUSTOMER_ID)
+	simulateCmd.Flags().String(FLAG_ACCOUNT, ``, `AWS account ID for analysis (required)`)
+	markFlagRequiredOrConfig(simulateCmd.Flags(), FLAG_ACCOUNT, CONFIG_ACCOUNT)
+	simulateCmd.Flags().String(FLAG_ANALYSIS_DATE, ``, `Select the snapshot by date expression (default: latest): `+core.DATE_EXPRESSION_HELP)
+	addResolutionFlags(simulateCmd)
+	simulateCmd.Flags().String(FLAG_FORMAT, FORMAT_JSON, `Output format [json|csv]`)
+
+	simulateCmd.Flags().String(FLAG_CHANGES, ``, `A file containing a JSON array of changes, or - for stdin`)
+	simulateCmd.Flags().StringArray(FLAG_REMOVE_PRINCIPAL, []string{}, `The ARN of a principal to remove`)
+	simulateCmd.Flags().StringArray(FLAG_REVOKE, []string{}, `A capability to revoke as <capability>:<service>:<principal-arn>, use * for every service`)
+	simulateCmd.Flags().StringArray(FLAG_DELETE_RESOURCE, []string{}, `The ARN of a resource to delete`)
+	simulateCmd.Flags().Bool(FLAG_SHOW_REMAINING, false, `Also list the findings that remain after the changes`)
+
+	simulateCmd.Flags().StringSlice(FLAG_SERVICE, []string{}, `A list of service names to evaluate for access risks (default: all services)`)
+	simulateCmd.Flags().Int(FLAG_MAX_ADMIN, 5, `The maximum number of resources a principal, or principals a resource, may have with ADMIN access.`)
+	simulateCmd.Flags().Int(FLAG_MAX_READ, 5, `The maximum number of resources a principal, or principals a resource, may have with READ access.`)
+	simulateCmd.Flags().Int(FLAG_MAX_WRITE, 5, `The maximum number of resources a principal, or principals a resource, may have with WRITE access.`)
+	simulateCmd.Flags().Int(FLAG_MAX_DELETE, 5, `The maximum number of resources a principal, or principals a resource, may have with DELETE access.`)
+}
+
+// RiskChecks configures the risk checks evaluated by a simulation. An empty
+// Services set evaluates every service.
+type RiskChecks struct {
+	Services      map[string]bool
+	Permissions   CapabilityLimitPolicy
+	Accessibility AccessibilityPolicy
+}
+
+// RiskFinding is a capability of a principal or resource that exceeds its
+// limit. Count is the number of resources or principals with the capability.
+type RiskFinding struct {
+	Check      string `csv:"check" json:"check"`
+	Subject    string `csv:"subject" json:"subject"`
+	Capability string `csv:"capability" json:"capability"`
+	Limit      int    `csv:"limit" json:"limit"`
+	Count      int    `csv:"count" json:"count"`
+}
+
+func (f RiskFinding) key() string {
+	return f.Check + "\x00" + f.Subject + "\x00" + f.Capability
+}
+
+// SimulatedFinding compares a finding before and after the changes. A count
+// of zero means the finding is absent.
+type SimulatedFinding struct {
+	Outcome     string `csv:"outcome" json:"outcome"`
+	Check       string `csv:"check" json:"check"`
+	Subject     string `csv:"subject" json:"subject"`
+	Capability  string `csv:"capability" json:"capability"`
+	Limit       int    `csv:"limit" json:"limit"`
+	CountBefore int    `csv:"count_before" json:"count_before"`
+	CountAfter  int    `csv:"count_after" json:"count_after"`
+}
+
+// DoSimulate applies the changes to the selected analysis and displays the
+// findings they resolve or introduce.
+func DoSimulate(stdout, stderr io.Writer,
+	reportHome, customerID, accountID, format string,
+	analysisDate *core.AnalysisDate,
+	changes []core.AccessChange,
+	checks RiskChecks,
+	showRemaining, verbose bool) {
+
+	db, err := core.LoadLocalDB(reportHome)
+	if err != nil {
+		fmt.Fprintf(stderr, "Unable to load local database, %v\n", err)
+		os.Exit(1)
+	}
+	WarnDBIssues(stderr, &db)
+	if verbose {
+		defer DumpDBStats(stderr, &db)
+	}
+
+	report, meta, ok := db.ResolveReport(customerID, accountID, analysisDate)
+	if !ok {
+		fmt.Fprintf(stderr, "No report found for customer: %v account: %v date: %v\n", customerID, accountID, analysisDate)
+		os.Exit(1)
+	}
+
+	before, err := loadAccessSnapshot(report)
+	if err != nil {
+		fmt.Fprintf(stderr, "Unable to open the requested report: %v\n", err)
+		os.Exit(1)
+	}
+	after := before.Apply(changes)
+	if verbose {
+		fmt.Fprintf(stderr, "Target Analysis: %v\n", meta.AnalysisTime)
+		for _, c := range changes {
+			fmt.Fprintf(stderr, "Simulating %v\n", c)
+		}
+		fmt.Fprintf(stderr, "Removed %v principal and %v resource access grants\n",
+			len(before.PrincipalAccess)-len(after.PrincipalAccess),
+			len(before.ResourceAccess)-len(after.ResourceAccess))
+	}
+
+	results := CompareRiskFindings(checks.Evaluate(before), checks.Evaluate(after), showRemaining)
+	if verbose {
+		counts := map[string]int{}
+		for _, r := range results {
+			counts[r.Outcome]++
+		}
+		fmt.Fprintf(stderr, "Findings resolved: %v, introduced: %v\n", counts[OUTCOME_RESOLVED], counts[OUTCOME_INTRODUCED])
+	}
+	views.Display(stdout, stderr, format, results)
+}
+
+// loadAccessSnapshot loads the reports of an analysis used by the risk
+// checks.
+func loadAccessSnapshot(r core.LocalReport) (core.AccessSnapshot, error) {
+	principals := &core.PrincipalsReport{}
+	if err := loadLocalReport(r, core.REPORT_TYPE_PREFIX_PRINCIPALS, principals); err != nil {
+		return core.AccessSnapshot{}, err
+	}
+	principalAccess := &core.PrincipalAccessSummaryReport{}
+	if err := loadLocalReport(r, core.REPORT_TYPE_PREFIX_PRINCIPAL_ACCESS_SUMMARIES, principalAccess); err != nil {
+		return core.AccessSnapshot{}, err
+	}
+	resourceAccess := &core.ResourceAccessSummaryReport{}
+	if err := loadLocalReport(r, core.REPORT_TYPE_PREFIX_RESOURCE_ACCESS_SUMMARIES, resourceAccess); err != nil {
+		return core.AccessSnapshot{}, err
+	}
+	return core.AccessSnapshot{
+		Principals:      principals.Items,
+		PrincipalAccess: principalAccess.Items,
+		ResourceAccess:  resourceAccess.Items,
+	}, nil
+}
+
+// Evaluate runs every risk check against the snapshot.
+func (c RiskChecks) Evaluate(s core.AccessSnapshot) []RiskFinding {
+	services := c.Services
+	if len(services) == 0 {
+		services = map[string]bool{}
+		for _, i := range s.PrincipalAccess {
+			services[i.ServiceName] = true
+		}
+		for _, i := range s.ResourceAccess {
+			services[i.ServiceName] = true
+		}
+	}
+
+	out := []RiskFinding{}
+	exceeded := func(check, subject string, counts, caps map[string]int) {
+		for _, capability := range riskCapabilities {
+			if counts[capability] > caps[capability] {
+				out = append(out, RiskFinding{check, subject, capability, caps[capability], counts[capability]})
+			}
+		}
+	}
+	for _, summary := range BuildPrincipalAccessSummaries(io.Discard, s.PrincipalAccess, services, false) {
+		exceeded(CHECK_OVER_PERMISSIONED_PRINCIPALS, summary.ARN, summary.capabilityCounts(), c.Permissions.caps())
+	}
+	for _, summary := range BuildResourceAccessSummaries(io.Discard, s.ResourceAccess, services, false) {
+		exceeded(CHECK_OVER_ACCESSIBLE_RESOURCES, summary.ResourceARN, summary.capabilityCounts(), c.Accessibility.caps())
+	}
+	for _, p := range s.Principals {
+		if p.PrincipalIsIAMAdmin {
+			out = append(out, RiskFinding{CHECK_PRIVILEGE_ESCALATION, p.PrincipalARN, capabilityIAMAdmin, 0, 1})
+		}
+	}
+	return out
+}
+
+// CompareRiskFindings pairs the findings before and after a change. Findings
+// only present before are resolved and findings only present after are
+// introduced. Findings present in both are included as remaining when
+// requested. Results are ordered by outcome, check, subject, and capability.
+func CompareRiskFindings(before, after []RiskFinding, showRemaining bool) []SimulatedFinding {
+	afterByKey := map[string]RiskFinding{}
+	for _, f := range after {
+		afterByKey[f.key()] = f
+	}
+
+	out := []SimulatedFinding{}
+	seen := map[string]bool{}
+	for _, b := range before {
+		seen[b.key()] = true
+		r := SimulatedFinding{Outcome: OUTCOME_RESOLVED, Check: b.Check, Subject: b.Subject, Capability: b.Capability, Limit: b.Limit, CountBefore: b.Count}
+		if a, ok := afterByKey[b.key()]; ok {
+			if !showRemaining {
+				continue
+			}
+			r.Outcome = OUTCOME_REMAINING
+			r.CountAfter = a.Count
+		}
+		out = append(out, r)
+	}
+	for _, a := range after {
+		if !seen[a.key()] {
+			out = append(out, SimulatedFinding{Outcome: OUTCOME_INTRODUCED, Check: a.Check, Subject: a.Subject, Capability: a.Capability, Limit: a.Limit, CountAfter: a.Count})
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Outcome != out[j].Outcome {
+			return out[i].Outcome > out[j].Outcome
+		}
+		if out[i].Check != out[j].Check {
+			return out[i].Check < out[j].Check
+		}
+		if out[i].Subject != out[j].Subject {
+			return out[i].Subject < out[j].Subject
+		}
+		return out[i].Capability < out[j].Capability
+	})
+	return out
 }
@@ -19,57 +19,125 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 
 	"github.com/k9securityio/k9-cli/core"
 )
 
-// TODO take in path to sync with, select date to pull for, perform the sync
-
 // syncCmd represents the sync command
 var syncCmd = &cobra.Command{
 	Use:   "sync",
 	Short: "Sync your local database with a report delivered to your AWS account.",
 	Run: func(cmd *cobra.Command, args []string) {
-		bucket, _ := cmd.Flags().GetString(`bucket`)
-		customerID, _ := cmd.Flags().GetString(`customer_id`)
-		accountID, _ := cmd.Flags().GetString(`account`)
-		// reportHome, _ := cmd.Flags().GetString(`report-home`)
+		bucket := stringFlagOrConfig(cmd, FLAG_BUCKET, CONFIG_BUCKET)
+		customerID := stringFlagOrConfig(cmd, FLAG_CUSTOMER_ID, CONFIG_CUSTOMER_ID)
+		accountID := stringFlagOrConfig(cmd, FLAG_ACCOUNT, CONFIG_ACCOUNT)
+		reportHome := getReportHome(cmd)
+		if path, _ := cmd.Flags().GetString(`path`); len(path) > 0 {
+			resolved, err := core.ResolveReportHome(path)
+			if err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "invalid path: %v\n", err)
+				os.Exit(1)
+			}
+			reportHome = resolved
+		}
 		concurrency, _ := cmd.Flags().GetInt(`concurrency`)
+		retries, _ := cmd.Flags().GetInt(`retries`)
 		verbose, _ := cmd.Flags().GetBool(`verbose`)
 		dryrun, _ := cmd.Flags().GetBool(`dryrun`)
 		xlsx, _ := cmd.Flags().GetBool(`include-xlsx`)
+		since, _ := cmd.Flags().GetString(`since`)
+		until, _ := cmd.Flags().GetString(`until`)
+		latestOnly, _ := cmd.Flags().GetBool(`latest-only`)
+		latestCount, _ := cmd.Flags().GetInt(`latest-count`)
+		kinds, _ := cmd.Flags().GetStringSlice(`kinds`)
+		allAccounts, _ := cmd.Flags().GetBool(`all-accounts`)
+		allCustomers, _ := cmd.Flags().GetBool(`all-customers`)
+		progressMode, _ := cmd.Flags().GetString(`progress`)
+		maxBandwidth, _ := cmd.Flags().GetString(`max-bandwidth`)
+		compression, _ := cmd.Flags().GetString(`compress`)
 		stdout := cmd.OutOrStdout()
 		stderr := cmd.ErrOrStderr()
 
-		cfg, err := config.LoadDefaultConfig(context.TODO())
+		if !allCustomers && len(customerID) <= 0 {
+			fmt.Fprintln(stderr, `a customer_id is required unless --all-customers is set`)
+			os.Exit(1)
+		}
+		if !allCustomers && !allAccounts && len(accountID) <= 0 {
+			fmt.Fprintln(stderr, `an account is required unless --all-accounts or --all-customers is set`)
+			os.Exit(1)
+		}
+
+		filter, err := buildReportFilter(since, until, latestOnly, latestCount, kinds)
 		if err != nil {
-			fmt.Fprintf(stderr, "Error retrieving AWS configuration: %v+\n", err)
+			fmt.Fprintln(stderr, err)
 			os.Exit(1)
 		}
 
+		bandwidth, err := core.ParseBandwidth(maxBandwidth)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			os.Exit(1)
+		}
+		progress, err := newProgressReporter(stderr, progressMode, verbose)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			os.Exit(1)
+		}
+
+		cfg := loadAWSConfig(cmd)
+
 		selector := []string{core.EXT_CSV}
 		if xlsx {
 			selector = append(selector, core.EXT_XLSX)
 		}
-		s3db, err := core.LoadS3DB(s3.NewFromConfig(cfg), bucket, core.ReportTypeSelector(selector))
+		store := openReportStore(cmd, cfg, bucket)
+		s3db, err := core.LoadStoreDB(context.TODO(), store, core.ReportTypeSelector(selector))
 		if err != nil {
 			fmt.Fprintf(stderr, "Error loading remote database: %v+\n", err)
 			os.Exit(1)
 		}
 
-		err = core.Sync(stdout, stderr, s3db,
-			manager.NewDownloader(s3.NewFromConfig(cfg)),
-			bucket, customerID, accountID, concurrency, dryrun, verbose)
+		var accounts []core.AccountKey
+		switch {
+		case allCustomers:
+			accounts = s3db.AccountKeys(``)
+		case allAccounts:
+			accounts = s3db.AccountKeys(customerID)
+		default:
+			accounts = []core.AccountKey{{CustomerID: customerID, Account: accountID}}
+		}
+
+		summaries, err := core.SyncAccounts(stdout, stderr, s3db, store,
+			reportHome, accounts,
+			core.SyncOptions{
+				Filter:      filter,
+				Concurrency: concurrency,
+				Retries:     retries,
+				DryRun:      dryrun,
+				Verbose:     verbose,
+
+				MaxBandwidth: bandwidth,
+				Progress:     progress,
+				Compression:  compression,
+			})
+		if allCustomers || allAccounts || err != nil {
+			printSyncSummaries(stdout, summaries)
+		}
 		if err != nil {
-			fmt.Fprintf(stderr, "%v+\n", err)
+			fmt.Fprintf(stderr, "%v\n", err)
+			var aggregate *core.AggregateError
+			if errors.As(err, &aggregate) && aggregate.IsPartial() {
+				fmt.Fprintf(stderr, "Sync partially failed, %v errors\n", len(aggregate.Errors()))
+			}
 			os.Exit(1)
 		}
 	},
@@ -79,23 +147,141 @@ var syncCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(syncCmd)
 
-	syncCmd.Flags().String(`path`, `.`, `Local path where reports will be stored`)
-	viper.BindPFlag(`local-path`, syncCmd.Flags().Lookup(`path`))
+	syncCmd.Flags().String(`path`, ``, `Local path where reports will be stored`)
+	syncCmd.Flags().MarkDeprecated(`path`, `use --report-home instead`)
 
-	syncCmd.Flags().String(`bucket`, ``, `S3 bucket location of your K9 secure inbox`)
-	viper.BindPFlag(`bucket`, syncCmd.Flags().Lookup(`bucket`))
-	syncCmd.MarkFlagRequired(`bucket`)
+	syncCmd.Flags().String(`bucket`, ``, `location of your K9 secure inbox, an S3 bucket name, s3://bucket, or a file:// mirror`)
+	markFlagRequiredOrConfig(syncCmd.Flags(), FLAG_BUCKET, CONFIG_BUCKET)
 
 	syncCmd.Flags().String(`customer_id`, ``, `K9 customer ID reports to download`)
-	viper.BindPFlag(`customer_id`, syncCmd.Flags().Lookup(`customer_id`))
-	syncCmd.MarkFlagRequired(`customer_id`)
 
 	syncCmd.Flags().Int(`concurrency`, 4, `number of concurrent downloads`)
+	syncCmd.Flags().Int(`retries`, 3, `number of times to retry a download after a transient failure`)
 
 	syncCmd.Flags().String(`account`, ``, `AWS account for which reports will be downloaded`)
+	syncCmd.Flags().Bool(`all-accounts`, false, `download reports for every account of the customer`)
+	syncCmd.Flags().Bool(`all-customers`, false, `download reports for every customer and account in the inbox`)
 	syncCmd.Flags().Bool(`dryrun`, false, `don't perform the download`)
 	syncCmd.Flags().Bool(`include-xlsx`, false, `download Excel sheets as well`)
+	syncCmd.Flags().String(`since`, ``, `only download reports from on or after the specified date: `+core.DATE_EXPRESSION_HELP)
+	syncCmd.Flags().String(`until`, ``, `only download reports from on or before the specified date: `+core.DATE_EXPRESSION_HELP)
+	syncCmd.Flags().Bool(`latest-only`, false, `only download the most recent reports`)
+	syncCmd.Flags().Int(`latest-count`, 1, `number of most recent reports to download with --latest-only`)
+	syncCmd.Flags().StringSlice(`kinds`, []string{},
+		`report kinds to download, any of: `+strings.Join(core.ReportKinds, `,`)+` (default: all)`)
 
-	viper.BindPFlag(`account`, syncCmd.Flags().Lookup(`account`))
+	syncCmd.Flags().String(`progress`, PROGRESS_AUTO,
+		`progress display, one of: auto, tty, json, none (auto renders a status line on terminals and nothing otherwise)`)
+	syncCmd.Flags().String(`max-bandwidth`, ``,
+		`limit the combined download rate, for example 500KB, 2MiB, or bytes per second (default: unlimited)`)
+
+	syncCmd.Flags().String(`compress`, core.COMPRESSION_NONE,
+		`store reports compressed, one of: none, gzip, zstd (reports are read transparently either way)`)
+}
+
+// parseSyncDate parses a date expression for since or until and returns the
+// first and last instant it covers. Expressions that select a report rather
+// than a date, like latest, are rejected.
+func parseSyncDate(s string) (time.Time, time.Time, error) {
+	d, err := core.ParseAnalysisDate(s)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if d == nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%q is not a date", s)
+	}
+	if d.Latest {
+		return time.Time{}, time.Time{}, fmt.Errorf("%v does not name a date, use --latest-only", s)
+	}
+	first, last := d.Range()
+	return first, last, nil
+}
+
+// buildReportFilter validates the sync selection flags and converts them to
+// a core.ReportFilter.
+func buildReportFilter(since, until string, latestOnly bool, latestCount int, kinds []string) (core.ReportFilter, error) {
+	filter := core.ReportFilter{}
+	if len(since) > 0 {
+		first, _, err := parseSyncDate(since)
+		if err != nil {
+			return filter, fmt.Errorf("invalid since: %v", err)
+		}
+		filter.Since = &first
+	}
+	if len(until) > 0 {
+		_, last, err := parseSyncDate(until)
+		if err != nil {
+			return filter, fmt.Errorf("invalid until: %v", err)
+		}
+		filter.Until = &last
+	}
+	if filter.Since != nil && filter.Until != nil && filter.Until.Before(*filter.Since) {
+		return filter, fmt.Errorf("until (%v) is before since (%v)", until, since)
+	}
+	if latestOnly {
+		if latestCount < 1 {
+			return filter, fmt.Errorf("invalid latest-count: %v", latestCount)
+		}
+		filter.Latest = latestCount
+	}
+	for _, k := range kinds {
+		known := false
+		for _, rk := range core.ReportKinds {
+			if k == rk {
+				known = true
+			}
+		}
+		if !known {
+			return filter, fmt.Errorf("invalid report kind: %v", k)
+		}
+		filter.Kinds = append(filter.Kinds, k)
+	}
+	return filter, nil
+}
+
+// printSyncSummaries writes a table of the per-account sync outcomes
+// followed by the totals.
+func printSyncSummaries(o io.Writer, summaries []core.SyncSummary) {
+	w := tabwriter.NewWriter(o, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CUSTOMER\tACCOUNT\tDOWNLOADED\tSKIPPED\tFAILED")
+	total := core.SyncSummary{}
+	for _, s := range summaries {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", s.CustomerID, s.Account, s.Downloaded, s.Skipped, s.Failed)
+		total.Downloaded += s.Downloaded
+		total.Skipped += s.Skipped
+		total.Failed += s.Failed
+	}
+	fmt.Fprintf(w, "TOTAL\t%v\t%v\t%v\t%v\n", len(summaries), total.Downloaded, total.Skipped, total.Failed)
+	w.Flush()
+}
+
+// newProgressReporter selects the sync progress display. The reporters
+// write to stderr so that stdout remains reserved for the summary. JSON
+// events are only written on request, so that logs stay quiet by default.
+func newProgressReporter(stderr io.Writer, mode string, verbose bool) (core.ProgressReporter, error) {
+	if mode == PROGRESS_AUTO {
+		mode = PROGRESS_NONE
+		if f, ok := stderr.(*os.File); ok && isTerminal(f) {
+			mode = PROGRESS_TTY
+		}
+	}
+	switch mode {
+	case PROGRESS_TTY:
+		return core.NewTerminalProgressReporter(stderr, verbose), nil
+	case PROGRESS_JSON:
+		return core.NewJSONProgressReporter(stderr), nil
+	case PROGRESS_NONE:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("invalid progress: %v", mode)
+	}
+}
 
+// isTerminal reports whether the file is attached to a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
 }
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNewProgressReporter(t *testing.T) {
+	cases := map[string]struct {
+		Mode        string
+		Expected    bool
+		ExpectedErr bool
+	}{
+		`Auto without a terminal`: {Mode: PROGRESS_AUTO},
+		`None`:                    {Mode: PROGRESS_NONE},
+		`JSON`:                    {Mode: PROGRESS_JSON, Expected: true},
+		`TTY`:                     {Mode: PROGRESS_TTY, Expected: true},
+		`Invalid`:                 {Mode: `bogus`, ExpectedErr: true},
+	}
+	for l, c := range cases {
+		stderr := &bytes.Buffer{}
+		o, err := newProgressReporter(stderr, c.Mode, false)
+		if (err != nil) != c.ExpectedErr {
+			t.Errorf("Case: %v, expected error %v, but was %v", l, c.ExpectedErr, err)
+		}
+		if (o != nil) != c.Expected {
+			t.Errorf("Case: %v, expected a reporter %v, but was %v", l, c.Expected, o)
+		}
+	}
+}
+
+func TestBuildReportFilter(t *testing.T) {
+	cases := map[string]struct {
+		Since       string
+		Until       string
+		Expected    bool
+		ExpectedErr bool
+	}{
+		`No dates`:           {},
+		`Since a day`:        {Since: `2022-05-01`, Expected: true},
+		`Until a day`:        {Until: `2022-05-01`, Expected: true},
+		`Blank since`:        {Since: ` `, ExpectedErr: true},
+		`Blank until`:        {Until: "\t", ExpectedErr: true},
+		`Latest since`:       {Since: `latest`, ExpectedErr: true},
+		`Until before since`: {Since: `2022-05-02`, Until: `2022-05-01`, ExpectedErr: true},
+	}
+	for l, c := range cases {
+		filter, err := buildReportFilter(c.Since, c.Until, false, 1, nil)
+		if (err != nil) != c.ExpectedErr {
+			t.Errorf("Case: %v, expected error %v, but was %v", l, c.ExpectedErr, err)
+			continue
+		}
+		if o := filter.Since != nil || filter.Until != nil; !c.ExpectedErr && o != c.Expected {
+			t.Errorf("Case: %v, expected a date bound %v, but was %v", l, c.Expected, o)
+		}
+	}
+}
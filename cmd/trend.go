@@ -0,0 +1,271 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cmd contains all cobra commands
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/k9securityio/k9-cli/core"
+	"github.com/k9securityio/k9-cli/views"
+	"github.com/spf13/cobra"
+)
+
+// trendCmd represents the trend command
+var trendCmd = &cobra.Command{
+	Use:   "trend",
+	Short: "Show how risk metrics for an account changed across its analyses",
+	Long: `Computes risk metrics for every analysis of an account in the local
+database and writes them as a time series, one row per analysis. The chart
+format draws a sparkline per metric.
+
+Over-permissioned principals and over-accessible resources are counted with
+the same limits as the corresponding risks queries. The iam_admins metric
+counts the principals reported by the privilege-escalation risks query.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		verbose, _ := cmd.Flags().GetBool(FLAG_VERBOSE)
+		format, _ := cmd.Flags().GetString(FLAG_FORMAT)
+		customerID := stringFlagOrConfig(cmd, FLAG_CUSTOMER_ID, CONFIG_CUSTOMER_ID)
+		accountID := stringFlagOrConfig(cmd, FLAG_ACCOUNT, CONFIG_ACCOUNT)
+		since, _ := cmd.Flags().GetString(FLAG_SINCE)
+		until, _ := cmd.Flags().GetString(FLAG_UNTIL)
+		services, _ := cmd.Flags().GetStringSlice(FLAG_SERVICE)
+		confidential, _ := cmd.Flags().GetStringSlice(FLAG_CONFIDENTIAL)
+		maxAdmins, _ := cmd.Flags().GetInt(FLAG_MAX_ADMIN)
+		maxRead, _ := cmd.Flags().GetInt(FLAG_MAX_READ)
+		maxWrite, _ := cmd.Flags().GetInt(FLAG_MAX_WRITE)
+		maxDelete, _ := cmd.Flags().GetInt(FLAG_MAX_DELETE)
+		reportHome := getReportHome(cmd)
+		stdout := cmd.OutOrStdout()
+		stderr := cmd.ErrOrStderr()
+
+		filter, err := buildReportFilter(since, until, false, 0, nil)
+		if err != nil {
+			fmt.Fprintf(stderr, "%v\n", err)
+			os.Exit(1)
+		}
+
+		opts := TrendOptions{
+			Services:      map[string]bool{},
+			Confidential:  map[string]bool{},
+			Permissions:   CapabilityLimitPolicy{AdminCap: maxAdmins, ReadCap: maxRead, WriteCap: maxWrite, DeleteCap: maxDelete},
+			Accessibility: AccessibilityPolicy{AdminCap: maxAdmins, ReadCap: maxRead, WriteCap: maxWrite, DeleteCap: maxDelete},
+		}
+		for _, s := range services {
+			opts.Services[s] = true
+		}
+		for _, c := range confidential {
+			opts.Confidential[strings.ToLower(c)] = true
+		}
+
+		DoTrend(stdout, stderr, reportHome, customerID, accountID, format, filter, opts, verbose)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(trendCmd)
+
+	trendCmd.Flags().String(FLAG_FORMAT, FORMAT_CHART, `Output format [chart|csv|json]`)
+	trendCmd.Flags().String(FLAG_CUSTOMER_ID, ``, `K9 customer ID for analysis (required)`)
+	markFlagRequiredOrConfig(trendCmd.Flags(), FLAG_CUSTOMER_ID, CONFIG_CUSTOMER_ID)
+	trendCmd.Flags().String(FLAG_ACCOUNT, ``, `AWS account ID for analysis (required)`)
+	markFlagRequiredOrConfig(trendCmd.Flags(), FLAG_ACCOUNT, CONFIG_ACCOUNT)
+	trendCmd.Flags().String(FLAG_SINCE, ``, `only include analyses on or after the specified date: `+core.DATE_EXPRESSION_HELP)
+	trendCmd.Flags().String(FLAG_UNTIL, ``, `only include analyses on or before the specified date: `+core.DATE_EXPRESSION_HELP)
+
+	trendCmd.Flags().StringSlice(FLAG_SERVICE, []string{}, `A list of service names to evaluate for access risks (default: all services)`)
+	trendCmd.Flags().StringSlice(FLAG_CONFIDENTIAL, []string{`confidential`},
+		`Values of the confidentiality tag that mark a resource as confidential`)
+	trendCmd.Flags().Int(FLAG_MAX_ADMIN, 5, `The maximum number of resources a principal, or principals a resource, may have with ADMIN access.`)
+	trendCmd.Flags().Int(FLAG_MAX_READ, 5, `The maximum number of resources a principal, or principals a resource, may have with READ access.`)
+	trendCmd.Flags().Int(FLAG_MAX_WRITE, 5, `The maximum number of resources a principal, or principals a resource, may have with WRITE access.`)
+	trendCmd.Flags().Int(FLAG_MAX_DELETE, 5, `The maximum number of resources a principal, or principals a resource, may have with DELETE access.`)
+}
+
+// TrendOptions configures the risk checks evaluated for each analysis. An
+// empty Services set evaluates every service. Confidential holds lower case
+// values of the confidentiality tag.
+type TrendOptions struct {
+	Services      map[string]bool
+	Confidential  map[string]bool
+	Permissions   CapabilityLimitPolicy
+	Accessibility AccessibilityPolicy
+}
+
+// TrendPoint holds the risk metrics of a single analysis.
+type TrendPoint struct {
+	AnalysisTime               time.Time `csv:"analysis_time" json:"analysis_time"`
+	Principals                 int       `csv:"principals" json:"principals"`
+	Resources                  int       `csv:"resources" json:"resources"`
+	IAMAdmins                  int       `csv:"iam_admins" json:"iam_admins"`
+	OverPermissionedPrincipals int       `csv:"over_permissioned_principals" json:"over_permissioned_principals"`
+	OverAccessibleResources    int       `csv:"over_accessible_resources" json:"over_accessible_resources"`
+	ConfidentialDataWriters    int       `csv:"confidential_data_writers" json:"confidential_data_writers"`
+}
+
+// DoTrend computes a TrendPoint for each selected analysis of the account,
+// oldest first. Analyses missing a required report kind are skipped with a
+// warning.
+func DoTrend(stdout, stderr io.Writer,
+	reportHome, customerID, accountID, format string,
+	filter core.ReportFilter,
+	opts TrendOptions,
+	verbose bool) {
+
+	db, err := core.LoadLocalDB(reportHome)
+	if err != nil {
+		fmt.Fprintf(stderr, "Unable to load local database, %v\n", err)
+		os.Exit(1)
+	}
+	WarnDBIssues(stderr, &db)
+	if verbose {
+		defer DumpDBStats(stderr, &db)
+	}
+
+	account, ok := db.Customers[customerID].Accounts[accountID]
+	if !ok {
+		fmt.Fprintf(stderr, "No reports found for customer: %v account: %v\n", customerID, accountID)
+		os.Exit(1)
+	}
+
+	points := []TrendPoint{}
+	for _, r := range filter.Selects(account.Reports) {
+		p, err := BuildTrendPoint(r, opts)
+		if err != nil {
+			fmt.Fprintf(stderr, "Skipping analysis %v: %v\n", r.Timestamp.Format(core.FILENAME_TIMESTAMP_LAYOUT), err)
+			continue
+		}
+		if verbose {
+			fmt.Fprintf(stderr, "Evaluated analysis %v\n", r.Timestamp.Format(core.FILENAME_TIMESTAMP_LAYOUT))
+		}
+		points = append(points, p)
+	}
+	if len(points) == 0 {
+		fmt.Fprintf(stderr, "No analyses found for customer: %v account: %v\n", customerID, accountID)
+		os.Exit(1)
+	}
+
+	if format != FORMAT_CHART {
+		views.Display(stdout, stderr, format, points)
+		return
+	}
+	writeTrendChart(stdout, points)
+}
+
+// writeTrendChart writes the analysis range followed by a sparkline for each
+// metric.
+func writeTrendChart(o io.Writer, points []TrendPoint) {
+	fmt.Fprintf(o, "%v to %v, %v analyses\n",
+		points[0].AnalysisTime.Format(core.FILENAME_TIMESTAMP_LAYOUT),
+		points[len(points)-1].AnalysisTime.Format(core.FILENAME_TIMESTAMP_LAYOUT),
+		len(points))
+
+	metric := func(name string, value func(TrendPoint) int) views.Series {
+		s := views.Series{Name: name}
+		for _, p := range points {
+			s.Values = append(s.Values, value(p))
+		}
+		return s
+	}
+	views.WriteSparklinesTo(o,
+		metric(`principals`, func(p TrendPoint) int { return p.Principals }),
+		metric(`resources`, func(p TrendPoint) int { return p.Resources }),
+		metric(`iam_admins`, func(p TrendPoint) int { return p.IAMAdmins }),
+		metric(`over_permissioned_principals`, func(p TrendPoint) int { return p.OverPermissionedPrincipals }),
+		metric(`over_accessible_resources`, func(p TrendPoint) int { return p.OverAccessibleResources }),
+		metric(`confidential_data_writers`, func(p TrendPoint) int { return p.ConfidentialDataWriters }),
+	)
+}
+
+// BuildTrendPoint loads the reports of an analysis and computes its metrics.
+func BuildTrendPoint(r core.LocalReport, opts TrendOptions) (TrendPoint, error) {
+	point := TrendPoint{AnalysisTime: r.Timestamp}
+
+	principals := &core.PrincipalsReport{}
+	if err := loadLocalReport(r, core.REPORT_TYPE_PREFIX_PRINCIPALS, principals); err != nil {
+		return point, err
+	}
+	resources := &core.ResourcesReport{}
+	if err := loadLocalReport(r, core.REPORT_TYPE_PREFIX_RESOURCES, resources); err != nil {
+		return point, err
+	}
+	principalAccess := &core.PrincipalAccessSummaryReport{}
+	if err := loadLocalReport(r, core.REPORT_TYPE_PREFIX_PRINCIPAL_ACCESS_SUMMARIES, principalAccess); err != nil {
+		return point, err
+	}
+	resourceAccess := &core.ResourceAccessSummaryReport{}
+	if err := loadLocalReport(r, core.REPORT_TYPE_PREFIX_RESOURCE_ACCESS_SUMMARIES, resourceAccess); err != nil {
+		return point, err
+	}
+
+	point.Principals = len(principals.Items)
+	point.Resources = len(resources.Items)
+	for _, i := range principals.Items {
+		if i.PrincipalIsIAMAdmin {
+			point.IAMAdmins++
+		}
+	}
+
+	services := opts.Services
+	if len(services) == 0 {
+		services = map[string]bool{}
+		for _, i := range principalAccess.Items {
+			services[i.ServiceName] = true
+		}
+		for _, i := range resourceAccess.Items {
+			services[i.ServiceName] = true
+		}
+	}
+	for _, s := range BuildPrincipalAccessSummaries(io.Discard, principalAccess.Items, services, false) {
+		if !opts.Permissions.IsCompliant(s) {
+			point.OverPermissionedPrincipals++
+		}
+	}
+	for _, s := range BuildResourceAccessSummaries(io.Discard, resourceAccess.Items, services, false) {
+		if !opts.Accessibility.IsCompliant(s) {
+			point.OverAccessibleResources++
+		}
+	}
+
+	writers := map[string]bool{}
+	for _, i := range resourceAccess.Items {
+		if i.AccessCapability == core.ACCESS_CAPABILITY_WRITE_DATA &&
+			opts.Confidential[strings.ToLower(i.ResourceTagConfidentiality)] {
+			writers[i.PrincipalARN] = true
+		}
+	}
+	point.ConfidentialDataWriters = len(writers)
+	return point, nil
+}
+
+// loadLocalReport loads the report of the specified kind into the collector.
+func loadLocalReport(r core.LocalReport, kind string, c core.Collector) error {
+	path, ok := r.Path(kind)
+	if !ok {
+		return fmt.Errorf("missing %v report", kind)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return core.LoadReport(f, c)
+}
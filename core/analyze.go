@@ -17,20 +17,14 @@ limitations under the License.
 package core
 
 import (
-	"bytes"
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
-	"encoding/json"
 	"fmt"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"net/url"
-	"os"
 	"time"
+
+	"github.com/k9securityio/k9-cli/core/api"
 )
 
 type analyzeRequestBody struct {
@@ -46,104 +40,122 @@ type analyzeResponseBody struct {
 	ExecutionID string `json:"executionId"`
 }
 
-func AnalyzeAccount(o io.Writer, cfg aws.Config, apiHost, customerID, account string) error {
-	analysisUrl := &url.URL{
-		Scheme: "https",
-		Host:   apiHost,
-		Path:   fmt.Sprintf("/customer/%s/account/%s/analysis", customerID, account),
+// analysis execution statuses, STARTED is recorded locally until the API
+// reports progress
+const (
+	ANALYSIS_STATUS_STARTED   = `STARTED`
+	ANALYSIS_STATUS_RUNNING   = `RUNNING`
+	ANALYSIS_STATUS_SUCCEEDED = `SUCCEEDED`
+	ANALYSIS_STATUS_FAILED    = `FAILED`
+	ANALYSIS_STATUS_TIMED_OUT = `TIMED_OUT`
+	ANALYSIS_STATUS_ABORTED   = `ABORTED`
+)
+
+// IsTerminalAnalysisStatus reports whether an execution with the status has
+// finished, successfully or not.
+func IsTerminalAnalysisStatus(status string) bool {
+	switch status {
+	case ANALYSIS_STATUS_SUCCEEDED, ANALYSIS_STATUS_FAILED, ANALYSIS_STATUS_TIMED_OUT, ANALYSIS_STATUS_ABORTED:
+		return true
 	}
+	return false
+}
 
-	requestBody := analyzeRequestBody{
+// Example:
+// {"executionId": "ondemand-C10000-139710491120-2022-09-15_TV49", "status": "RUNNING", "startDate": "2022-09-15T17:51:00Z"}
+type analysisStatusResponseBody struct {
+	ExecutionID string `json:"executionId"`
+	Status      string `json:"status"`
+	StartDate   string `json:"startDate"`
+	StopDate    string `json:"stopDate"`
+}
+
+func analysisPath(customerID, account string, elem ...string) string {
+	path := fmt.Sprintf("/customer/%s/account/%s/analysis", url.PathEscape(customerID), url.PathEscape(account))
+	for _, e := range elem {
+		path += `/` + url.PathEscape(e)
+	}
+	return path
+}
+
+// AnalyzeAccount starts an analysis of the account and returns a record of
+// the execution.
+func AnalyzeAccount(ctx context.Context, o io.Writer, client *api.Client, customerID, account string) (AnalysisExecution, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	execution := AnalysisExecution{
 		CustomerID: customerID,
 		Account:    account,
+		APIHost:    client.URL(),
+		Status:     ANALYSIS_STATUS_STARTED,
 	}
-	requestBodyBytes, _ := json.Marshal(requestBody)
 
-	request, err := http.NewRequest("POST", analysisUrl.String(), bytes.NewBuffer(requestBodyBytes))
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Could not build API request: %s\n", err)
-		return err
+	requestBody := analyzeRequestBody{
+		CustomerID: customerID,
+		Account:    account,
 	}
-	now := time.Now()
-	request.Header.Set("Date", now.Format(time.RFC3339))
-	request.Header.Set("Content-Type", "application/json")
-
-	if err != signApiRequest(cfg, request, now) {
-		fmt.Fprintf(os.Stderr, "Could not sign API request: %s\n", err)
-		return err
+	analyzeResponse := analyzeResponseBody{}
+	if err := client.Do(ctx, http.MethodPost, analysisPath(customerID, account), requestBody, &analyzeResponse); err != nil {
+		return execution, fmt.Errorf("could not start analysis for %s account %s: %w", customerID, account, err)
 	}
-
-	response, err := http.DefaultClient.Do(request)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Could not execute API request: %s\n", err)
-		return err
-	} else {
-		defer response.Body.Close()
+	if len(analyzeResponse.ExecutionID) == 0 {
+		return execution, fmt.Errorf("could not start analysis for %s account %s: no execution ID in the API response", customerID, account)
 	}
 
-	body, _ := ioutil.ReadAll(response.Body)
-	responseBodyStr := string(body)
-	if response.StatusCode == http.StatusOK || response.StatusCode == http.StatusAccepted {
-		analyzeResponse := analyzeResponseBody{}
-		if err != json.Unmarshal(body, &analyzeResponse) {
-			fmt.Fprintf(os.Stderr, "Could not deserialize API response: %s\n", responseBodyStr)
-			return err
-		}
-
-		fmt.Fprintf(o, "Started analysis for %s account %s with execution ID: %s\n",
-			customerID,
-			account,
-			analyzeResponse.ExecutionID)
-	} else {
-		fmt.Fprintf(os.Stderr, "Analyze API Response Status: %s\n", response.Status)
-		fmt.Fprintf(os.Stderr, "Could not start analysis for %s account %s.  API Response: %s\n",
-			customerID,
-			account,
-			responseBodyStr)
-	}
-	return nil
+	execution.ExecutionID = analyzeResponse.ExecutionID
+	execution.StartedAt = now
+	execution.UpdatedAt = now
+	fmt.Fprintf(o, "Started analysis for %s account %s with execution ID: %s\n",
+		customerID,
+		account,
+		analyzeResponse.ExecutionID)
+	return execution, nil
 }
 
-// Sign a request to the k9 Security AWS API gateway endpoint with an AWS v4 signature
-// using the aws-sdk-go-v2 v4.SignHTTP function.
-//
-// The request should be fully-built and ready to send to the gateway.
-//
-// The provided request will be modified in place.
-func signApiRequest(cfg aws.Config, request *http.Request, signingTime time.Time) error {
-	ctx := context.TODO()
-	credentials, err := cfg.Credentials.Retrieve(ctx)
-	if err != nil {
-		return err
+// GetAnalysisStatus retrieves the status of an analysis execution and
+// returns the execution updated with it.
+func GetAnalysisStatus(ctx context.Context, client *api.Client, execution AnalysisExecution) (AnalysisExecution, error) {
+	status := analysisStatusResponseBody{}
+	path := analysisPath(execution.CustomerID, execution.Account, execution.ExecutionID)
+	if err := client.Do(ctx, http.MethodGet, path, nil, &status); err != nil {
+		return execution, fmt.Errorf("could not get the status of execution %s: %w", execution.ExecutionID, err)
 	}
-
-	hash, err := createPayloadHash(request)
-	if err != nil {
-		return err
+	if len(status.Status) == 0 {
+		return execution, fmt.Errorf("could not get the status of execution %s: no status in the API response", execution.ExecutionID)
 	}
-
-	signer := v4.NewSigner()
-	if err != signer.SignHTTP(ctx, credentials, request, hash, "execute-api", cfg.Region, signingTime) {
-		return err
+	execution.Status = status.Status
+	execution.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	if t, ok := ParseReportTime(status.StopDate); ok {
+		execution.StoppedAt = t.UTC()
 	}
-
-	// fmt.Printf("Authorization: %s\n", request.Header.Get("Authorization"))
-	return err
+	return execution, nil
 }
 
-// Create a hex-encoded SHA256 hash of the request payload.  Use when calculating an AWS v4 signature.
-func createPayloadHash(req *http.Request) (string, error) {
-	// from https://github.com/yuizho/salon/blob/a159bcfeb263cb6502403f682c138286a2d7bb1f/backend/lambda/mutate-user/appsync/client.go
-	body, err := req.GetBody()
-	if err != nil {
-		return "", err
-	}
-	var buf bytes.Buffer
-	_, err = buf.ReadFrom(body)
-	if err != nil {
-		return "", err
+// WaitForAnalysis polls the status of the execution every interval until it
+// reaches a terminal status or the context is done. Each status retrieved
+// is passed to update, which may be nil.
+func WaitForAnalysis(ctx context.Context, execution AnalysisExecution, interval time.Duration,
+	poll func(AnalysisExecution) (AnalysisExecution, error),
+	update func(AnalysisExecution)) (AnalysisExecution, error) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		next, err := poll(execution)
+		if err != nil {
+			return execution, err
+		}
+		execution = next
+		if update != nil {
+			update(execution)
+		}
+		if IsTerminalAnalysisStatus(execution.Status) {
+			return execution, nil
+		}
+		select {
+		case <-ctx.Done():
+			return execution, fmt.Errorf("gave up waiting for execution %s in status %s: %w",
+				execution.ExecutionID, execution.Status, ctx.Err())
+		case <-ticker.C:
+		}
 	}
-
-	b := sha256.Sum256(buf.Bytes())
-	return hex.EncodeToString(b[:]), nil
 }
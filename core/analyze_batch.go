@@ -0,0 +1,133 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// accountIDPattern matches a 12 digit AWS account ID.
+var accountIDPattern = regexp.MustCompile(`^[0-9]{12}$`)
+
+// BatchOptions controls how AnalyzeAccounts starts analyses.
+type BatchOptions struct {
+	// Concurrency is the number of analyses requested at the same time.
+	Concurrency int
+	// Rate is the maximum number of analyses started per second, 0 is
+	// unlimited.
+	Rate float64
+}
+
+// BatchResult is the outcome of starting the analysis of one account.
+type BatchResult struct {
+	CustomerID  string `csv:"customer_id" json:"customer_id"`
+	Account     string `csv:"account" json:"account"`
+	ExecutionID string `csv:"execution_id" json:"execution_id"`
+	Status      string `csv:"status" json:"status"`
+	Error       string `csv:"error" json:"error,omitempty"`
+}
+
+// ReadAccountList reads account IDs from r, one per line. Blank lines and
+// text following a # are ignored, and repeated accounts are listed once.
+func ReadAccountList(r io.Reader) ([]string, error) {
+	out := []string{}
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.Index(line, `#`); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if !accountIDPattern.MatchString(line) {
+			return out, fmt.Errorf(`line %v: invalid account ID %q`, n, line)
+		}
+		if !seen[line] {
+			seen[line] = true
+			out = append(out, line)
+		}
+	}
+	return out, scanner.Err()
+}
+
+// AnalyzeAccounts starts an analysis of each account by calling analyze,
+// with at most opts.Concurrency calls in flight and no more than opts.Rate
+// calls started per second. Results are returned in the order of accounts.
+// When any analysis fails to start, an AggregateError describes the
+// failures. Accounts not started before the context is done fail with the
+// context's error.
+func AnalyzeAccounts(ctx context.Context, accounts []AccountKey, opts BatchOptions,
+	analyze func(context.Context, AccountKey) (AnalysisExecution, error)) ([]BatchResult, error) {
+
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	results := make([]BatchResult, len(accounts))
+	errs := make([]error, len(accounts))
+	limiter := newRateLimiter(opts.Rate)
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				a := accounts[i]
+				results[i] = BatchResult{CustomerID: a.CustomerID, Account: a.Account}
+				if errs[i] = limiter.wait(ctx); errs[i] != nil {
+					errs[i] = fmt.Errorf("analysis of %s account %s not started: %w", a.CustomerID, a.Account, errs[i])
+					results[i].Error = errs[i].Error()
+					continue
+				}
+				execution, err := analyze(ctx, a)
+				if err != nil {
+					errs[i] = err
+					results[i].Error = err.Error()
+					continue
+				}
+				results[i].ExecutionID = execution.ExecutionID
+				results[i].Status = execution.Status
+			}
+		}()
+	}
+	for i := range accounts {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	failed := []error{}
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) > 0 {
+		return results, &AggregateError{len(failed) < len(accounts), failed}
+	}
+	return results, nil
+}
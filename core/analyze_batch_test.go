@@ -0,0 +1,92 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadAccountList(t *testing.T) {
+	cases := map[string]struct {
+		Input    string
+		Expected []string
+		Err      bool
+	}{
+		`Empty`:    {``, []string{}, false},
+		`Accounts`: {"111111111111\n222222222222\n", []string{`111111111111`, `222222222222`}, false},
+		`Comments`: {"# prod\n111111111111  # payments\n\n  222222222222\n", []string{`111111111111`, `222222222222`}, false},
+		`Repeated`: {"111111111111\n111111111111\n", []string{`111111111111`}, false},
+		`Invalid`:  {"111111111111\nprod\n", nil, true},
+		`Short`:    {"11111\n", nil, true},
+	}
+	for l, c := range cases {
+		o, err := ReadAccountList(strings.NewReader(c.Input))
+		if (err != nil) != c.Err {
+			t.Errorf("Case: %v, unexpected error state: %v", l, err)
+			continue
+		}
+		if !c.Err && !reflect.DeepEqual(o, c.Expected) {
+			t.Errorf("Case: %v, expected %v, but was %v", l, c.Expected, o)
+		}
+	}
+}
+
+func TestAnalyzeAccounts(t *testing.T) {
+	accounts := []AccountKey{{`C1`, `111`}, {`C1`, `222`}, {`C1`, `333`}, {`C1`, `444`}, {`C1`, `555`}}
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	analyze := func(ctx context.Context, a AccountKey) (AnalysisExecution, error) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		if a.Account == `333` {
+			return AnalysisExecution{CustomerID: a.CustomerID, Account: a.Account, Status: ANALYSIS_STATUS_STARTED}, errors.New(`not authorized`)
+		}
+		return AnalysisExecution{CustomerID: a.CustomerID, Account: a.Account,
+			ExecutionID: `ex-` + a.Account, Status: ANALYSIS_STATUS_STARTED}, nil
+	}
+
+	results, err := AnalyzeAccounts(context.Background(), accounts, BatchOptions{Concurrency: 2}, analyze)
+	var aggregate *AggregateError
+	if !errors.As(err, &aggregate) || !aggregate.IsPartial() || len(aggregate.Errors()) != 1 {
+		t.Fatalf(`expected a partial failure of one account, was %v`, err)
+	}
+	if maxInFlight > 2 {
+		t.Errorf(`expected at most 2 analyses in flight, was %v`, maxInFlight)
+	}
+	if len(results) != len(accounts) {
+		t.Fatalf(`expected %v results, was %v`, len(accounts), len(results))
+	}
+	for i, r := range results {
+		if r.Account != accounts[i].Account {
+			t.Errorf(`expected results in the order of accounts, %v was %v`, i, r.Account)
+		}
+		if failed := r.Account == `333`; failed != (len(r.Error) > 0) || failed == (r.Status == ANALYSIS_STATUS_STARTED) {
+			t.Errorf(`unexpected result for account %v: %v`, r.Account, r)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err = AnalyzeAccounts(ctx, accounts[:2], BatchOptions{Concurrency: 2, Rate: 1}, analyze)
+	if !errors.As(err, &aggregate) || aggregate.IsPartial() {
+		t.Errorf(`expected every analysis to fail once the context is done, was %v`, err)
+	}
+	for _, r := range results {
+		if len(r.ExecutionID) > 0 || len(r.Error) == 0 {
+			t.Errorf(`expected account %v not to be started, was %v`, r.Account, r)
+		}
+	}
+}
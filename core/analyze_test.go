@@ -0,0 +1,141 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/k9securityio/k9-cli/core/api"
+)
+
+func TestGetAnalysisStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case `/customer/C1/account/111/analysis/done`:
+			w.Write([]byte(`{"executionId":"done","status":"SUCCEEDED","stopDate":"2022-09-15T18:00:00Z"}`))
+		case `/customer/C1/account/111/analysis/running`:
+			w.Write([]byte(`{"executionId":"running","status":"RUNNING"}`))
+		case `/customer/C1/account/111/analysis/ondemand%2FC1%20111%25`:
+			w.Write([]byte(`{"executionId":"ondemand/C1 111%","status":"RUNNING"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cases := map[string]struct {
+		ExecutionID string
+		Expected    string
+		Valid       bool
+	}{
+		`Succeeded`: {`done`, ANALYSIS_STATUS_SUCCEEDED, true},
+		`Running`:   {`running`, ANALYSIS_STATUS_RUNNING, true},
+		`Reserved`:  {`ondemand/C1 111%`, ANALYSIS_STATUS_RUNNING, true},
+		`Unknown`:   {`missing`, ANALYSIS_STATUS_STARTED, false},
+	}
+	client, _ := api.New(testAPIConfig(), server.URL, api.WithRetries(0))
+	for l, c := range cases {
+		e := AnalysisExecution{ExecutionID: c.ExecutionID, CustomerID: `C1`, Account: `111`, APIHost: server.URL, Status: ANALYSIS_STATUS_STARTED}
+		o, err := GetAnalysisStatus(context.Background(), client, e)
+		if (err == nil) != c.Valid || o.Status != c.Expected {
+			t.Errorf("Case: %v, expected %v, but was %v, %v", l, c.Expected, o.Status, err)
+		}
+	}
+}
+
+func TestAnalyzeAccount(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method != http.MethodPost:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case r.URL.Path == `/customer/C1/account/111/analysis`:
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"customerId":"C1","accountId":"111","executionId":"ondemand-C1-111"}`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message":"not authorized"}`))
+		}
+	}))
+	defer server.Close()
+
+	cases := map[string]struct {
+		Account  string
+		Expected string
+		Status   int
+	}{
+		`Started`:        {`111`, `ondemand-C1-111`, 0},
+		`Not authorized`: {`222`, ``, http.StatusForbidden},
+	}
+	client, _ := api.New(testAPIConfig(), server.URL, api.WithRetries(0))
+	for l, c := range cases {
+		o, err := AnalyzeAccount(context.Background(), io.Discard, client, `C1`, c.Account)
+		if o.ExecutionID != c.Expected || api.StatusCode(err) != c.Status || (c.Status == 0) != (err == nil) {
+			t.Errorf("Case: %v, expected %v, %v, but was %v, %v", l, c.Expected, c.Status, o.ExecutionID, err)
+		}
+		if err == nil && (o.Status != ANALYSIS_STATUS_STARTED || o.APIHost != server.URL) {
+			t.Errorf("Case: %v, expected a started execution for %v, but was %v", l, server.URL, o)
+		}
+	}
+}
+
+func TestWaitForAnalysis(t *testing.T) {
+	statuses := []string{ANALYSIS_STATUS_RUNNING, ANALYSIS_STATUS_RUNNING, ANALYSIS_STATUS_SUCCEEDED}
+	polls := 0
+	poll := func(e AnalysisExecution) (AnalysisExecution, error) {
+		e.Status = statuses[polls]
+		polls++
+		return e, nil
+	}
+	updates := 0
+	o, err := WaitForAnalysis(context.Background(), AnalysisExecution{ExecutionID: `x`}, time.Millisecond, poll,
+		func(AnalysisExecution) { updates++ })
+	if err != nil || o.Status != ANALYSIS_STATUS_SUCCEEDED || polls != 3 || updates != 3 {
+		t.Errorf("Case: completes, expected %v after 3 polls, but was %v after %v, %v", ANALYSIS_STATUS_SUCCEEDED, o.Status, polls, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	running := func(e AnalysisExecution) (AnalysisExecution, error) {
+		e.Status = ANALYSIS_STATUS_RUNNING
+		return e, nil
+	}
+	if _, err = WaitForAnalysis(ctx, AnalysisExecution{ExecutionID: `x`}, time.Millisecond, running, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Case: timeout, expected %v, but was %v", context.DeadlineExceeded, err)
+	}
+
+	failing := func(e AnalysisExecution) (AnalysisExecution, error) {
+		return e, fmt.Errorf(`unavailable`)
+	}
+	if _, err = WaitForAnalysis(context.Background(), AnalysisExecution{ExecutionID: `x`}, time.Millisecond, failing, nil); err == nil {
+		t.Errorf(`Case: poll error, expected an error`)
+	}
+}
+
+func TestExecutionLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), EXECUTIONS_FILENAME)
+	first := time.Date(2022, time.September, 15, 17, 0, 0, 0, time.UTC)
+
+	if err := RecordExecution(path, AnalysisExecution{ExecutionID: `a`, Status: ANALYSIS_STATUS_STARTED, StartedAt: first}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	RecordExecution(path, AnalysisExecution{ExecutionID: `b`, Status: ANALYSIS_STATUS_STARTED, StartedAt: first.Add(time.Hour)})
+	RecordExecution(path, AnalysisExecution{ExecutionID: `a`, Status: ANALYSIS_STATUS_SUCCEEDED, StartedAt: first})
+
+	l, err := LoadExecutionLog(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	list := l.List()
+	if len(list) != 2 || list[0].ExecutionID != `b` {
+		t.Errorf("Case: list, expected b first of 2, but was %v", list)
+	}
+	if e, ok := l.Get(`a`); !ok || e.Status != ANALYSIS_STATUS_SUCCEEDED {
+		t.Errorf("Case: update, expected %v, but was %v", ANALYSIS_STATUS_SUCCEEDED, e.Status)
+	}
+}
@@ -0,0 +1,278 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package api is a client for the k9 Security API. Requests are signed with
+// AWS SigV4 using the caller's AWS credentials, failed requests are retried
+// with exponential backoff, and error responses are returned as ClientError
+// or ServerError.
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// client defaults
+const (
+	DEFAULT_HOST        = `api.k9security.io`
+	DEFAULT_TIMEOUT     = 30 * time.Second
+	DEFAULT_RETRIES     = 3
+	DEFAULT_BACKOFF     = 500 * time.Millisecond
+	DEFAULT_MAX_BACKOFF = 10 * time.Second
+
+	// SIGNING_SERVICE is the SigV4 service name of the API gateway.
+	SIGNING_SERVICE = `execute-api`
+)
+
+// Client sends signed requests to the k9 Security API. A Client is safe for
+// concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	cfg        aws.Config
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	sleep      func(context.Context, time.Duration) error
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithTimeout limits the duration of each attempt of a request.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) { c.httpClient.Timeout = d }
+}
+
+// WithRetries sets the number of times a failed request is retried.
+func WithRetries(n int) Option {
+	return func(c *Client) { c.retries = n }
+}
+
+// WithBackoff sets the delay before the first retry, which doubles for each
+// further retry up to max.
+func WithBackoff(initial, max time.Duration) Option {
+	return func(c *Client) {
+		c.backoff = initial
+		c.maxBackoff = max
+	}
+}
+
+// WithHTTPClient replaces the underlying HTTP client, e.g. to trust a test
+// server. The timeout of the provided client is used unless WithTimeout is
+// applied after it.
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) { c.httpClient = h }
+}
+
+// BaseURL converts a configured API host into a base URL. Hosts without a
+// scheme use https and an empty host is DEFAULT_HOST.
+func BaseURL(host string) string {
+	if len(host) == 0 {
+		host = DEFAULT_HOST
+	}
+	if strings.Contains(host, `://`) {
+		return host
+	}
+	return `https://` + host
+}
+
+// New returns a Client for the API at the provided host or base URL, e.g.
+// api.k9security.io or http://localhost:8080. Requests are signed with the
+// credentials and region of cfg.
+func New(cfg aws.Config, host string, opts ...Option) (*Client, error) {
+	base, err := url.Parse(BaseURL(host))
+	if err != nil {
+		return nil, fmt.Errorf(`invalid API host %v: %w`, host, err)
+	}
+	if base.Scheme != `http` && base.Scheme != `https` {
+		return nil, fmt.Errorf(`invalid API host %v: unsupported scheme %v`, host, base.Scheme)
+	}
+	c := &Client{
+		baseURL:    base,
+		httpClient: &http.Client{Timeout: DEFAULT_TIMEOUT},
+		cfg:        cfg,
+		retries:    DEFAULT_RETRIES,
+		backoff:    DEFAULT_BACKOFF,
+		maxBackoff: DEFAULT_MAX_BACKOFF,
+		sleep:      sleepContext,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c, nil
+}
+
+// URL returns the base URL the client sends requests to.
+func (c *Client) URL() string {
+	return c.baseURL.String()
+}
+
+// Do sends a request with an optional JSON body and decodes a JSON response
+// into out, which may be nil. The path is appended to the path of the base
+// URL, and its segments must already be escaped, e.g. with url.PathEscape.
+// Requests that fail with a network error, a 5xx status, or 429 Too Many
+// Requests are retried with backoff. POST requests are not idempotent and
+// are only retried on 429.
+func (c *Client) Do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return fmt.Errorf(`could not serialize API request: %w`, err)
+		}
+	}
+	target, err := c.requestURL(path)
+	if err != nil {
+		return fmt.Errorf(`could not build API request: %w`, err)
+	}
+
+	var respBody []byte
+	for attempt := 0; ; attempt++ {
+		var retryAfter time.Duration
+		respBody, retryAfter, err = c.attempt(ctx, method, target, body)
+		if err == nil || attempt >= c.retries || ctx.Err() != nil || !c.retryable(method, err) {
+			break
+		}
+		delay := c.backoff << attempt
+		if delay > c.maxBackoff || delay <= 0 {
+			delay = c.maxBackoff
+		}
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		if serr := c.sleep(ctx, delay); serr != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if out != nil && len(respBody) > 0 {
+		if err = json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf(`could not deserialize API response: %v`, string(respBody))
+		}
+	}
+	return nil
+}
+
+// requestURL joins the escaped path to the path of the base URL.
+func (c *Client) requestURL(path string) (string, error) {
+	joined, err := url.Parse(strings.TrimSuffix(c.baseURL.EscapedPath(), `/`) + `/` + strings.TrimPrefix(path, `/`))
+	if err != nil {
+		return ``, err
+	}
+	target := *c.baseURL
+	target.Path, target.RawPath = joined.Path, joined.RawPath
+	return target.String(), nil
+}
+
+// attempt sends a single signed request and returns the response body, or
+// an error and any delay requested with Retry-After.
+func (c *Client) attempt(ctx context.Context, method, target string, body []byte) ([]byte, time.Duration, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, 0, fmt.Errorf(`could not build API request: %w`, err)
+	}
+	now := time.Now()
+	request.Header.Set(`Date`, now.Format(time.RFC3339))
+	if body != nil {
+		request.Header.Set(`Content-Type`, `application/json`)
+	}
+	if err = SignRequest(ctx, c.cfg, request, body, now); err != nil {
+		return nil, 0, fmt.Errorf(`could not sign API request: %w`, err)
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, 0, &NetworkError{Err: err}
+	}
+	defer response.Body.Close()
+	respBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, 0, &NetworkError{Err: err}
+	}
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return respBody, 0, nil
+	}
+
+	status := StatusError{
+		StatusCode: response.StatusCode,
+		Status:     response.Status,
+		Message:    errorMessage(respBody),
+		Method:     method,
+		URL:        target,
+	}
+	if response.StatusCode >= 500 {
+		return nil, 0, &ServerError{status}
+	}
+	var retryAfter time.Duration
+	if s, err := strconv.Atoi(response.Header.Get(`Retry-After`)); err == nil {
+		retryAfter = time.Duration(s) * time.Second
+	}
+	return nil, retryAfter, &ClientError{status}
+}
+
+func (c *Client) retryable(method string, err error) bool {
+	var ce *ClientError
+	if errors.As(err, &ce) {
+		return ce.StatusCode == http.StatusTooManyRequests
+	}
+	if method == http.MethodPost {
+		return false
+	}
+	var ne *NetworkError
+	var se *ServerError
+	return errors.As(err, &ne) || errors.As(err, &se)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// errorMessage extracts the message from an API error response, falling
+// back to the raw body.
+func errorMessage(body []byte) string {
+	e := struct {
+		Message string `json:"message"`
+	}{}
+	if err := json.Unmarshal(body, &e); err == nil && len(e.Message) > 0 {
+		return e.Message
+	}
+	return strings.TrimSpace(string(body))
+}
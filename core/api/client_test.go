@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func testConfig() aws.Config {
+	return aws.Config{
+		Region: `us-east-1`,
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: `AKID`, SecretAccessKey: `SECRET`}, nil
+		}),
+	}
+}
+
+// statusServer responds with each status in turn, repeating the last, and
+// counts the requests it receives.
+func statusServer(t *testing.T, statuses ...int) (*httptest.Server, *int32) {
+	count := new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(count, 1)) - 1
+		if n >= len(statuses) {
+			n = len(statuses) - 1
+		}
+		if !strings.HasPrefix(r.Header.Get(`Authorization`), `AWS4-HMAC-SHA256`) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.Header.Get(`X-Amz-Content-Sha256`) != `` && r.Header.Get(`X-Amz-Content-Sha256`) != PayloadHash(nil) {
+			t.Errorf(`unexpected payload hash header`)
+		}
+		w.WriteHeader(statuses[n])
+		if statuses[n] < 300 {
+			w.Write([]byte(`{"value":"ok"}`))
+		} else {
+			w.Write([]byte(`{"message":"failed"}`))
+		}
+	}))
+	return server, count
+}
+
+func TestClientDo(t *testing.T) {
+	cases := map[string]struct {
+		Method   string
+		Statuses []int
+		Requests int32
+		Status   int
+		Server   bool
+	}{
+		`Success`:                 {http.MethodGet, []int{200}, 1, 0, false},
+		`Retried server error`:    {http.MethodGet, []int{500, 502, 200}, 3, 0, false},
+		`Exhausted retries`:       {http.MethodGet, []int{503}, 3, 503, true},
+		`Client error`:            {http.MethodGet, []int{404}, 1, 404, false},
+		`Post not retried`:        {http.MethodPost, []int{500, 200}, 1, 500, true},
+		`Post retried when busy`:  {http.MethodPost, []int{429, 202}, 2, 0, false},
+		`Conflict is not retried`: {http.MethodPost, []int{409}, 1, 409, false},
+	}
+	for l, c := range cases {
+		server, count := statusServer(t, c.Statuses...)
+		client, err := New(testConfig(), server.URL, WithRetries(2), WithBackoff(time.Millisecond, time.Millisecond))
+		if err != nil {
+			t.Fatalf("Case: %v, unexpected error: %v", l, err)
+		}
+		out := struct{ Value string }{}
+		err = client.Do(context.Background(), c.Method, `/test`, map[string]string{`a`: `b`}, &out)
+		server.Close()
+
+		if *count != c.Requests {
+			t.Errorf("Case: %v, expected %v requests, but was %v", l, c.Requests, *count)
+		}
+		if o := StatusCode(err); o != c.Status {
+			t.Errorf("Case: %v, expected status %v, but was %v, %v", l, c.Status, o, err)
+		}
+		var se *ServerError
+		var ce *ClientError
+		if c.Status != 0 && (errors.As(err, &se) != c.Server || errors.As(err, &ce) == c.Server) {
+			t.Errorf("Case: %v, expected a server error %v, but was %T", l, c.Server, err)
+		}
+		if c.Status == 0 && out.Value != `ok` {
+			t.Errorf("Case: %v, expected the response to be decoded, but was %v", l, out)
+		}
+	}
+}
+
+func TestClientRequest(t *testing.T) {
+	var method, path, contentType string
+	var body map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, contentType = r.Method, r.URL.Path, r.Header.Get(`Content-Type`)
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client, _ := New(testConfig(), server.URL)
+	if err := client.Do(context.Background(), http.MethodPut, `/customer/C1`, map[string]string{`name`: `x`}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if method != http.MethodPut || path != `/customer/C1` || contentType != `application/json` || body[`name`] != `x` {
+		t.Errorf("Case: request, expected PUT /customer/C1 with a json body, but was %v %v %v %v", method, path, contentType, body)
+	}
+}
+
+func TestClientRequestPath(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.EscapedPath()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cases := map[string]struct {
+		Base     string
+		Path     string
+		Expected string
+	}{
+		`No base path`:         {``, `/customer/C1`, `/customer/C1`},
+		`Base path`:            {`/prod`, `/customer/C1`, `/prod/customer/C1`},
+		`Base path with slash`: {`/prod/`, `/customer/C1`, `/prod/customer/C1`},
+		`Nested base path`:     {`/k9/v1`, `/customer`, `/k9/v1/customer`},
+		`Relative path`:        {`/prod`, `customer`, `/prod/customer`},
+		`Escaped segment`:      {`/prod`, `/customer/` + url.PathEscape(`C 1/%`), `/prod/customer/C%201%2F%25`},
+		`Escaped base path`:    {`/a%2Fb`, `/customer`, `/a%2Fb/customer`},
+	}
+	for l, c := range cases {
+		client, err := New(testConfig(), server.URL+c.Base)
+		if err != nil {
+			t.Fatalf("Case: %v, unexpected error: %v", l, err)
+		}
+		if err = client.Do(context.Background(), http.MethodGet, c.Path, nil, nil); err != nil {
+			t.Errorf("Case: %v, unexpected error: %v", l, err)
+		}
+		if path != c.Expected {
+			t.Errorf("Case: %v, expected %v, but was %v", l, c.Expected, path)
+		}
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client, _ := New(testConfig(), server.URL, WithTimeout(20*time.Millisecond), WithRetries(1), WithBackoff(time.Millisecond, time.Millisecond))
+	err := client.Do(context.Background(), http.MethodGet, `/slow`, nil, nil)
+	var ne *NetworkError
+	if !errors.As(err, &ne) {
+		t.Errorf("Case: timeout, expected a network error, but was %v", err)
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	client, _ := New(aws.Config{}, `http://localhost:1`)
+	if err := client.Do(context.Background(), http.MethodGet, `/`, nil, nil); err == nil || !strings.Contains(err.Error(), `sign`) {
+		t.Errorf("Case: no credentials, expected a signing error, but was %v", err)
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	cases := map[string]struct {
+		Input    string
+		Expected string
+	}{
+		`Default`:     {``, `https://api.k9security.io`},
+		`Host`:        {`api.example.com`, `https://api.example.com`},
+		`With scheme`: {`http://localhost:8080`, `http://localhost:8080`},
+	}
+	for l, c := range cases {
+		if o := BaseURL(c.Input); o != c.Expected {
+			t.Errorf("Case: %v, expected %v, but was %v", l, c.Expected, o)
+		}
+	}
+	if _, err := New(testConfig(), `ftp://example.com`); err == nil {
+		t.Errorf(`Case: unsupported scheme, expected an error`)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// StatusError describes an API response with an error status.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Message    string
+	Method     string
+	URL        string
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf(`%v %v: %v: %v`, e.Method, e.URL, e.Status, e.Message)
+}
+
+// ClientError is returned for 4xx responses, the request was rejected.
+type ClientError struct {
+	StatusError
+}
+
+// ServerError is returned for 5xx responses, the API failed to handle the
+// request.
+type ServerError struct {
+	StatusError
+}
+
+// NetworkError is returned when no response was received.
+type NetworkError struct {
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf(`could not execute API request: %v`, e.Err)
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns the status of an API error response, or zero if err is
+// not one.
+func StatusCode(err error) int {
+	var ce *ClientError
+	if errors.As(err, &ce) {
+		return ce.StatusCode
+	}
+	var se *ServerError
+	if errors.As(err, &se) {
+		return se.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound reports whether err is a 404 response.
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
+
+// IsConflict reports whether err is a 409 response.
+func IsConflict(err error) bool {
+	return StatusCode(err) == http.StatusConflict
+}
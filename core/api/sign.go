@@ -0,0 +1,50 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// SignRequest signs a request to the k9 Security AWS API gateway endpoint
+// with an AWS v4 signature. The body must be the request payload, nil for
+// requests without one. The request is modified in place.
+func SignRequest(ctx context.Context, cfg aws.Config, request *http.Request, body []byte, signingTime time.Time) error {
+	if cfg.Credentials == nil {
+		return errors.New(`no AWS credentials configured`)
+	}
+	credentials, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return err
+	}
+	return v4.NewSigner().SignHTTP(ctx, credentials, request, PayloadHash(body), SIGNING_SERVICE, cfg.Region, signingTime)
+}
+
+// PayloadHash returns the hex-encoded SHA256 hash of a request payload as
+// used in an AWS v4 signature.
+func PayloadHash(body []byte) string {
+	b := sha256.Sum256(body)
+	return hex.EncodeToString(b[:])
+}
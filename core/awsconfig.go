@@ -0,0 +1,140 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// DEFAULT_ROLE_SESSION_NAME identifies sessions of roles assumed by the CLI
+// in CloudTrail.
+const DEFAULT_ROLE_SESSION_NAME = `k9-cli`
+
+// AWSOptions selects the AWS credentials and region used to reach the
+// secure inbox and the k9 API. Empty fields fall back to the standard AWS
+// configuration chain.
+type AWSOptions struct {
+	// Profile is a profile in the shared AWS config and credentials files.
+	Profile string
+	Region  string
+
+	// RoleARN is a role assumed with the credentials of the profile, e.g.
+	// to read a customer's secure inbox from another account.
+	RoleARN     string
+	ExternalID  string
+	SessionName string
+	Duration    time.Duration
+
+	// MFASerial is the MFA device required by the role's trust policy, the
+	// token code is requested from TokenProvider.
+	MFASerial     string
+	TokenProvider func() (string, error)
+}
+
+// Validate checks that role options are only set along with a role.
+func (o AWSOptions) Validate() error {
+	if len(o.RoleARN) > 0 {
+		if len(o.MFASerial) > 0 && o.TokenProvider == nil {
+			return &IllegalArgumentError{`mfa-serial`, `requires an MFA token provider`}
+		}
+		return nil
+	}
+	if len(o.ExternalID) > 0 {
+		return &IllegalArgumentError{`external-id`, `requires a role ARN`}
+	}
+	if len(o.MFASerial) > 0 {
+		return &IllegalArgumentError{`mfa-serial`, `requires a role ARN`}
+	}
+	return nil
+}
+
+// LoadAWSConfig loads the AWS configuration for the options. Roles assumed
+// by profiles in the shared config that require MFA also request a token
+// from the TokenProvider.
+func LoadAWSConfig(ctx context.Context, o AWSOptions) (aws.Config, error) {
+	if err := o.Validate(); err != nil {
+		return aws.Config{}, err
+	}
+	loadOptions := []func(*config.LoadOptions) error{}
+	if len(o.Profile) > 0 {
+		// a missing profile is otherwise ignored in favor of the default
+		// credentials
+		if _, err := config.LoadSharedConfigProfile(ctx, o.Profile, sharedConfigFiles); err != nil {
+			return aws.Config{}, err
+		}
+		loadOptions = append(loadOptions, config.WithSharedConfigProfile(o.Profile))
+	}
+	if len(o.Region) > 0 {
+		loadOptions = append(loadOptions, config.WithRegion(o.Region))
+	}
+	if o.TokenProvider != nil {
+		loadOptions = append(loadOptions, config.WithAssumeRoleCredentialOptions(func(ao *stscreds.AssumeRoleOptions) {
+			ao.TokenProvider = o.TokenProvider
+		}))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, loadOptions...)
+	if err != nil {
+		return cfg, err
+	}
+	if len(o.RoleARN) > 0 {
+		cfg.Credentials = aws.NewCredentialsCache(o.assumeRoleProvider(sts.NewFromConfig(cfg)))
+	}
+	return cfg, nil
+}
+
+// sharedConfigFiles uses the shared config and credentials files named in
+// the environment, like LoadDefaultConfig does.
+func sharedConfigFiles(so *config.LoadSharedConfigOptions) {
+	env, err := config.NewEnvConfig()
+	if err != nil {
+		return
+	}
+	if len(env.SharedConfigFile) > 0 {
+		so.ConfigFiles = []string{env.SharedConfigFile}
+	}
+	if len(env.SharedCredentialsFile) > 0 {
+		so.CredentialsFiles = []string{env.SharedCredentialsFile}
+	}
+}
+
+// assumeRoleProvider returns a provider of credentials for the role that
+// calls AssumeRole with the client.
+func (o AWSOptions) assumeRoleProvider(client stscreds.AssumeRoleAPIClient) aws.CredentialsProvider {
+	return stscreds.NewAssumeRoleProvider(client, o.RoleARN, func(ao *stscreds.AssumeRoleOptions) {
+		ao.RoleSessionName = o.SessionName
+		if len(ao.RoleSessionName) == 0 {
+			ao.RoleSessionName = fmt.Sprintf(`%v-%v`, DEFAULT_ROLE_SESSION_NAME, time.Now().Unix())
+		}
+		if o.Duration > 0 {
+			ao.Duration = o.Duration
+		}
+		if len(o.ExternalID) > 0 {
+			ao.ExternalID = aws.String(o.ExternalID)
+		}
+		if len(o.MFASerial) > 0 {
+			ao.SerialNumber = aws.String(o.MFASerial)
+			ao.TokenProvider = o.TokenProvider
+		}
+	})
+}
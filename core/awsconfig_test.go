@@ -0,0 +1,106 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// fakeSTS records the AssumeRole request and returns fixed credentials.
+type fakeSTS struct {
+	input *sts.AssumeRoleInput
+}
+
+func (f *fakeSTS) AssumeRole(ctx context.Context, in *sts.AssumeRoleInput, _ ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+	f.input = in
+	return &sts.AssumeRoleOutput{Credentials: &types.Credentials{
+		AccessKeyId:     aws.String(`ASIAROLE`),
+		SecretAccessKey: aws.String(`secret`),
+		SessionToken:    aws.String(`token`),
+		Expiration:      aws.Time(time.Now().Add(time.Hour)),
+	}}, nil
+}
+
+func TestAWSOptionsValidate(t *testing.T) {
+	token := func() (string, error) { return `123456`, nil }
+	cases := map[string]struct {
+		Options AWSOptions
+		Err     bool
+	}{
+		`Empty`:                    {AWSOptions{}, false},
+		`Profile and region`:       {AWSOptions{Profile: `prod`, Region: `us-west-2`}, false},
+		`Role`:                     {AWSOptions{RoleARN: `arn:aws:iam::111:role/k9`, ExternalID: `x`}, false},
+		`Role with MFA`:            {AWSOptions{RoleARN: `arn:aws:iam::111:role/k9`, MFASerial: `arn:aws:iam::111:mfa/u`, TokenProvider: token}, false},
+		`MFA without token`:        {AWSOptions{RoleARN: `arn:aws:iam::111:role/k9`, MFASerial: `arn:aws:iam::111:mfa/u`}, true},
+		`External ID without role`: {AWSOptions{ExternalID: `x`}, true},
+		`MFA without role`:         {AWSOptions{MFASerial: `arn:aws:iam::111:mfa/u`, TokenProvider: token}, true},
+	}
+	for l, c := range cases {
+		if err := c.Options.Validate(); (err != nil) != c.Err {
+			t.Errorf("Case: %v, unexpected error state: %v", l, err)
+		}
+	}
+}
+
+func TestAssumeRoleProvider(t *testing.T) {
+	client := &fakeSTS{}
+	o := AWSOptions{
+		RoleARN:       `arn:aws:iam::111:role/k9`,
+		ExternalID:    `ext`,
+		MFASerial:     `arn:aws:iam::111:mfa/u`,
+		TokenProvider: func() (string, error) { return `123456`, nil },
+		Duration:      30 * time.Minute,
+	}
+	creds, err := o.assumeRoleProvider(client).Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf(`unexpected error: %v`, err)
+	}
+	if creds.AccessKeyID != `ASIAROLE` || creds.SessionToken != `token` {
+		t.Errorf(`expected the role's credentials, was %v`, creds)
+	}
+	in := client.input
+	if *in.RoleArn != o.RoleARN || *in.ExternalId != `ext` || *in.SerialNumber != o.MFASerial ||
+		*in.TokenCode != `123456` || *in.DurationSeconds != 1800 {
+		t.Errorf(`unexpected AssumeRole request: %+v`, in)
+	}
+	if len(*in.RoleSessionName) <= len(DEFAULT_ROLE_SESSION_NAME) {
+		t.Errorf(`expected a generated session name, was %v`, *in.RoleSessionName)
+	}
+}
+
+func TestLoadAWSConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, `config`)
+	os.WriteFile(path, []byte("[profile prod]\nregion = eu-west-1\n"), 0600)
+	t.Setenv(`AWS_CONFIG_FILE`, path)
+	t.Setenv(`AWS_SHARED_CREDENTIALS_FILE`, filepath.Join(dir, `credentials`))
+	t.Setenv(`AWS_REGION`, ``)
+	t.Setenv(`AWS_PROFILE`, ``)
+
+	cases := map[string]struct {
+		Options  AWSOptions
+		Expected string
+		Err      bool
+	}{
+		`Profile region`:  {AWSOptions{Profile: `prod`}, `eu-west-1`, false},
+		`Region override`: {AWSOptions{Profile: `prod`, Region: `us-east-2`}, `us-east-2`, false},
+		`Unknown profile`: {AWSOptions{Profile: `missing`}, ``, true},
+		`Invalid`:         {AWSOptions{ExternalID: `x`}, ``, true},
+	}
+	for l, c := range cases {
+		cfg, err := LoadAWSConfig(context.Background(), c.Options)
+		if (err != nil) != c.Err {
+			t.Errorf("Case: %v, unexpected error state: %v", l, err)
+			continue
+		}
+		if cfg.Region != c.Expected {
+			t.Errorf("Case: %v, expected %v, but was %v", l, c.Expected, cfg.Region)
+		}
+	}
+}
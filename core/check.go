@@ -0,0 +1,151 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// database issue types
+const (
+	ISSUE_UNEXPECTED_PATH     = `unexpected-path`
+	ISSUE_UNPARSEABLE_NAME    = `unparseable-name`
+	ISSUE_MISSING_KIND        = `missing-kind`
+	ISSUE_DUPLICATE_TIMESTAMP = `duplicate-timestamp`
+	ISSUE_TRUNCATED           = `truncated`
+)
+
+// RequiredReportKinds lists the report kinds delivered with every analysis.
+// The resource access audit is optional.
+var RequiredReportKinds = []string{
+	REPORT_TYPE_PREFIX_PRINCIPALS,
+	REPORT_TYPE_PREFIX_RESOURCES,
+	REPORT_TYPE_PREFIX_PRINCIPAL_ACCESS_SUMMARIES,
+	REPORT_TYPE_PREFIX_RESOURCE_ACCESS_SUMMARIES,
+}
+
+// DBIssue describes a problem with a file or report in the local database.
+type DBIssue struct {
+	Issue        string `csv:"issue" json:"issue"`
+	CustomerID   string `csv:"customer_id" json:"customer_id,omitempty"`
+	Account      string `csv:"account" json:"account,omitempty"`
+	AnalysisDate string `csv:"analysis_date" json:"analysis_date,omitempty"`
+	Path         string `csv:"path" json:"path,omitempty"`
+	Detail       string `csv:"detail" json:"detail"`
+}
+
+// CheckLocalDB returns the issues recorded while loading the database
+// followed by any report that is missing a required kind or has a file that
+// cannot be read as a complete CSV. Issues are ordered by path.
+func CheckLocalDB(db DB) []DBIssue {
+	out := append([]DBIssue{}, db.Issues...)
+	for _, c := range db.Customers {
+		for _, a := range c.Accounts {
+			for _, r := range a.Reports {
+				out = append(out, checkReport(r)...)
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Path != out[j].Path {
+			return out[i].Path < out[j].Path
+		}
+		return out[i].Issue < out[j].Issue
+	})
+	return out
+}
+
+func checkReport(r LocalReport) []DBIssue {
+	out := []DBIssue{}
+	issue := func(kind, path, detail string) DBIssue {
+		return DBIssue{
+			Issue:        kind,
+			CustomerID:   r.CustomerID,
+			Account:      r.Account,
+			AnalysisDate: r.Timestamp.Format(FILENAME_TIMESTAMP_LAYOUT),
+			Path:         path,
+			Detail:       detail,
+		}
+	}
+
+	// missing kinds are reported against the directory of the report
+	dir := ``
+	for _, p := range r.pathByKind {
+		dir = filepath.Dir(p)
+	}
+	for _, k := range RequiredReportKinds {
+		if _, ok := r.pathByKind[k]; !ok {
+			out = append(out, issue(ISSUE_MISSING_KIND, dir, `missing `+k))
+		}
+	}
+	for k, p := range r.pathByKind {
+		// only CSV reports are parsed, other formats are keyed with their extension
+		if k != reportPathKind(k) {
+			continue
+		}
+		if err := CheckReportFile(p); err != nil {
+			out = append(out, issue(ISSUE_TRUNCATED, p, err.Error()))
+		}
+	}
+	return out
+}
+
+// CheckReportFile reads a report file to the end and returns an error if it
+// is empty, cannot be decompressed, or ends with an incomplete record.
+func CheckReportFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	in, err := decompressingReader(f)
+	if err != nil {
+		return err
+	}
+	rr := csv.NewReader(in)
+	rows := 0
+	for {
+		_, err = rr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		rows++
+	}
+	if rows == 0 {
+		return fmt.Errorf(`empty report, no header row`)
+	}
+	return nil
+}
+
+// reportFileTime parses the analysis time from a report file name.
+func reportFileTime(path string) (time.Time, error) {
+	parts := strings.Split(trimCompressionExtension(filepath.Base(path)), `.`)
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf(`invalid report filename, invalid filename structure`)
+	}
+	return time.Parse(FILENAME_TIMESTAMP_LAYOUT, parts[1])
+}
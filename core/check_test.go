@@ -0,0 +1,72 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckLocalDB(t *testing.T) {
+	home := t.TempDir()
+	dir := `customers/C1/reports/aws/111/2022/05/`
+	files := map[string]string{
+		dir + `principals.2022-05-01-0714.csv`:                 "a,b\n1,2\n",
+		dir + `resources.2022-05-01-0714.csv`:                  "a,b\n1,2\n",
+		dir + `principal-access-summaries.2022-05-01-0714.csv`: "a,b\n1,2\n",
+		dir + `resource-access-summaries.2022-05-01-0714.csv`:  "a,b\n1,2\n1",
+		dir + `principals.2022-05-02-0714.csv`:                 "",
+		dir + `principals.2022-05-02-0714.csv.gz`:              "",
+		dir + `resources.2022-05-02-0714.csv`:                  "a,b\n1,2\n",
+		dir + `principals.2022-05-01-1830.csv`:                 "a,b\n1,2\n",
+		dir + `resources.2022-05-01-1830.csv`:                  "a,b\n1,2\n",
+		dir + `principal-access-summaries.2022-05-01-1830.csv`: "a,b\n1,2\n",
+		dir + `resource-access-summaries.2022-05-01-1830.csv`:  "a,b\n1,2\n",
+		dir + `principals.2022-05-01-1830.xlsx`:                "PK\x03\x04\"x\"y",
+		dir + `notes.txt`:                                      "notes",
+		`customers/C1/stray.csv`:                               "a,b\n",
+		`README.md`:                                            "ignored outside the report tree",
+		dir + `.k9-manifest.json`:                              "{}",
+	}
+	for k, v := range files {
+		p := localPath(home, k)
+		if err := os.MkdirAll(filepath.Dir(p), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(v), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := LoadLocalDB(home)
+	if err != nil {
+		t.Fatalf(`expected stray files not to fail loading, was %v`, err)
+	}
+	if len(db.Issues) != 3 {
+		t.Errorf(`expected 3 load issues, was %v`, db.Issues)
+	}
+
+	// an xlsx copy is neither a duplicate nor a stand-in for the CSV
+	analysis, _ := time.Parse(FILENAME_TIMESTAMP_LAYOUT, `2022-05-01-1830`)
+	report := db.Customers[`C1`].Accounts[`111`].Reports[analysis]
+	if p, _ := report.Path(REPORT_TYPE_PREFIX_PRINCIPALS); filepath.Ext(p) != `.csv` {
+		t.Errorf(`expected the principals CSV to be kept, was %v`, p)
+	}
+
+	counts := map[string]int{}
+	for _, i := range CheckLocalDB(db) {
+		counts[i.Issue]++
+	}
+	expected := map[string]int{
+		ISSUE_UNEXPECTED_PATH:     1,
+		ISSUE_UNPARSEABLE_NAME:    1,
+		ISSUE_MISSING_KIND:        2,
+		ISSUE_DUPLICATE_TIMESTAMP: 1,
+		ISSUE_TRUNCATED:           2,
+	}
+	for k, v := range expected {
+		if counts[k] != v {
+			t.Errorf("Case: %v, expected %v, but was %v", k, v, counts[k])
+		}
+	}
+}
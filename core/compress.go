@@ -0,0 +1,121 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	COMPRESSION_NONE = `none`
+	COMPRESSION_GZIP = `gzip`
+	COMPRESSION_ZSTD = `zstd`
+
+	EXT_GZ  = `gz`
+	EXT_ZST = `zst`
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// CompressionExtension returns the filename extension, without the leading
+// dot, used for reports stored with the named compression. The extension is
+// empty for uncompressed reports.
+func CompressionExtension(compression string) (string, error) {
+	switch compression {
+	case ``, COMPRESSION_NONE:
+		return ``, nil
+	case COMPRESSION_GZIP:
+		return EXT_GZ, nil
+	case COMPRESSION_ZSTD:
+		return EXT_ZST, nil
+	default:
+		return ``, &IllegalArgumentError{`compression`, `unknown compression ` + compression}
+	}
+}
+
+// trimCompressionExtension removes a known compression extension from a
+// report filename.
+func trimCompressionExtension(name string) string {
+	for _, ext := range []string{EXT_GZ, EXT_ZST} {
+		if strings.HasSuffix(name, `.`+ext) {
+			return strings.TrimSuffix(name, `.`+ext)
+		}
+	}
+	return name
+}
+
+// decompressingReader detects gzip and zstd content by its magic number
+// and returns a Reader of the decompressed content. Other content is
+// returned unchanged.
+func decompressingReader(in io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(in)
+	head, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(head, zstdMagic):
+		// a single goroutine decodes synchronously, so the decoder holds no
+		// resources that need to be released by the caller
+		zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return zr, nil
+	default:
+		return br, nil
+	}
+}
+
+// compressTo writes the content of in to o with the named compression.
+func compressTo(o io.Writer, in io.Reader, compression string) error {
+	switch compression {
+	case COMPRESSION_GZIP:
+		zw := gzip.NewWriter(o)
+		if _, err := io.Copy(zw, in); err != nil {
+			return err
+		}
+		return zw.Close()
+	case COMPRESSION_ZSTD:
+		zw, err := zstd.NewWriter(o)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(zw, in); err != nil {
+			zw.Close()
+			return err
+		}
+		return zw.Close()
+	case ``, COMPRESSION_NONE:
+		_, err := io.Copy(o, in)
+		return err
+	default:
+		_, err := CompressionExtension(compression)
+		return err
+	}
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// rowCollector keeps the first column of every collected record.
+type rowCollector struct {
+	rows []string
+}
+
+func (r *rowCollector) Collect(in []string) error {
+	r.rows = append(r.rows, in[0])
+	return nil
+}
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	if _, err := zw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zstdBytes(t *testing.T, b []byte) []byte {
+	buf := &bytes.Buffer{}
+	if err := compressTo(buf, bytes.NewReader(b), COMPRESSION_ZSTD); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLoadReportCompressed(t *testing.T) {
+	plain := []byte("header\na\nb\n")
+	cases := map[string]struct {
+		Input       []byte
+		Expected    int
+		ExpectedErr bool
+	}{
+		`Plain`:          {plain, 2, false},
+		`Gzip`:           {gzipBytes(t, plain), 2, false},
+		`Zstd`:           {zstdBytes(t, plain), 2, false},
+		`Corrupt zstd`:   {append([]byte{0x28, 0xb5, 0x2f, 0xfd}, plain...), 0, true},
+		`Truncated gzip`: {gzipBytes(t, plain)[:8], 0, true},
+		`Empty`:          {[]byte{}, 0, false},
+	}
+	for l, c := range cases {
+		r := &rowCollector{}
+		err := LoadReport(bytes.NewReader(c.Input), r)
+		if (err != nil) != c.ExpectedErr {
+			t.Errorf("Case: %v, expected error %v, but was %v", l, c.ExpectedErr, err)
+			continue
+		}
+		if len(r.rows) != c.Expected {
+			t.Errorf("Case: %v, expected %v rows, but was %v", l, c.Expected, r.rows)
+		}
+	}
+}
+
+func TestLoadLocalDBCompressed(t *testing.T) {
+	key := `customers/C1/reports/aws/111/2022/05/principals.2022-05-01-0714.csv`
+	cases := map[string]struct {
+		Ext     string
+		Content []byte
+	}{
+		`Gzip`: {EXT_GZ, gzipBytes(t, []byte("header\na\n"))},
+		`Zstd`: {EXT_ZST, zstdBytes(t, []byte("header\na\n"))},
+	}
+	for l, c := range cases {
+		home := t.TempDir()
+		path := localReportPath(home, key, c.Ext)
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, c.Content, 0640); err != nil {
+			t.Fatal(err)
+		}
+		db, err := LoadLocalDB(home)
+		if err != nil {
+			t.Errorf("Case: %v, unexpected error: %v", l, err)
+			continue
+		}
+		o := db.GetPathForCustomerAccountTimeKind(`C1`, `111`, nil, REPORT_TYPE_PREFIX_PRINCIPALS)
+		if o == nil || *o != path {
+			t.Errorf("Case: %v, expected %v, but was %v", l, path, o)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"strings"
+	"time"
+)
+
+// credential kinds of a principal
+const (
+	CREDENTIAL_PASSWORD     = `password`
+	CREDENTIAL_ACCESS_KEY_1 = `access_key_1`
+	CREDENTIAL_ACCESS_KEY_2 = `access_key_2`
+)
+
+// credential hygiene findings
+const (
+	CREDENTIAL_STATUS_OK       = `ok`
+	CREDENTIAL_STATUS_NONE     = `none`
+	CREDENTIAL_STATUS_INACTIVE = `inactive`
+	CREDENTIAL_STATUS_UNUSED   = `unused`
+	CREDENTIAL_STATUS_STALE    = `stale`
+)
+
+// reportTimeLayouts are the timestamp formats used by report columns other
+// than the analysis time.
+var reportTimeLayouts = []string{
+	time.RFC3339Nano,
+	`2006-01-02 15:04:05Z07:00`,
+	`2006-01-02 15:04:05.999999Z07:00`,
+	`2006-01-02`,
+}
+
+// ParseReportTime parses a timestamp column of a report. Empty values and
+// placeholders like N/A result in false.
+func ParseReportTime(s string) (time.Time, bool) {
+	for _, l := range reportTimeLayouts {
+		if t, err := time.Parse(l, strings.TrimSpace(s)); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// CredentialStatus describes the hygiene of a single credential.
+type CredentialStatus struct {
+	Credential  string `csv:"credential" json:"credential"`
+	State       string `csv:"state" json:"state"`
+	LastUsed    string `csv:"last_used" json:"last_used"`
+	LastRotated string `csv:"last_rotated" json:"last_rotated"`
+	Status      string `csv:"status" json:"status"`
+}
+
+// CredentialPolicy sets the limits for credential hygiene. A credential
+// rotated more than MaxAge ago is stale and an active credential not used
+// within MaxIdle is unused. A zero limit is not enforced.
+type CredentialPolicy struct {
+	MaxAge  time.Duration
+	MaxIdle time.Duration
+}
+
+// Evaluate returns the status of the password and each access key of the
+// principal as of the provided time.
+func (p CredentialPolicy) Evaluate(i PrincipalsReportItem, at time.Time) []CredentialStatus {
+	return []CredentialStatus{
+		p.evaluate(CREDENTIAL_PASSWORD, i.PasswordState, i.PasswordLastUsed, i.PasswordLastRotated, at),
+		p.evaluate(CREDENTIAL_ACCESS_KEY_1, i.AccessKey1State, i.AccessKey1LastUsed, i.AccessKey1LastRotated, at),
+		p.evaluate(CREDENTIAL_ACCESS_KEY_2, i.AccessKey2State, i.AccessKey2LastUsed, i.AccessKey2LastRotated, at),
+	}
+}
+
+func (p CredentialPolicy) evaluate(credential, state, lastUsed, lastRotated string, at time.Time) CredentialStatus {
+	out := CredentialStatus{
+		Credential:  credential,
+		State:       state,
+		LastUsed:    lastUsed,
+		LastRotated: lastRotated,
+		Status:      CREDENTIAL_STATUS_OK,
+	}
+	rotated, hasRotated := ParseReportTime(lastRotated)
+	used, hasUsed := ParseReportTime(lastUsed)
+	switch strings.ToLower(state) {
+	case ``, `n/a`, `not_supported`:
+		if !hasRotated && !hasUsed {
+			out.Status = CREDENTIAL_STATUS_NONE
+			return out
+		}
+	case `inactive`, `disabled`:
+		out.Status = CREDENTIAL_STATUS_INACTIVE
+		return out
+	}
+	if p.MaxAge > 0 && hasRotated && at.Sub(rotated) > p.MaxAge {
+		out.Status = CREDENTIAL_STATUS_STALE
+	} else if p.MaxIdle > 0 && (!hasUsed || at.Sub(used) > p.MaxIdle) {
+		out.Status = CREDENTIAL_STATUS_UNUSED
+	}
+	return out
+}
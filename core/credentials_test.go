@@ -0,0 +1,38 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCredentialPolicyEvaluate(t *testing.T) {
+	at := time.Date(2022, time.May, 1, 0, 0, 0, 0, time.UTC)
+	policy := CredentialPolicy{MaxAge: 365 * 24 * time.Hour, MaxIdle: 90 * 24 * time.Hour}
+
+	cases := map[string]struct {
+		State, LastUsed, LastRotated string
+		Expected                     string
+	}{
+		`No credential`:    {``, ``, ``, CREDENTIAL_STATUS_NONE},
+		`Not supported`:    {`not_supported`, ``, ``, CREDENTIAL_STATUS_NONE},
+		`Inactive`:         {`Inactive`, ``, `2020-01-01T00:00:00+00:00`, CREDENTIAL_STATUS_INACTIVE},
+		`Healthy`:          {`Active`, `2022-04-28 10:00:00+00:00`, `2022-01-01T00:00:00+00:00`, CREDENTIAL_STATUS_OK},
+		`Stale`:            {`Active`, `2022-04-28T10:00:00+00:00`, `2021-01-01T00:00:00+00:00`, CREDENTIAL_STATUS_STALE},
+		`Unused`:           {`Active`, `2021-12-01T00:00:00+00:00`, `2021-11-01T00:00:00+00:00`, CREDENTIAL_STATUS_UNUSED},
+		`Never used`:       {`Active`, `N/A`, `2022-04-01T00:00:00+00:00`, CREDENTIAL_STATUS_UNUSED},
+		`Fractional times`: {`Active`, `2022-04-28T10:00:00.000000+00:00`, `2022-01-01T00:00:00.000000+00:00`, CREDENTIAL_STATUS_OK},
+	}
+	for l, c := range cases {
+		o := policy.Evaluate(PrincipalsReportItem{AccessKey1State: c.State, AccessKey1LastUsed: c.LastUsed, AccessKey1LastRotated: c.LastRotated}, at)
+		if o[1].Credential != CREDENTIAL_ACCESS_KEY_1 || o[1].Status != c.Expected {
+			t.Errorf("Case: %v, expected %v, but was %v", l, c.Expected, o[1].Status)
+		}
+		if o[0].Status != CREDENTIAL_STATUS_NONE {
+			t.Errorf("Case: %v, expected no password, but was %v", l, o[0].Status)
+		}
+	}
+
+	if o := (CredentialPolicy{}).Evaluate(PrincipalsReportItem{PasswordState: `Enabled`, PasswordLastRotated: `2010-01-01`}, at); o[0].Status != CREDENTIAL_STATUS_OK {
+		t.Errorf("Case: no limits, expected %v, but was %v", CREDENTIAL_STATUS_OK, o[0].Status)
+	}
+}
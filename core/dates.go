@@ -0,0 +1,141 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// date expression keywords
+const (
+	DATE_EXPRESSION_LATEST    = `latest`
+	DATE_EXPRESSION_PREVIOUS  = `previous`
+	DATE_EXPRESSION_TODAY     = `today`
+	DATE_EXPRESSION_YESTERDAY = `yesterday`
+	DATE_EXPRESSION_LAST      = `last-`
+)
+
+// DATE_EXPRESSION_HELP summarizes the accepted date expressions for flag
+// descriptions.
+const DATE_EXPRESSION_HELP = `YYYY-MM-DD, YYYY-MM-DD-HHMM, YYYY-Www, latest, previous, today, yesterday, -7d, -2w, -1m, -1y, or last-monday`
+
+var (
+	relativeDatePattern = regexp.MustCompile(`^-(\d+)([dwmy])$`)
+	isoWeekPattern      = regexp.MustCompile(`^(\d{4})-?W(\d{2})$`)
+)
+
+// now is replaced in tests to evaluate relative expressions at a fixed time.
+var now = time.Now
+
+// ParseAnalysisDate parses a date expression relative to the current time.
+// An empty string results in a nil AnalysisDate, meaning the latest report.
+func ParseAnalysisDate(s string) (*AnalysisDate, error) {
+	return ParseDateExpression(s, now())
+}
+
+// ParseDateExpression parses an absolute or relative date expression
+// evaluated at the provided time, in UTC. The accepted expressions are:
+//
+//   - YYYY-MM-DD, a day, and YYYY-MM-DD-HHMM, a single analysis
+//   - YYYY-Www, an ISO week such as 2022-W18
+//   - latest and previous, the most recent report and the one before it
+//   - today and yesterday
+//   - -Nd, -Nw, -Nm, and -Ny, the day N days, weeks, months, or years ago
+//   - last-<weekday>, the most recent such day before today
+//
+// An empty string results in a nil AnalysisDate.
+func ParseDateExpression(s string, at time.Time) (*AnalysisDate, error) {
+	expr := strings.ToLower(strings.TrimSpace(s))
+	if len(expr) <= 0 {
+		return nil, nil
+	}
+	today := at.UTC().Truncate(24 * time.Hour)
+
+	switch expr {
+	case DATE_EXPRESSION_LATEST:
+		return &AnalysisDate{Latest: true}, nil
+	case DATE_EXPRESSION_PREVIOUS:
+		return &AnalysisDate{Latest: true, Back: 1}, nil
+	case DATE_EXPRESSION_TODAY:
+		return &AnalysisDate{Time: today}, nil
+	case DATE_EXPRESSION_YESTERDAY:
+		return &AnalysisDate{Time: today.AddDate(0, 0, -1)}, nil
+	}
+
+	if t, err := time.Parse(FILENAME_TIMESTAMP_LAYOUT, expr); err == nil {
+		return &AnalysisDate{Time: t, HasTime: true}, nil
+	}
+	if t, err := time.Parse(FILENAME_TIMESTAMP_ANALYSIS_DATE_LAYOUT, expr); err == nil {
+		return &AnalysisDate{Time: t}, nil
+	}
+
+	if m := relativeDatePattern.FindStringSubmatch(expr); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		switch m[2] {
+		case `d`:
+			return &AnalysisDate{Time: today.AddDate(0, 0, -n)}, nil
+		case `w`:
+			return &AnalysisDate{Time: today.AddDate(0, 0, -7*n)}, nil
+		case `m`:
+			return &AnalysisDate{Time: today.AddDate(0, -n, 0)}, nil
+		case `y`:
+			return &AnalysisDate{Time: today.AddDate(-n, 0, 0)}, nil
+		}
+	}
+
+	if m := isoWeekPattern.FindStringSubmatch(strings.ToUpper(expr)); m != nil {
+		year, _ := strconv.Atoi(m[1])
+		week, _ := strconv.Atoi(m[2])
+		monday, err := isoWeekStart(year, week)
+		if err != nil {
+			return nil, err
+		}
+		return &AnalysisDate{Time: monday, Days: 7}, nil
+	}
+
+	if strings.HasPrefix(expr, DATE_EXPRESSION_LAST) {
+		name := strings.TrimPrefix(expr, DATE_EXPRESSION_LAST)
+		for wd := time.Sunday; wd <= time.Saturday; wd++ {
+			if strings.ToLower(wd.String()) != name {
+				continue
+			}
+			back := (int(today.Weekday()) - int(wd) + 7) % 7
+			if back == 0 {
+				back = 7
+			}
+			return &AnalysisDate{Time: today.AddDate(0, 0, -back)}, nil
+		}
+	}
+
+	return nil, &IllegalArgumentError{`date`, fmt.Sprintf(`expected %v, was %v`, DATE_EXPRESSION_HELP, s)}
+}
+
+// isoWeekStart returns the Monday that starts the ISO week of the year.
+func isoWeekStart(year, week int) (time.Time, error) {
+	// January 4th is always in the first ISO week
+	jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)
+	offset := (int(jan4.Weekday()) + 6) % 7
+	monday := jan4.AddDate(0, 0, -offset+7*(week-1))
+	if y, w := monday.ISOWeek(); week < 1 || y != year || w != week {
+		return time.Time{}, &IllegalArgumentError{`date`, fmt.Sprintf(`no week %v in %v`, week, year)}
+	}
+	return monday, nil
+}
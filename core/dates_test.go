@@ -0,0 +1,97 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDateExpression(t *testing.T) {
+	// a Wednesday
+	at := time.Date(2022, time.May, 4, 15, 30, 0, 0, time.UTC)
+
+	cases := map[string]struct {
+		Input    string
+		Expected string
+		First    string
+		Last     string
+	}{
+		`Day`:                    {`2022-05-01`, `2022-05-01`, `2022-05-01-0000`, `2022-05-01-2359`},
+		`Timestamp`:              {`2022-05-01-0714`, `2022-05-01-0714`, `2022-05-01-0714`, `2022-05-01-0714`},
+		`Today`:                  {`today`, `2022-05-04`, `2022-05-04-0000`, `2022-05-04-2359`},
+		`Yesterday`:              {`yesterday`, `2022-05-03`, `2022-05-03-0000`, `2022-05-03-2359`},
+		`Days ago`:               {`-7d`, `2022-04-27`, `2022-04-27-0000`, `2022-04-27-2359`},
+		`Weeks ago`:              {`-2w`, `2022-04-20`, `2022-04-20-0000`, `2022-04-20-2359`},
+		`Months ago`:             {`-1m`, `2022-04-04`, `2022-04-04-0000`, `2022-04-04-2359`},
+		`Years ago`:              {`-1y`, `2021-05-04`, `2021-05-04-0000`, `2021-05-04-2359`},
+		`Last monday`:            {`last-monday`, `2022-05-02`, `2022-05-02-0000`, `2022-05-02-2359`},
+		`Last same weekday`:      {`last-wednesday`, `2022-04-27`, `2022-04-27-0000`, `2022-04-27-2359`},
+		`Mixed case`:             {`Last-Friday`, `2022-04-29`, `2022-04-29-0000`, `2022-04-29-2359`},
+		`ISO week`:               {`2022-W18`, `2022-W18`, `2022-05-02-0000`, `2022-05-08-2359`},
+		`ISO week lowercase`:     {`2022-w01`, `2022-W01`, `2022-01-03-0000`, `2022-01-09-2359`},
+		`ISO week of prior year`: {`2021-W01`, `2021-W01`, `2021-01-04-0000`, `2021-01-10-2359`},
+	}
+	for l, c := range cases {
+		d, err := ParseDateExpression(c.Input, at)
+		if err != nil {
+			t.Errorf("Case: %v, unexpected error: %v", l, err)
+			continue
+		}
+		if o := d.String(); o != c.Expected {
+			t.Errorf("Case: %v, expected %v, but was %v", l, c.Expected, o)
+		}
+		first, last := d.Range()
+		if o := first.Format(FILENAME_TIMESTAMP_LAYOUT); o != c.First {
+			t.Errorf("Case: %v, expected first %v, but was %v", l, c.First, o)
+		}
+		if o := last.Format(FILENAME_TIMESTAMP_LAYOUT); o != c.Last {
+			t.Errorf("Case: %v, expected last %v, but was %v", l, c.Last, o)
+		}
+	}
+
+	for _, in := range []string{`2022-05`, `-7`, `-7h`, `last-week`, `2022-W54`, `2022-W00`, `earlier`} {
+		if _, err := ParseDateExpression(in, at); err == nil {
+			t.Errorf("Case: %v, expected an error", in)
+		}
+	}
+	if d, err := ParseDateExpression(``, at); d != nil || err != nil {
+		t.Errorf("Case: empty, expected nil, but was %v, %v", d, err)
+	}
+}
+
+func TestDateExpressionReport(t *testing.T) {
+	db := testDB(`2022-05-01-0714`, `2022-05-01-1830`, `2022-05-04-0900`, `2022-05-10-0900`)
+	account := db.Customers[`C1`].Accounts[`111`]
+
+	// evaluate relative expressions on the Wednesday after the last report
+	defer func(previous func() time.Time) { now = previous }(now)
+	now = func() time.Time { return time.Date(2022, time.May, 11, 8, 0, 0, 0, time.UTC) }
+
+	cases := map[string]struct {
+		Input    string
+		Expected string
+	}{
+		`Latest`:          {`latest`, `2022-05-10-0900`},
+		`Previous`:        {`previous`, `2022-05-04-0900`},
+		`Latest in week`:  {`2022-W18`, `2022-05-04-0900`},
+		`Week before any`: {`2022-W16`, ``},
+		`Yesterday`:       {`yesterday`, `2022-05-10-0900`},
+		`Week ago`:        {`-7d`, `2022-05-04-0900`},
+		`Today`:           {`today`, ``},
+	}
+	for l, c := range cases {
+		d, err := ParseAnalysisDate(c.Input)
+		if err != nil {
+			t.Errorf("Case: %v, unexpected error: %v", l, err)
+			continue
+		}
+		r, ok := d.Report(account)
+		if o := r.Timestamp.Format(FILENAME_TIMESTAMP_LAYOUT); ok != (len(c.Expected) > 0) || (ok && o != c.Expected) {
+			t.Errorf("Case: %v, expected %v, but was %v, %v", l, c.Expected, o, ok)
+		}
+	}
+
+	single := testDB(`2022-05-01-0714`).Customers[`C1`].Accounts[`111`]
+	if _, ok := (&AnalysisDate{Latest: true, Back: 1}).Report(single); ok {
+		t.Errorf(`expected no previous report for a single analysis`)
+	}
+}
@@ -22,14 +22,21 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
-
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
 type DB struct {
 	Customers map[string]Customer
+
+	// Objects holds remote object metadata indexed by key. It is only
+	// populated for databases loaded from a ReportStore.
+	Objects map[string]ObjectInfo
+
+	// Issues lists the files that were skipped while loading a local
+	// database because they are not recognizable reports.
+	Issues []DBIssue
 }
 
 func (db *DB) Dump(o io.Writer, isSummary bool) {
@@ -66,26 +73,161 @@ func (db *DB) Sizes() (total int, accounts int, customers int) {
 	return
 }
 
-func (db *DB) GetPathForCustomerAccountTimeKind(customerID, accountID string, ts *time.Time, kind string) *string {
-	var (
-		customer Customer
-		account  Account
-		report   LocalReport
-		path     string
-		ok       bool
-	)
-	if customer, ok = db.Customers[customerID]; !ok {
-		return nil
+// analysis date resolution modes
+const (
+	// RESOLUTION_EXACT selects the report of the exact analysis time, or the
+	// latest report on the day of a date.
+	RESOLUTION_EXACT = `exact`
+	// RESOLUTION_AS_OF selects the most recent report on or before the
+	// analysis time, or on or before the end of the day of a date.
+	RESOLUTION_AS_OF = `as-of`
+	// RESOLUTION_NEAREST selects the report closest to the analysis time, or
+	// to the day of a date, preferring the earlier report on a tie.
+	RESOLUTION_NEAREST = `nearest`
+)
+
+// AnalysisDate selects a report of an account by the time of its analysis.
+// When HasTime is set Time identifies an analysis to the minute, otherwise
+// the Days starting on the day of Time are significant, a single day when
+// Days is zero. When Latest is set the report Back reports before the most
+// recent one is selected instead. Resolution is one of the RESOLUTION_
+// modes, the zero value is RESOLUTION_EXACT.
+type AnalysisDate struct {
+	Time       time.Time
+	HasTime    bool
+	Days       int
+	Latest     bool
+	Back       int
+	Resolution string
+}
+
+func (d AnalysisDate) String() string {
+	switch {
+	case d.Latest && d.Back == 0:
+		return DATE_EXPRESSION_LATEST
+	case d.Latest && d.Back == 1:
+		return DATE_EXPRESSION_PREVIOUS
+	case d.Latest:
+		return fmt.Sprintf(`%v~%v`, DATE_EXPRESSION_LATEST, d.Back)
+	case d.HasTime:
+		return d.Time.Format(FILENAME_TIMESTAMP_LAYOUT)
+	case d.Days == 7 && d.Time.Weekday() == time.Monday:
+		y, w := d.Time.ISOWeek()
+		return fmt.Sprintf(`%d-W%02d`, y, w)
 	}
-	if account, ok = customer.Accounts[accountID]; !ok {
-		return nil
+	return d.Time.Format(FILENAME_TIMESTAMP_ANALYSIS_DATE_LAYOUT)
+}
+
+// Range returns the first and last instant matched exactly by the date.
+func (d AnalysisDate) Range() (time.Time, time.Time) {
+	if d.HasTime {
+		t := d.Time.Truncate(time.Minute)
+		return t, t
+	}
+	days := d.Days
+	if days < 1 {
+		days = 1
+	}
+	day := d.Time.Truncate(24 * time.Hour)
+	return day, day.AddDate(0, 0, days).Add(-time.Nanosecond)
+}
+
+// Report returns the report of the account selected by the AnalysisDate.
+// A nil AnalysisDate selects the latest report.
+func (d *AnalysisDate) Report(a Account) (LocalReport, bool) {
+	reports := ReportFilter{}.Selects(a.Reports)
+	if len(reports) <= 0 {
+		return LocalReport{}, false
+	}
+	if d == nil {
+		return reports[len(reports)-1], true
+	}
+	if d.Latest {
+		if d.Back < 0 || d.Back >= len(reports) {
+			return LocalReport{}, false
+		}
+		return reports[len(reports)-1-d.Back], true
+	}
+
+	first, last := d.Range()
+	// the latest report matching exactly, or the latest before it
+	var match, before, after *LocalReport
+	for i := range reports {
+		t := reports[i].Timestamp
+		switch {
+		case t.Before(first):
+			before = &reports[i]
+		case !t.After(last):
+			match = &reports[i]
+		case after == nil:
+			after = &reports[i]
+		}
+	}
+	if match != nil {
+		return *match, true
+	}
+	switch d.Resolution {
+	case RESOLUTION_AS_OF:
+		if before != nil {
+			return *before, true
+		}
+	case RESOLUTION_NEAREST:
+		switch {
+		case before == nil && after != nil:
+			return *after, true
+		case after == nil && before != nil:
+			return *before, true
+		case before != nil && after != nil:
+			if after.Timestamp.Sub(last) < first.Sub(before.Timestamp) {
+				return *after, true
+			}
+			return *before, true
+		}
+	}
+	return LocalReport{}, false
+}
+
+// ReportMetadata describes the report chosen for a requested analysis date.
+type ReportMetadata struct {
+	CustomerID    string `json:"customer_id"`
+	Account       string `json:"account"`
+	RequestedDate string `json:"requested_date,omitempty"`
+	Resolution    string `json:"resolution"`
+	AnalysisTime  string `json:"analysis_time"`
+}
+
+// ResolveReport returns the report of the account selected by the analysis
+// date, along with a description of the choice.
+func (db *DB) ResolveReport(customerID, accountID string, date *AnalysisDate) (LocalReport, ReportMetadata, bool) {
+	meta := ReportMetadata{CustomerID: customerID, Account: accountID, Resolution: RESOLUTION_EXACT}
+	if date != nil {
+		meta.RequestedDate = date.String()
+		if len(date.Resolution) > 0 {
+			meta.Resolution = date.Resolution
+		}
 	}
-	if ts == nil {
-		report = account.Latest()
-	} else if report, ok = account.Reports[ts.Truncate(24*time.Hour)]; !ok {
+	customer, ok := db.Customers[customerID]
+	if !ok {
+		return LocalReport{}, meta, false
+	}
+	account, ok := customer.Accounts[accountID]
+	if !ok {
+		return LocalReport{}, meta, false
+	}
+	report, ok := date.Report(account)
+	if ok {
+		meta.AnalysisTime = report.Timestamp.Format(FILENAME_TIMESTAMP_LAYOUT)
+	}
+	return report, meta, ok
+}
+
+func (db *DB) GetPathForCustomerAccountTimeKind(customerID, accountID string, date *AnalysisDate, kind string) *string {
+	report, _, ok := db.ResolveReport(customerID, accountID, date)
+	if !ok {
 		return nil
 	}
-	if path, ok = report.pathByKind[kind]; !ok {
+	path, ok := report.pathByKind[kind]
+	if !ok {
 		return nil
 	}
 	return &path
@@ -106,6 +248,60 @@ func (db *DB) AllPaths() []string {
 }
 
 func (db *DB) AllPathsByCustomerAccount(customerID, accountID string) []string {
+	return db.PathsByCustomerAccount(customerID, accountID, ReportFilter{})
+}
+
+// ReportFilter narrows the set of reports selected for an account. The zero
+// value selects every report.
+type ReportFilter struct {
+	// Since and Until bound the report dates, inclusive of both days.
+	Since, Until *time.Time
+	// Latest, when greater than zero, selects only that many of the most
+	// recent reports remaining after the date bounds are applied.
+	Latest int
+	// Kinds restricts the selection to the named report kinds, e.g.
+	// REPORT_TYPE_PREFIX_PRINCIPALS.
+	Kinds []string
+}
+
+// Selects returns the subset of the provided reports matching the filter's
+// date and recency criteria, ordered from oldest to newest.
+func (f ReportFilter) Selects(reports map[time.Time]LocalReport) []LocalReport {
+	out := []LocalReport{}
+	for t, r := range reports {
+		if f.Since != nil && t.Before(f.Since.Truncate(24*time.Hour)) {
+			continue
+		}
+		if f.Until != nil && !t.Before(f.Until.Truncate(24*time.Hour).Add(24*time.Hour)) {
+			continue
+		}
+		out = append(out, r)
+	}
+	sort.Slice(out, func(p, q int) bool {
+		return out[p].Timestamp.Before(out[q].Timestamp)
+	})
+	if f.Latest > 0 && len(out) > f.Latest {
+		out = out[len(out)-f.Latest:]
+	}
+	return out
+}
+
+// SelectsKind reports whether the filter includes the named report kind.
+func (f ReportFilter) SelectsKind(kind string) bool {
+	if len(f.Kinds) <= 0 {
+		return true
+	}
+	for _, k := range f.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// PathsByCustomerAccount returns the paths of all reports for the specified
+// account that are selected by the provided filter.
+func (db *DB) PathsByCustomerAccount(customerID, accountID string, filter ReportFilter) []string {
 	out := []string{}
 	for _, c := range db.Customers {
 		if c.CustomerID != customerID {
@@ -115,9 +311,11 @@ func (db *DB) AllPathsByCustomerAccount(customerID, accountID string) []string {
 			if a.AccountID != accountID {
 				continue
 			}
-			for _, r := range a.Reports {
-				for _, p := range r.pathByKind {
-					out = append(out, p)
+			for _, r := range filter.Selects(a.Reports) {
+				for k, p := range r.pathByKind {
+					if filter.SelectsKind(reportPathKind(k)) {
+						out = append(out, p)
+					}
 				}
 			}
 		}
@@ -125,6 +323,28 @@ func (db *DB) AllPathsByCustomerAccount(customerID, accountID string) []string {
 	return out
 }
 
+// AccountKeys lists the accounts in the database for the specified customer,
+// or for every customer when customerID is empty, ordered by customer and
+// account.
+func (db *DB) AccountKeys(customerID string) []AccountKey {
+	out := []AccountKey{}
+	for _, c := range db.Customers {
+		if len(customerID) > 0 && c.CustomerID != customerID {
+			continue
+		}
+		for _, a := range c.Accounts {
+			out = append(out, AccountKey{CustomerID: c.CustomerID, Account: a.AccountID})
+		}
+	}
+	sort.Slice(out, func(p, q int) bool {
+		if out[p].CustomerID != out[q].CustomerID {
+			return out[p].CustomerID < out[q].CustomerID
+		}
+		return out[p].Account < out[q].Account
+	})
+	return out
+}
+
 type Customer struct {
 	CustomerID string
 	Accounts   map[string]Account
@@ -132,7 +352,9 @@ type Customer struct {
 
 type Account struct {
 	AccountID string
-	Reports   map[time.Time]LocalReport
+	// Reports are keyed by the analysis time parsed from the report file
+	// names, so that every analysis on a day is retained.
+	Reports map[time.Time]LocalReport
 }
 
 func (a *Account) Latest() LocalReport {
@@ -154,6 +376,28 @@ type LocalReport struct {
 	pathByKind map[string]string
 }
 
+// reportPathKey returns the key of a report file in LocalReport.pathByKind.
+// CSV files, which the queries read, are keyed by their kind alone. Other
+// formats such as xlsx are keyed by kind and extension so that they never
+// stand in for the CSV.
+func reportPathKey(kind, ext string) string {
+	if ext == EXT_CSV {
+		return kind
+	}
+	return kind + `.` + ext
+}
+
+// reportPathKind returns the report kind of a LocalReport.pathByKind key.
+func reportPathKind(key string) string {
+	return strings.SplitN(key, `.`, 2)[0]
+}
+
+// Path returns the local path of the report of the specified kind.
+func (r LocalReport) Path(kind string) (string, bool) {
+	p, ok := r.pathByKind[kind]
+	return p, ok
+}
+
 func LoadLocalDB(root string) (DB, error) {
 	out := DB{Customers: map[string]Customer{}}
 	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
@@ -164,85 +408,87 @@ func LoadLocalDB(root string) (DB, error) {
 
 type ReportTypeSelector []string
 
-// LoadS3DB enumerates and pulls metadata for all customers, accounts, and reports in
-// the specified S3 bucket. It does however, skip unknown report types.
-func LoadS3DB(client s3.ListObjectsV2APIClient, bucket string, selector ReportTypeSelector) (DB, error) {
-	out := DB{Customers: map[string]Customer{}}
-	pages := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{Bucket: &bucket})
-	for pages.HasMorePages() {
-		resp, err := pages.NextPage(context.TODO())
-		if err != nil {
-			return out, err
-		}
-
-		for _, v := range resp.Contents {
-			isSelected := false
-			for _, t := range selector {
-				if !isSelected && strings.HasSuffix(*v.Key, t) {
-					isSelected = true
-				}
-			}
-			if !isSelected {
-				continue
+// LoadStoreDB enumerates and pulls metadata for all customers, accounts, and
+// reports in the specified store. It does however, skip unknown report types.
+func LoadStoreDB(ctx context.Context, store ReportStore, selector ReportTypeSelector) (DB, error) {
+	out := DB{Customers: map[string]Customer{}, Objects: map[string]ObjectInfo{}}
+	objects, err := store.ListObjects(ctx, ``)
+	if err != nil {
+		return out, err
+	}
+	for _, v := range objects {
+		isSelected := false
+		for _, t := range selector {
+			if !isSelected && strings.HasSuffix(v.Key, t) {
+				isSelected = true
 			}
+		}
+		if !isSelected {
+			continue
+		}
 
-			// there is some disagreement about if this should have 7 or 8 parts in S3
-			parts := strings.Split(*v.Key, REPORT_LOCATION_DELIMITER)
-			if len(parts) != 8 {
-				continue
-			}
+		// there is some disagreement about if this should have 7 or 8 parts in S3
+		parts := strings.Split(v.Key, REPORT_LOCATION_DELIMITER)
+		if len(parts) != 8 {
+			continue
+		}
 
-			var ok bool
-			var customer Customer
-			if customer, ok = out.Customers[parts[DB_INDEX_POSITION_CUSTOMERID]]; !ok {
-				customer = Customer{CustomerID: parts[DB_INDEX_POSITION_CUSTOMERID], Accounts: map[string]Account{}}
-				out.Customers[customer.CustomerID] = customer
-			}
-			// retrieve / initialize the account entry
-			var account Account
-			if account, ok = customer.Accounts[parts[DB_INDEX_POSITION_ACCOUNT]]; !ok {
-				account = Account{
-					AccountID: parts[DB_INDEX_POSITION_ACCOUNT],
-					Reports:   map[time.Time]LocalReport{}}
-				customer.Accounts[account.AccountID] = account
-			}
+		var ok bool
+		var customer Customer
+		if customer, ok = out.Customers[parts[DB_INDEX_POSITION_CUSTOMERID]]; !ok {
+			customer = Customer{CustomerID: parts[DB_INDEX_POSITION_CUSTOMERID], Accounts: map[string]Account{}}
+			out.Customers[customer.CustomerID] = customer
+		}
+		// retrieve / initialize the account entry
+		var account Account
+		if account, ok = customer.Accounts[parts[DB_INDEX_POSITION_ACCOUNT]]; !ok {
+			account = Account{
+				AccountID: parts[DB_INDEX_POSITION_ACCOUNT],
+				Reports:   map[time.Time]LocalReport{}}
+			customer.Accounts[account.AccountID] = account
+		}
 
-			// parse out the type and date of the individual report file
-			base := parts[DB_INDEX_POSITION_FILE]
-			baseParts := strings.Split(base, `.`)
-			if len(baseParts) != 3 {
-				// return fmt.Errorf(`invalid report filename, invalid filename structure, %v`, base)
-				continue
-			}
-			if baseParts[1] == LATEST {
-				continue
-			}
-			reportTime, err := time.Parse(FILENAME_TIMESTAMP_LAYOUT, baseParts[1])
-			if err != nil {
-				// return fmt.Errorf(`invalid report filename, invalid timestamp`)
-				continue
-			}
-			reportTimeTruncated := reportTime.Truncate(24 * time.Hour)
-			var report LocalReport
-			if report, ok = account.Reports[reportTimeTruncated]; !ok {
-				report = LocalReport{
-					CustomerID: customer.CustomerID,
-					Account:    account.AccountID,
-					Timestamp:  reportTimeTruncated,
-					pathByKind: map[string]string{}}
-				account.Reports[reportTimeTruncated] = report
-			}
-			report.pathByKind[baseParts[0]] = *v.Key
+		// parse out the type and date of the individual report file
+		base := parts[DB_INDEX_POSITION_FILE]
+		baseParts := strings.Split(base, `.`)
+		if len(baseParts) != 3 {
+			// return fmt.Errorf(`invalid report filename, invalid filename structure, %v`, base)
+			continue
+		}
+		if baseParts[1] == LATEST {
+			continue
+		}
+		reportTime, err := time.Parse(FILENAME_TIMESTAMP_LAYOUT, baseParts[1])
+		if err != nil {
+			// return fmt.Errorf(`invalid report filename, invalid timestamp`)
+			continue
 		}
+		var report LocalReport
+		if report, ok = account.Reports[reportTime]; !ok {
+			report = LocalReport{
+				CustomerID: customer.CustomerID,
+				Account:    account.AccountID,
+				Timestamp:  reportTime,
+				pathByKind: map[string]string{}}
+			account.Reports[reportTime] = report
+		}
+		report.pathByKind[reportPathKey(baseParts[0], baseParts[2])] = v.Key
+		out.Objects[v.Key] = v
 	}
 	return out, nil
 }
 
 // dbDirWalker is to be used with a wrapper for filepath.Walk and is to be invoked
 // for each file under some specific point in the file tree. This function adds
-// customer, account, and report records to a provided DB instance. Access to the
-// provided DB instance is not synchronized. For that reason this func should not
-// be called in a goroutine.
+// customer, account, and report records to a provided DB instance. Files that
+// are not recognizable reports are recorded as Issues rather than failing the
+// walk. Access to the provided DB instance is not synchronized. For that reason
+// this func should not be called in a goroutine.
+//
+// Reports are keyed by their full timestamp, so several analyses on the same
+// day are distinct reports rather than duplicates. Only a second file of the
+// same kind, timestamp and format, e.g. both a .csv and a .csv.gz copy, is
+// recorded as a duplicate. An .xlsx copy of a CSV report is not.
 func dbDirWalker(out *DB, root, path string, info os.FileInfo, err error) error {
 	if err != nil {
 		return err
@@ -251,6 +497,10 @@ func dbDirWalker(out *DB, root, path string, info os.FileInfo, err error) error
 	if info.IsDir() {
 		return nil
 	}
+	// skip hidden files such as sync manifests and partial downloads
+	if strings.HasPrefix(info.Name(), `.`) {
+		return nil
+	}
 	// parse the path
 	rel, err := filepath.Rel(root, path)
 	if err != nil {
@@ -258,6 +508,33 @@ func dbDirWalker(out *DB, root, path string, info os.FileInfo, err error) error
 	}
 	parts := strings.Split(rel, string(os.PathSeparator))
 	if len(parts) != 8 {
+		// only files inside the report tree are worth mentioning
+		if parts[0]+REPORT_LOCATION_DELIMITER == REPORT_LOCATION_PREFIX {
+			out.Issues = append(out.Issues, DBIssue{
+				Issue:  ISSUE_UNEXPECTED_PATH,
+				Path:   path,
+				Detail: `not at customers/<customer>/reports/aws/<account>/<year>/<month>/<report>`,
+			})
+		}
+		return nil
+	}
+
+	// parse out the type and date of the individual report file, compressed
+	// reports share the key of their uncompressed counterparts
+	base := trimCompressionExtension(parts[DB_INDEX_POSITION_FILE])
+	baseParts := strings.Split(base, `.`)
+	if len(baseParts) == 3 && baseParts[1] == LATEST {
+		return nil
+	}
+	reportTime, err := reportFileTime(path)
+	if err != nil {
+		out.Issues = append(out.Issues, DBIssue{
+			Issue:      ISSUE_UNPARSEABLE_NAME,
+			CustomerID: parts[DB_INDEX_POSITION_CUSTOMERID],
+			Account:    parts[DB_INDEX_POSITION_ACCOUNT],
+			Path:       path,
+			Detail:     `expected <kind>.<YYYY-MM-DD-HHMM>.<ext>`,
+		})
 		return nil
 	}
 
@@ -278,29 +555,26 @@ func dbDirWalker(out *DB, root, path string, info os.FileInfo, err error) error
 		customer.Accounts[account.AccountID] = account
 	}
 
-	// parse out the type and date of the individual report file
-	base := parts[DB_INDEX_POSITION_FILE]
-	baseParts := strings.Split(base, `.`)
-	if len(baseParts) != 3 {
-		return fmt.Errorf(`invalid report filename, invalid filename structure`)
-	}
-	if baseParts[1] == LATEST {
-		return nil
-	}
-	reportTime, err := time.Parse(FILENAME_TIMESTAMP_LAYOUT, baseParts[1])
-	if err != nil {
-		return fmt.Errorf(`invalid report filename, invalid timestamp`)
-	}
-	reportTimeTruncated := reportTime.Truncate(24 * time.Hour)
 	var report LocalReport
-	if report, ok = account.Reports[reportTimeTruncated]; !ok {
+	if report, ok = account.Reports[reportTime]; !ok {
 		report = LocalReport{
 			CustomerID: customer.CustomerID,
 			Account:    account.AccountID,
-			Timestamp:  reportTimeTruncated,
+			Timestamp:  reportTime,
 			pathByKind: map[string]string{}}
-		account.Reports[reportTimeTruncated] = report
+		account.Reports[reportTime] = report
+	}
+	key := reportPathKey(baseParts[0], baseParts[2])
+	if previous, ok := report.pathByKind[key]; ok {
+		out.Issues = append(out.Issues, DBIssue{
+			Issue:        ISSUE_DUPLICATE_TIMESTAMP,
+			CustomerID:   customer.CustomerID,
+			Account:      account.AccountID,
+			AnalysisDate: reportTime.Format(FILENAME_TIMESTAMP_LAYOUT),
+			Path:         previous,
+			Detail:       `superseded by ` + path,
+		})
 	}
-	report.pathByKind[baseParts[0]] = rel
+	report.pathByKind[key] = path
 	return nil
 }
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func testDB(times ...string) DB {
+	account := Account{AccountID: `111`, Reports: map[time.Time]LocalReport{}}
+	for _, ts := range times {
+		t := parseTime(ts)
+		report := LocalReport{CustomerID: `C1`, Account: `111`, Timestamp: t, pathByKind: map[string]string{}}
+		for _, k := range []string{REPORT_TYPE_PREFIX_PRINCIPALS, REPORT_TYPE_PREFIX_RESOURCES} {
+			report.pathByKind[k] = k + `.` + ts + `.csv`
+		}
+		account.Reports[t] = report
+	}
+	return DB{Customers: map[string]Customer{
+		`C1`: {CustomerID: `C1`, Accounts: map[string]Account{`111`: account}},
+	}}
+}
+
+func TestPathsByCustomerAccount(t *testing.T) {
+	db := testDB(`2022-05-01-0000`, `2022-05-02-0000`, `2022-05-03-0000`, `2022-05-04-0000`)
+	since := parseTime(`2022-05-02-0000`)
+	until := parseTime(`2022-05-03-0000`)
+
+	cases := map[string]struct {
+		Filter   ReportFilter
+		Expected []string
+	}{
+		`No filter`: {
+			Filter: ReportFilter{},
+			Expected: []string{
+				`principals.2022-05-01-0000.csv`, `principals.2022-05-02-0000.csv`,
+				`principals.2022-05-03-0000.csv`, `principals.2022-05-04-0000.csv`,
+				`resources.2022-05-01-0000.csv`, `resources.2022-05-02-0000.csv`,
+				`resources.2022-05-03-0000.csv`, `resources.2022-05-04-0000.csv`,
+			},
+		},
+		`Date range`: {
+			Filter: ReportFilter{Since: &since, Until: &until, Kinds: []string{REPORT_TYPE_PREFIX_PRINCIPALS}},
+			Expected: []string{
+				`principals.2022-05-02-0000.csv`, `principals.2022-05-03-0000.csv`,
+			},
+		},
+		`Latest and predecessor`: {
+			Filter: ReportFilter{Latest: 2, Kinds: []string{REPORT_TYPE_PREFIX_RESOURCES}},
+			Expected: []string{
+				`resources.2022-05-03-0000.csv`, `resources.2022-05-04-0000.csv`,
+			},
+		},
+		`Latest within range`: {
+			Filter:   ReportFilter{Until: &until, Latest: 1, Kinds: []string{REPORT_TYPE_PREFIX_PRINCIPALS}},
+			Expected: []string{`principals.2022-05-03-0000.csv`},
+		},
+		`Unknown kind`: {
+			Filter:   ReportFilter{Kinds: []string{`bogus`}},
+			Expected: []string{},
+		},
+	}
+	for l, c := range cases {
+		o := db.PathsByCustomerAccount(`C1`, `111`, c.Filter)
+		sort.Strings(o)
+		if len(o) != len(c.Expected) {
+			t.Errorf("Case: %v, expected %v, but was %v", l, c.Expected, o)
+			continue
+		}
+		for i := range o {
+			if o[i] != c.Expected[i] {
+				t.Errorf("Case: %v, expected %v, but was %v", l, c.Expected, o)
+				break
+			}
+		}
+	}
+}
+
+func TestAccountKeys(t *testing.T) {
+	db := testDB(`2022-05-01-0000`)
+	db.Customers[`C2`] = Customer{CustomerID: `C2`, Accounts: map[string]Account{
+		`333`: {AccountID: `333`},
+		`222`: {AccountID: `222`},
+	}}
+
+	cases := map[string]struct {
+		CustomerID string
+		Expected   []AccountKey
+	}{
+		`All customers`:   {``, []AccountKey{{`C1`, `111`}, {`C2`, `222`}, {`C2`, `333`}}},
+		`Single customer`: {`C2`, []AccountKey{{`C2`, `222`}, {`C2`, `333`}}},
+		`Unknown`:         {`C3`, []AccountKey{}},
+	}
+	for l, c := range cases {
+		o := db.AccountKeys(c.CustomerID)
+		if len(o) != len(c.Expected) {
+			t.Errorf("Case: %v, expected %v, but was %v", l, c.Expected, o)
+			continue
+		}
+		for i := range o {
+			if o[i] != c.Expected[i] {
+				t.Errorf("Case: %v, expected %v, but was %v", l, c.Expected, o)
+				break
+			}
+		}
+	}
+}
+
+func TestAnalysisDateReport(t *testing.T) {
+	db := testDB(`2022-05-01-0714`, `2022-05-01-1830`, `2022-05-02-0000`)
+	account := db.Customers[`C1`].Accounts[`111`]
+
+	cases := map[string]struct {
+		Input    string
+		Expected string
+	}{
+		`Latest`:             {``, `2022-05-02-0000`},
+		`Latest on a day`:    {`2022-05-01`, `2022-05-01-1830`},
+		`Exact`:              {`2022-05-01-0714`, `2022-05-01-0714`},
+		`Exact midnight`:     {`2022-05-02-0000`, `2022-05-02-0000`},
+		`No exact match`:     {`2022-05-01-0715`, ``},
+		`No report that day`: {`2022-05-03`, ``},
+	}
+	for l, c := range cases {
+		d, err := ParseAnalysisDate(c.Input)
+		if err != nil {
+			t.Errorf("Case: %v, unexpected error: %v", l, err)
+			continue
+		}
+		r, ok := d.Report(account)
+		if o := r.Timestamp.Format(FILENAME_TIMESTAMP_LAYOUT); ok != (len(c.Expected) > 0) || (ok && o != c.Expected) {
+			t.Errorf("Case: %v, expected %v, but was %v, %v", l, c.Expected, o, ok)
+		}
+	}
+
+	if _, err := ParseAnalysisDate(`2022-05`); err == nil {
+		t.Errorf(`expected an invalid analysis date to be rejected`)
+	}
+}
+
+func TestAnalysisDateResolution(t *testing.T) {
+	db := testDB(`2022-05-01-0714`, `2022-05-01-1830`, `2022-05-04-0900`)
+	account := db.Customers[`C1`].Accounts[`111`]
+
+	cases := map[string]struct {
+		Input      string
+		Resolution string
+		Expected   string
+	}{
+		`Exact weekend`:            {`2022-05-02`, RESOLUTION_EXACT, ``},
+		`As of weekend`:            {`2022-05-02`, RESOLUTION_AS_OF, `2022-05-01-1830`},
+		`As of same day`:           {`2022-05-04`, RESOLUTION_AS_OF, `2022-05-04-0900`},
+		`As of before first`:       {`2022-04-20`, RESOLUTION_AS_OF, ``},
+		`As of time`:               {`2022-05-01-1200`, RESOLUTION_AS_OF, `2022-05-01-0714`},
+		`Nearest earlier`:          {`2022-05-02`, RESOLUTION_NEAREST, `2022-05-01-1830`},
+		`Nearest later`:            {`2022-05-03`, RESOLUTION_NEAREST, `2022-05-04-0900`},
+		`Nearest before first`:     {`2022-04-20`, RESOLUTION_NEAREST, `2022-05-01-0714`},
+		`Nearest after last`:       {`2022-06-01`, RESOLUTION_NEAREST, `2022-05-04-0900`},
+		`Nearest time`:             {`2022-05-01-1700`, RESOLUTION_NEAREST, `2022-05-01-1830`},
+		`Nearest prefers earlier`:  {`2022-05-01-1252`, RESOLUTION_NEAREST, `2022-05-01-0714`},
+		`Default resolution exact`: {`2022-05-03`, ``, ``},
+	}
+	for l, c := range cases {
+		d, err := ParseAnalysisDate(c.Input)
+		if err != nil {
+			t.Errorf("Case: %v, unexpected error: %v", l, err)
+			continue
+		}
+		d.Resolution = c.Resolution
+		r, ok := d.Report(account)
+		if o := r.Timestamp.Format(FILENAME_TIMESTAMP_LAYOUT); ok != (len(c.Expected) > 0) || (ok && o != c.Expected) {
+			t.Errorf("Case: %v, expected %v, but was %v, %v", l, c.Expected, o, ok)
+		}
+	}
+
+	_, meta, ok := db.ResolveReport(`C1`, `111`, &AnalysisDate{Time: parseTime(`2022-05-02-0000`), Resolution: RESOLUTION_AS_OF})
+	if !ok || meta.AnalysisTime != `2022-05-01-1830` || meta.RequestedDate != `2022-05-02` {
+		t.Errorf(`expected metadata describing the resolved report, was %v`, meta)
+	}
+}
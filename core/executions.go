@@ -0,0 +1,120 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// EXECUTIONS_FILENAME is the name of the execution log in the report home.
+const EXECUTIONS_FILENAME = `executions.json`
+
+// AnalysisExecution records an analysis started with AnalyzeAccount.
+type AnalysisExecution struct {
+	ExecutionID string    `csv:"execution_id" json:"execution_id"`
+	CustomerID  string    `csv:"customer_id" json:"customer_id"`
+	Account     string    `csv:"account" json:"account"`
+	APIHost     string    `csv:"api" json:"api"`
+	Status      string    `csv:"status" json:"status"`
+	StartedAt   time.Time `csv:"started_at" json:"started_at"`
+	UpdatedAt   time.Time `csv:"updated_at" json:"updated_at"`
+	StoppedAt   time.Time `csv:"stopped_at" json:"stopped_at"`
+}
+
+// ExecutionLog is the local record of analysis executions, keyed by
+// execution ID.
+type ExecutionLog struct {
+	Executions map[string]AnalysisExecution `json:"executions"`
+}
+
+// ExecutionLogPath returns the location of the execution log under the
+// report home.
+func ExecutionLogPath(reportHome string) string {
+	return filepath.Join(reportHome, EXECUTIONS_FILENAME)
+}
+
+// LoadExecutionLog reads the execution log at the provided path. A missing
+// log is not an error and results in an empty ExecutionLog.
+func LoadExecutionLog(path string) (*ExecutionLog, error) {
+	l := &ExecutionLog{Executions: map[string]AnalysisExecution{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return l, nil
+	} else if err != nil {
+		return l, err
+	}
+	if err = json.Unmarshal(b, l); err != nil {
+		return l, fmt.Errorf(`invalid execution log %v, %w`, path, err)
+	}
+	if l.Executions == nil {
+		l.Executions = map[string]AnalysisExecution{}
+	}
+	return l, nil
+}
+
+// Save atomically replaces the execution log at the provided path.
+func (l *ExecutionLog) Save(path string) error {
+	b, err := json.MarshalIndent(l, ``, `  `)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b)
+}
+
+// Get returns the execution recorded with the provided ID.
+func (l *ExecutionLog) Get(executionID string) (AnalysisExecution, bool) {
+	e, ok := l.Executions[executionID]
+	return e, ok
+}
+
+// Put records an execution, replacing any earlier record of it.
+func (l *ExecutionLog) Put(e AnalysisExecution) {
+	l.Executions[e.ExecutionID] = e
+}
+
+// List returns the recorded executions, most recently started first.
+func (l *ExecutionLog) List() []AnalysisExecution {
+	out := []AnalysisExecution{}
+	for _, e := range l.Executions {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].StartedAt.Equal(out[j].StartedAt) {
+			return out[i].StartedAt.After(out[j].StartedAt)
+		}
+		return out[i].ExecutionID < out[j].ExecutionID
+	})
+	return out
+}
+
+// RecordExecution adds or updates an execution in the log at the provided
+// path.
+func RecordExecution(path string, e AnalysisExecution) error {
+	l, err := LoadExecutionLog(path)
+	if err != nil {
+		return err
+	}
+	l.Put(e)
+	return l.Save(path)
+}
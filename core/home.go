@@ -0,0 +1,46 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DEFAULT_REPORT_HOME is the report home used when none is configured.
+const DEFAULT_REPORT_HOME = `.`
+
+// ResolveReportHome converts a configured report home into an absolute
+// path. The local report database is rooted at this path for both sync and
+// queries. An empty path resolves to DEFAULT_REPORT_HOME and a leading `~`
+// is expanded to the current user's home directory.
+func ResolveReportHome(path string) (string, error) {
+	if len(path) <= 0 {
+		path = DEFAULT_REPORT_HOME
+	}
+	if path == `~` ||
+		strings.HasPrefix(path, `~/`) ||
+		strings.HasPrefix(path, `~`+string(os.PathSeparator)) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ``, err
+		}
+		path = filepath.Join(home, path[1:])
+	}
+	return filepath.Abs(path)
+}
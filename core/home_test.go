@@ -0,0 +1,34 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveReportHome(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip(`no home directory`)
+	}
+	wd, _ := os.Getwd()
+	cases := map[string]struct {
+		Path     string
+		Expected string
+	}{
+		`Empty`:         {``, wd},
+		`Relative`:      {`reports`, filepath.Join(wd, `reports`)},
+		`Absolute`:      {filepath.Join(home, `x`), filepath.Join(home, `x`)},
+		`Home`:          {`~`, home},
+		`Home relative`: {`~/k9/reports`, filepath.Join(home, `k9`, `reports`)},
+	}
+	for l, c := range cases {
+		o, err := ResolveReportHome(c.Path)
+		if err != nil {
+			t.Errorf("Case: %v, unexpected error: %v", l, err)
+		}
+		if o != c.Expected {
+			t.Errorf("Case: %v, expected %v, but was %v", l, c.Expected, o)
+		}
+	}
+}
@@ -23,23 +23,20 @@ import (
 	"sort"
 	"strings"
 	"time"
-
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
 var TimeLatest time.Time
 
-func List(o io.Writer, cfg aws.Config, bucket, customerID, account string) error {
+func List(o io.Writer, store ReportStore, customerID, account string) error {
 	if len(customerID) <= 0 {
 		// no customers specified, list the customers
-		return listCustomers(o, cfg, bucket)
+		return listCustomers(o, store)
 	} else if len(account) <= 0 {
 		// no account specified, list accounts
-		return listAccounts(o, cfg, bucket, customerID)
+		return listAccounts(o, store, customerID)
 	} else {
 		// list objects matching some pattern
-		if reports, err := listObjects(cfg, bucket, customerID, account); err != nil {
+		if reports, err := listObjects(store, customerID, account); err != nil {
 			return err
 		} else {
 			return displayReports(o, reports)
@@ -47,92 +44,102 @@ func List(o io.Writer, cfg aws.Config, bucket, customerID, account string) error
 	}
 }
 
-func listCustomers(o io.Writer, cfg aws.Config, bucket string) error {
-	client := s3.NewFromConfig(cfg)
-	pages := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
-		Delimiter: &REPORT_LOCATION_DELIMITER,
-		Bucket:    &bucket,
-		Prefix:    &REPORT_LOCATION_PREFIX})
-
-	for pages.HasMorePages() {
-		resp, err := pages.NextPage(context.TODO())
-		if err != nil {
-			return err
+// ListLocal lists the customers in a local database, the accounts of a
+// customer, or every analysis time of an account, including each run on
+// the same day.
+func ListLocal(o io.Writer, db DB, customerID, account string) error {
+	if len(customerID) <= 0 {
+		ids := []string{}
+		for id := range db.Customers {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			fmt.Fprintln(o, id)
+		}
+		return nil
+	}
+	customer, ok := db.Customers[customerID]
+	if !ok {
+		return fmt.Errorf(`no such customer: %v`, customerID)
+	}
+	if len(account) <= 0 {
+		for _, a := range db.AccountKeys(customerID) {
+			fmt.Fprintln(o, a.Account)
 		}
+		return nil
+	}
+	a, ok := customer.Accounts[account]
+	if !ok {
+		return fmt.Errorf(`no such account: %v`, account)
+	}
+	reports := ReportSet{CustomerID: customerID, Account: account}
+	for t := range a.Reports {
+		reports.Set = append(reports.Set, Report{CustomerID: customerID, Account: account, Timestamp: t})
+	}
+	return displayReports(o, reports)
+}
 
-		for _, p := range resp.CommonPrefixes {
-			s := strings.Split(*p.Prefix, REPORT_LOCATION_DELIMITER)
-			if len(s) < 2 {
-				// malformed prefix
-				continue
-			}
-			fmt.Fprintln(o, s[1])
+func listCustomers(o io.Writer, store ReportStore) error {
+	prefixes, err := store.ListPrefixes(context.TODO(), REPORT_LOCATION_PREFIX)
+	if err != nil {
+		return err
+	}
+	for _, p := range prefixes {
+		s := strings.Split(p, REPORT_LOCATION_DELIMITER)
+		if len(s) < 2 {
+			// malformed prefix
+			continue
 		}
+		fmt.Fprintln(o, s[1])
 	}
 	return nil
 }
 
-func listAccounts(o io.Writer, cfg aws.Config, bucket, customerID string) error {
+func listAccounts(o io.Writer, store ReportStore, customerID string) error {
 	prefix := fmt.Sprintf(REPORT_LOCATION_CUSTOMER_PATTERN, customerID)
-	client := s3.NewFromConfig(cfg)
-	pages := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
-		Delimiter: &REPORT_LOCATION_DELIMITER,
-		Bucket:    &bucket,
-		Prefix:    &prefix})
-
-	for pages.HasMorePages() {
-		resp, err := pages.NextPage(context.TODO())
-		if err != nil {
-			return err
-		}
-
-		for _, p := range resp.CommonPrefixes {
-			s := strings.Split(*p.Prefix, REPORT_LOCATION_DELIMITER)
-			if len(s) < 5 {
-				// malformed prefix
-				continue
-			}
-			fmt.Fprintln(o, s[4])
+	prefixes, err := store.ListPrefixes(context.TODO(), prefix)
+	if err != nil {
+		return err
+	}
+	for _, p := range prefixes {
+		s := strings.Split(p, REPORT_LOCATION_DELIMITER)
+		if len(s) < 5 {
+			// malformed prefix
+			continue
 		}
+		fmt.Fprintln(o, s[4])
 	}
 	return nil
 }
 
-func listObjects(cfg aws.Config, bucket, customerID, account string) (ReportSet, error) {
+func listObjects(store ReportStore, customerID, account string) (ReportSet, error) {
 	prefix := fmt.Sprintf(REPORT_LOCATION_ACCOUNT_PATTERN, customerID, account)
 
 	reports := ReportSet{CustomerID: customerID, Account: account}
 	index := map[time.Time]Report{}
 
-	client := s3.NewFromConfig(cfg)
-	pages := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
-		Bucket: &bucket,
-		Prefix: &prefix})
-
-	for pages.HasMorePages() {
-		resp, err := pages.NextPage(context.TODO())
+	objects, err := store.ListObjects(context.TODO(), prefix)
+	if err != nil {
+		return reports, err
+	}
+	for _, o := range objects {
+		rts, err := extractReportTimeFromKey(o.Key)
 		if err != nil {
-			return reports, err
+			// malformed report filename
+			continue
 		}
-
-		for _, o := range resp.Contents {
-			rts, err := extractReportTimeFromKey(*o.Key)
-			if err != nil {
-				// malformed report filename
-				continue
-			}
-			if rts == TimeLatest {
-				continue
-			}
-			if _, ok := index[rts]; !ok {
-				fresh := Report{
-					Bucket:     bucket,
-					CustomerID: customerID,
-					Account:    account,
-					Timestamp:  rts}
-				reports.Set = append(reports.Set, fresh)
-				index[rts] = fresh
-			}
+		if rts == TimeLatest {
+			continue
+		}
+		if _, ok := index[rts]; !ok {
+			fresh := Report{
+				Bucket:     store.Location(),
+				CustomerID: customerID,
+				Account:    account,
+				Timestamp:  rts}
+			reports.Set = append(reports.Set, fresh)
+			index[rts] = fresh
 		}
 	}
 
@@ -0,0 +1,187 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// MANIFEST_FILENAME is the name of the sync manifest stored in each local
+// account directory.
+const MANIFEST_FILENAME = `.k9-manifest.json`
+
+// ObjectInfo is the remote metadata for a single report object.
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	ETag         string    `json:"etag"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// ManifestEntry records the remote metadata of a report object at the time
+// it was downloaded, along with a SHA-256 digest of the uncompressed content
+// that is checked before the local copy is trusted again. When the local
+// copy is stored compressed, the compression and the size of the compressed
+// file are recorded as well.
+type ManifestEntry struct {
+	ObjectInfo
+	SHA256      string `json:"sha256"`
+	Compression string `json:"compression,omitempty"`
+	LocalSize   int64  `json:"local_size,omitempty"`
+}
+
+// localSize returns the expected size of the local copy.
+func (e ManifestEntry) localSize() int64 {
+	if len(e.Compression) > 0 && e.Compression != COMPRESSION_NONE {
+		return e.LocalSize
+	}
+	return e.Size
+}
+
+// Manifest tracks the report objects that have been synced to a local
+// account directory. A Manifest is safe for concurrent use.
+type Manifest struct {
+	mu      sync.Mutex
+	Entries map[string]ManifestEntry `json:"entries"`
+}
+
+// ManifestPathForCustomerAccount returns the location of the sync manifest
+// for the specified account under the provided root.
+func ManifestPathForCustomerAccount(root, customerID, account string) string {
+	return filepath.Join(root,
+		filepath.FromSlash(fmt.Sprintf(REPORT_LOCATION_ACCOUNT_PATTERN, customerID, account)),
+		MANIFEST_FILENAME)
+}
+
+// LoadManifest reads the manifest at the provided path. A missing manifest
+// is not an error and results in an empty Manifest.
+func LoadManifest(path string) (*Manifest, error) {
+	m := &Manifest{Entries: map[string]ManifestEntry{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	} else if err != nil {
+		return m, err
+	}
+	if err = json.Unmarshal(b, m); err != nil {
+		return m, fmt.Errorf(`invalid manifest %v, %w`, path, err)
+	}
+	if m.Entries == nil {
+		m.Entries = map[string]ManifestEntry{}
+	}
+	return m, nil
+}
+
+// Save atomically replaces the manifest at the provided path.
+func (m *Manifest) Save(path string) error {
+	m.mu.Lock()
+	b, err := json.MarshalIndent(m, ``, `  `)
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b)
+}
+
+// Get returns the entry recorded for the provided key.
+func (m *Manifest) Get(key string) (ManifestEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.Entries[key]
+	return e, ok
+}
+
+// Put records an entry in the manifest.
+func (m *Manifest) Put(e ManifestEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Entries[e.Key] = e
+}
+
+// IsCurrent reports whether the local copy of the remote object at the
+// provided path is up to date. The remote ETag, size, and modification time
+// must match the manifest entry, and the local file must be intact: its size
+// and the digest of its uncompressed content must match the entry as well.
+// Entries without a digest are never current.
+func (m *Manifest) IsCurrent(remote ObjectInfo, localPath string) bool {
+	e, ok := m.Get(remote.Key)
+	if !ok {
+		return false
+	}
+	if e.ETag != remote.ETag ||
+		e.Size != remote.Size ||
+		!e.LastModified.Equal(remote.LastModified) {
+		return false
+	}
+	info, err := os.Stat(localPath)
+	if err != nil || info.Size() != e.localSize() || len(e.SHA256) == 0 {
+		return false
+	}
+	digest, err := fileDigest(localPath)
+	return err == nil && digest == e.SHA256
+}
+
+// fileDigest returns the hex encoded SHA-256 digest of the uncompressed
+// content of the file at path.
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ``, err
+	}
+	defer f.Close()
+	r, err := decompressingReader(f)
+	if err != nil {
+		return ``, err
+	}
+	h := sha256.New()
+	if _, err = io.Copy(h, r); err != nil {
+		return ``, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory as
+// path and renames it into place.
+func writeFileAtomic(path string, data []byte) error {
+	dir, base := filepath.Split(path)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, base+`.*.tmp`)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestManifestIsCurrent(t *testing.T) {
+	dir := t.TempDir()
+	local := filepath.Join(dir, `principals.2022-05-01-0714.csv`)
+	if err := os.WriteFile(local, []byte(`abcd`), 0640); err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2022, 5, 1, 7, 14, 0, 0, time.UTC)
+	recorded := ObjectInfo{Key: `k`, ETag: `"e1"`, Size: 4, LastModified: modified}
+
+	cases := map[string]struct {
+		Remote   ObjectInfo
+		Path     string
+		Expected bool
+	}{
+		`Unchanged`:         {recorded, local, true},
+		`Unknown key`:       {ObjectInfo{Key: `other`, ETag: `"e1"`, Size: 4, LastModified: modified}, local, false},
+		`Changed ETag`:      {ObjectInfo{Key: `k`, ETag: `"e2"`, Size: 4, LastModified: modified}, local, false},
+		`Changed size`:      {ObjectInfo{Key: `k`, ETag: `"e1"`, Size: 5, LastModified: modified}, local, false},
+		`Changed modified`:  {ObjectInfo{Key: `k`, ETag: `"e1"`, Size: 4, LastModified: modified.Add(time.Minute)}, local, false},
+		`Missing local`:     {recorded, filepath.Join(dir, `missing.csv`), false},
+		`Unknown remote sz`: {ObjectInfo{Key: `k`, ETag: `"e1"`, Size: -1, LastModified: modified}, local, false},
+	}
+
+	digest := sha256.Sum256([]byte(`abcd`))
+	m := &Manifest{Entries: map[string]ManifestEntry{}}
+	m.Put(ManifestEntry{ObjectInfo: recorded, SHA256: hex.EncodeToString(digest[:])})
+	for l, c := range cases {
+		if o := m.IsCurrent(c.Remote, c.Path); o != c.Expected {
+			t.Errorf("Case: %v, expected %v, but was %v", l, c.Expected, o)
+		}
+	}
+
+	// a local copy that no longer matches the recorded digest is out of
+	// date, whether or not its size has changed
+	for content, label := range map[string]string{`ab`: `truncated`, `abce`: `corrupted`} {
+		if err := os.WriteFile(local, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+		if m.IsCurrent(recorded, local) {
+			t.Errorf("Case: %v, expected the local file to be out of date", label)
+		}
+	}
+
+	// entries without a digest can not be verified
+	if err := os.WriteFile(local, []byte(`abcd`), 0640); err != nil {
+		t.Fatal(err)
+	}
+	m.Put(ManifestEntry{ObjectInfo: recorded})
+	if m.IsCurrent(recorded, local) {
+		t.Errorf(`expected an entry without a digest to be out of date`)
+	}
+}
+
+func TestManifestSaveLoad(t *testing.T) {
+	path := ManifestPathForCustomerAccount(t.TempDir(), `C1`, `111`)
+
+	m, err := LoadManifest(path)
+	if err != nil {
+		t.Fatalf(`expected a missing manifest to load, was %v`, err)
+	}
+	if len(m.Entries) != 0 {
+		t.Fatalf(`expected an empty manifest, was %v`, m.Entries)
+	}
+
+	entry := ManifestEntry{
+		ObjectInfo: ObjectInfo{Key: `k`, ETag: `"e1"`, Size: 4, LastModified: time.Date(2022, 5, 1, 7, 14, 0, 0, time.UTC)},
+		SHA256:     `digest`,
+	}
+	m.Put(entry)
+	if err = m.Save(path); err != nil {
+		t.Fatalf(`unexpected error saving manifest: %v`, err)
+	}
+
+	loaded, err := LoadManifest(path)
+	if err != nil {
+		t.Fatalf(`unexpected error loading manifest: %v`, err)
+	}
+	if o, ok := loaded.Get(`k`); !ok || o.ETag != entry.ETag || o.SHA256 != entry.SHA256 || !o.LastModified.Equal(entry.LastModified) {
+		t.Errorf(`expected %v, but was %v`, entry, o)
+	}
+}
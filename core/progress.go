@@ -0,0 +1,237 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	PROGRESS_EVENT_START    = `start`
+	PROGRESS_EVENT_PROGRESS = `progress`
+	PROGRESS_EVENT_FILE     = `file`
+	PROGRESS_EVENT_FINISH   = `finish`
+
+	PROGRESS_STATUS_DOWNLOADED = `downloaded`
+	PROGRESS_STATUS_FAILED     = `failed`
+)
+
+// progressInterval is the minimum time between two progress events that
+// only report transferred bytes.
+var progressInterval = 500 * time.Millisecond
+
+// ProgressEvent describes the state of a sync at a point in time. Start
+// events carry the totals, file events the outcome of a single report,
+// progress events the bytes transferred so far, and the finish event the
+// final tally.
+type ProgressEvent struct {
+	Event          string    `json:"event"`
+	Time           time.Time `json:"time"`
+	Key            string    `json:"key,omitempty"`
+	Status         string    `json:"status,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	FilesDone      int       `json:"files_done"`
+	FilesFailed    int       `json:"files_failed"`
+	FilesSkipped   int       `json:"files_skipped"`
+	FilesTotal     int       `json:"files_total"`
+	BytesDone      int64     `json:"bytes_done"`
+	BytesTotal     int64     `json:"bytes_total"`
+	BytesPerSecond float64   `json:"bytes_per_second"`
+	// ETASeconds is the estimated time remaining, or -1 when unknown.
+	ETASeconds float64 `json:"eta_seconds"`
+}
+
+// ProgressReporter receives the progress events of a sync. Events are
+// delivered one at a time.
+type ProgressReporter interface {
+	Report(ProgressEvent)
+}
+
+// jsonProgressReporter writes each event as a single line of JSON.
+type jsonProgressReporter struct {
+	enc *json.Encoder
+}
+
+// NewJSONProgressReporter returns a ProgressReporter that writes newline
+// delimited JSON events to o, suitable for logs and other programs.
+func NewJSONProgressReporter(o io.Writer) ProgressReporter {
+	return &jsonProgressReporter{enc: json.NewEncoder(o)}
+}
+
+func (r *jsonProgressReporter) Report(e ProgressEvent) {
+	r.enc.Encode(e)
+}
+
+// terminalProgressReporter redraws a single status line.
+type terminalProgressReporter struct {
+	o       io.Writer
+	verbose bool
+}
+
+// NewTerminalProgressReporter returns a ProgressReporter that renders a
+// status line with the files and bytes done, the transfer rate, and the
+// estimated time remaining. When verbose the key of each downloaded report
+// is printed above the status line.
+func NewTerminalProgressReporter(o io.Writer, verbose bool) ProgressReporter {
+	return &terminalProgressReporter{o: o, verbose: verbose}
+}
+
+func (r *terminalProgressReporter) Report(e ProgressEvent) {
+	// return to the start of the line and clear it
+	fmt.Fprint(r.o, "\r\033[K")
+	if e.Event == PROGRESS_EVENT_FILE && (r.verbose || e.Status == PROGRESS_STATUS_FAILED) {
+		if len(e.Error) > 0 {
+			fmt.Fprintf(r.o, "%v: %v\n", e.Key, e.Error)
+		} else {
+			fmt.Fprintln(r.o, e.Key)
+		}
+	}
+	fmt.Fprint(r.o, FormatProgress(e))
+	if e.Event == PROGRESS_EVENT_FINISH {
+		fmt.Fprintln(r.o)
+	}
+}
+
+// FormatProgress renders an event as a short human readable status line.
+func FormatProgress(e ProgressEvent) string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "%v/%v files, %v/%v, %v/s",
+		e.FilesDone, e.FilesTotal, formatBytes(e.BytesDone), formatBytes(e.BytesTotal),
+		formatBytes(int64(e.BytesPerSecond)))
+	if e.Event != PROGRESS_EVENT_FINISH && e.ETASeconds >= 0 {
+		fmt.Fprintf(b, ", ETA %v", (time.Duration(e.ETASeconds) * time.Second).String())
+	}
+	if e.FilesSkipped > 0 {
+		fmt.Fprintf(b, ", %v skipped", e.FilesSkipped)
+	}
+	if e.FilesFailed > 0 {
+		fmt.Fprintf(b, ", %v failed", e.FilesFailed)
+	}
+	return b.String()
+}
+
+// formatBytes renders a byte count with a binary prefix.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf(`%d B`, n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf(`%.1f %ciB`, float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// syncProgress tracks the files and bytes transferred by a sync and relays
+// them to a ProgressReporter. A nil syncProgress ignores all updates.
+type syncProgress struct {
+	mu       sync.Mutex
+	reporter ProgressReporter
+	started  time.Time
+	last     time.Time
+	state    ProgressEvent
+}
+
+func newSyncProgress(reporter ProgressReporter) *syncProgress {
+	if reporter == nil {
+		return nil
+	}
+	return &syncProgress{reporter: reporter}
+}
+
+// start records the totals and emits the start event.
+func (p *syncProgress) start(files, skipped int, bytes int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.started = time.Now()
+	p.state.FilesTotal = files
+	p.state.FilesSkipped = skipped
+	p.state.BytesTotal = bytes
+	p.emit(PROGRESS_EVENT_START, ``, ``, nil)
+}
+
+// addBytes records transferred bytes and emits a progress event if one has
+// not been emitted recently.
+func (p *syncProgress) addBytes(n int64) {
+	if p == nil || n == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.BytesDone += n
+	if time.Since(p.last) >= progressInterval {
+		p.emit(PROGRESS_EVENT_PROGRESS, ``, ``, nil)
+	}
+}
+
+// fileDone records the outcome of a single report download.
+func (p *syncProgress) fileDone(key string, err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.FilesDone++
+	status := PROGRESS_STATUS_DOWNLOADED
+	if err != nil {
+		p.state.FilesFailed++
+		status = PROGRESS_STATUS_FAILED
+	}
+	p.emit(PROGRESS_EVENT_FILE, key, status, err)
+}
+
+// finish emits the final tally.
+func (p *syncProgress) finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.emit(PROGRESS_EVENT_FINISH, ``, ``, nil)
+}
+
+// emit must be called with the lock held.
+func (p *syncProgress) emit(event, key, status string, err error) {
+	now := time.Now()
+	e := p.state
+	e.Event = event
+	e.Time = now
+	e.Key = key
+	e.Status = status
+	if err != nil {
+		e.Error = err.Error()
+	}
+	e.ETASeconds = -1
+	if elapsed := now.Sub(p.started).Seconds(); elapsed > 0 {
+		e.BytesPerSecond = float64(e.BytesDone) / elapsed
+	}
+	if e.BytesPerSecond > 0 && e.BytesTotal >= e.BytesDone {
+		e.ETASeconds = float64(e.BytesTotal-e.BytesDone) / e.BytesPerSecond
+	}
+	p.last = now
+	p.reporter.Report(e)
+}
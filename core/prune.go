@@ -0,0 +1,248 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// RetentionPolicy describes which reports of an account are kept. For each
+// of the KeepDaily most recent days, KeepWeekly most recent ISO weeks, and
+// KeepMonthly most recent months that have reports, the newest report in
+// that period is kept. A report kept by more than one rule is counted once.
+// The most recent report is always kept.
+type RetentionPolicy struct {
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+}
+
+// Validate returns an error if the policy would not keep any period or has
+// a negative count.
+func (p RetentionPolicy) Validate() error {
+	if p.KeepDaily < 0 || p.KeepWeekly < 0 || p.KeepMonthly < 0 {
+		return &IllegalArgumentError{`retention policy`, `keep counts must not be negative`}
+	}
+	if p.KeepDaily+p.KeepWeekly+p.KeepMonthly <= 0 {
+		return &IllegalArgumentError{`retention policy`, `at least one of daily, weekly, or monthly must be kept`}
+	}
+	return nil
+}
+
+// Retains returns the timestamps of the reports kept by the policy.
+func (p RetentionPolicy) Retains(reports map[time.Time]LocalReport) map[time.Time]bool {
+	times := make([]time.Time, 0, len(reports))
+	for t := range reports {
+		times = append(times, t)
+	}
+	// newest first so that the first report seen in a period is kept
+	sort.Slice(times, func(i, j int) bool { return times[i].After(times[j]) })
+
+	keep := map[time.Time]bool{}
+	if len(times) > 0 {
+		keep[times[0]] = true
+	}
+	rules := []struct {
+		count  int
+		period func(time.Time) string
+	}{
+		{p.KeepDaily, func(t time.Time) string { return t.Format(`2006-01-02`) }},
+		{p.KeepWeekly, func(t time.Time) string {
+			y, w := t.ISOWeek()
+			return fmt.Sprintf(`%d-W%02d`, y, w)
+		}},
+		{p.KeepMonthly, func(t time.Time) string { return t.Format(`2006-01`) }},
+	}
+	for _, r := range rules {
+		seen := map[string]bool{}
+		for _, t := range times {
+			if len(seen) >= r.count {
+				break
+			}
+			period := r.period(t)
+			if seen[period] {
+				continue
+			}
+			seen[period] = true
+			keep[t] = true
+		}
+	}
+	return keep
+}
+
+// PruneSummary tallies the reports kept and pruned for a single account.
+type PruneSummary struct {
+	CustomerID string `csv:"customer_id" json:"customer_id"`
+	Account    string `csv:"account" json:"account"`
+	Kept       int    `csv:"kept" json:"kept"`
+	Pruned     int    `csv:"pruned" json:"pruned"`
+	// Paths lists the files of the pruned reports.
+	Paths []string `csv:"-" json:"paths"`
+}
+
+// PruneOptions adjust how pruned reports are disposed of.
+type PruneOptions struct {
+	// DryRun lists the reports that would be pruned without changing the
+	// database.
+	DryRun bool
+	// Archive, when set, is the path of a new tar.gz archive that receives
+	// the pruned report files before they are removed. Archive entries are
+	// named relative to the report home so that they can be restored by
+	// extracting the archive there.
+	Archive string
+}
+
+// Prune applies the retention policy to each of the provided accounts of a
+// local database rooted at reportHome. Pruned report files are removed, or
+// moved into an archive, and directories left empty are removed. Reports
+// are only removed once the archive, if any, has been written completely.
+func Prune(db DB, reportHome string, accounts []AccountKey, policy RetentionPolicy, opts PruneOptions) ([]PruneSummary, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	summaries := make([]PruneSummary, 0, len(accounts))
+	paths := []string{}
+	for _, a := range accounts {
+		s := PruneSummary{CustomerID: a.CustomerID, Account: a.Account, Paths: []string{}}
+		account, ok := db.Customers[a.CustomerID].Accounts[a.Account]
+		if ok {
+			keep := policy.Retains(account.Reports)
+			for _, r := range (ReportFilter{}).Selects(account.Reports) {
+				if keep[r.Timestamp] {
+					s.Kept++
+					continue
+				}
+				s.Pruned++
+				reportPaths := []string{}
+				for _, p := range r.pathByKind {
+					reportPaths = append(reportPaths, p)
+				}
+				sort.Strings(reportPaths)
+				s.Paths = append(s.Paths, reportPaths...)
+			}
+		}
+		paths = append(paths, s.Paths...)
+		summaries = append(summaries, s)
+	}
+	if opts.DryRun || len(paths) <= 0 {
+		return summaries, nil
+	}
+
+	if len(opts.Archive) > 0 {
+		if err := archiveFiles(opts.Archive, reportHome, paths); err != nil {
+			return summaries, err
+		}
+	}
+
+	// collector slice for errors that occur in processing
+	errs := []error{}
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removeEmptyParents(reportHome, filepath.Dir(p))
+	}
+	if len(errs) > 0 {
+		return summaries, &AggregateError{len(errs) < len(paths), errs}
+	}
+	return summaries, nil
+}
+
+// archiveFiles writes the files to a new tar.gz archive at path. The archive
+// is written to a temporary file and renamed into place when complete.
+func archiveFiles(path, root string, files []string) (err error) {
+	if _, err = os.Stat(path); err == nil {
+		return &IllegalArgumentError{`archive`, `already exists: ` + path}
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), `.`+filepath.Base(path)+`.*.tmp`)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	for _, name := range files {
+		if err = addToArchive(tw, root, name); err != nil {
+			return err
+		}
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func addToArchive(tw *tar.Writer, root, name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, ``)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, name)
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(rel)
+	if err = tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, in)
+	return err
+}
+
+// removeEmptyParents removes dir and each of its parents below root for as
+// long as they are empty.
+func removeEmptyParents(root, dir string) {
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); dir != root && len(dir) > len(root); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+	}
+}
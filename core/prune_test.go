@@ -0,0 +1,131 @@
+package core
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestRetentionPolicyRetains(t *testing.T) {
+	// Sunday 2022-05-01 ends ISO week 17, Monday 2022-05-02 starts week 18
+	db := testDB(`2022-03-15-0000`, `2022-04-20-0000`, `2022-04-30-0000`,
+		`2022-05-01-0000`, `2022-05-02-0000`, `2022-05-03-0000`)
+	reports := db.Customers[`C1`].Accounts[`111`].Reports
+
+	cases := map[string]struct {
+		Policy   RetentionPolicy
+		Expected []string
+	}{
+		`Daily`: {
+			Policy:   RetentionPolicy{KeepDaily: 2},
+			Expected: []string{`2022-05-02-0000`, `2022-05-03-0000`},
+		},
+		`Weekly`: {
+			Policy:   RetentionPolicy{KeepWeekly: 2},
+			Expected: []string{`2022-05-01-0000`, `2022-05-03-0000`},
+		},
+		`Monthly`: {
+			Policy:   RetentionPolicy{KeepMonthly: 3},
+			Expected: []string{`2022-03-15-0000`, `2022-04-30-0000`, `2022-05-03-0000`},
+		},
+		`Combined`: {
+			Policy:   RetentionPolicy{KeepDaily: 1, KeepWeekly: 2, KeepMonthly: 2},
+			Expected: []string{`2022-04-30-0000`, `2022-05-01-0000`, `2022-05-03-0000`},
+		},
+		`More than available`: {
+			Policy: RetentionPolicy{KeepDaily: 30},
+			Expected: []string{`2022-03-15-0000`, `2022-04-20-0000`, `2022-04-30-0000`,
+				`2022-05-01-0000`, `2022-05-02-0000`, `2022-05-03-0000`},
+		},
+	}
+	for l, c := range cases {
+		keep := c.Policy.Retains(reports)
+		o := []string{}
+		for ts := range keep {
+			o = append(o, ts.Format(FILENAME_TIMESTAMP_LAYOUT))
+		}
+		sort.Strings(o)
+		if len(o) != len(c.Expected) {
+			t.Errorf("Case: %v, expected %v, but was %v", l, c.Expected, o)
+			continue
+		}
+		for i := range o {
+			if o[i] != c.Expected[i] {
+				t.Errorf("Case: %v, expected %v, but was %v", l, c.Expected, o)
+				break
+			}
+		}
+	}
+
+	if err := (RetentionPolicy{}).Validate(); err == nil {
+		t.Errorf(`expected an empty policy to be rejected`)
+	}
+}
+
+func TestPruneArchive(t *testing.T) {
+	home := t.TempDir()
+	keys := []string{
+		`customers/C1/reports/aws/111/2022/04/principals.2022-04-30-0714.csv`,
+		`customers/C1/reports/aws/111/2022/05/principals.2022-05-01-0714.csv`,
+	}
+	for _, k := range keys {
+		p := localPath(home, k)
+		if err := os.MkdirAll(filepath.Dir(p), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(k), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := LoadLocalDB(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := db.AccountKeys(``)
+	policy := RetentionPolicy{KeepDaily: 1}
+	archive := filepath.Join(t.TempDir(), `pruned.tar.gz`)
+
+	// a dry run reports the prunable reports and leaves them in place
+	summaries, err := Prune(db, home, accounts, policy, PruneOptions{DryRun: true, Archive: archive})
+	if err != nil {
+		t.Fatalf(`unexpected error: %v`, err)
+	}
+	if summaries[0].Kept != 1 || summaries[0].Pruned != 1 || summaries[0].Paths[0] != localPath(home, keys[0]) {
+		t.Errorf(`expected the older report to be pruned, was %v`, summaries[0])
+	}
+	if _, err = os.Stat(localPath(home, keys[0])); err != nil {
+		t.Errorf(`expected a dry run to leave the report in place, %v`, err)
+	}
+
+	if _, err = Prune(db, home, accounts, policy, PruneOptions{Archive: archive}); err != nil {
+		t.Fatalf(`unexpected error: %v`, err)
+	}
+	if _, err = os.Stat(filepath.Dir(localPath(home, keys[0]))); !os.IsNotExist(err) {
+		t.Errorf(`expected the emptied month directory to be removed, %v`, err)
+	}
+	if _, err = os.Stat(localPath(home, keys[1])); err != nil {
+		t.Errorf(`expected the latest report to be kept, %v`, err)
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := tar.NewReader(zr).Next()
+	if err != nil || header.Name != keys[0] {
+		t.Errorf(`expected the archive to contain %v, was %v, %v`, keys[0], header, err)
+	}
+
+	// archives are never overwritten
+	if _, err = Prune(db, home, accounts, policy, PruneOptions{Archive: archive}); err == nil {
+		t.Errorf(`expected an existing archive to be rejected`)
+	}
+}
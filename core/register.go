@@ -0,0 +1,75 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/k9securityio/k9-cli/core/api"
+)
+
+// RegistrationRequest describes a customer registering with k9 Security.
+type RegistrationRequest struct {
+	CustomerName          string `json:"customerName"`
+	TechnicalContactEmail string `json:"technicalContactEmail"`
+}
+
+// Validate returns an error if the customer name is empty or the technical
+// contact is not a plain email address.
+func (r RegistrationRequest) Validate() error {
+	if len(strings.TrimSpace(r.CustomerName)) == 0 {
+		return &IllegalArgumentError{`customer-name`, `a customer name is required`}
+	}
+	return ValidateEmail(r.TechnicalContactEmail)
+}
+
+// ValidateEmail returns an error unless s is a single plain email address,
+// e.g. ops@example.com without a display name.
+func ValidateEmail(s string) error {
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s || !strings.Contains(s[strings.LastIndex(s, `@`):], `.`) {
+		return &IllegalArgumentError{`technical-contact-email`, fmt.Sprintf(`invalid email address: %v`, s)}
+	}
+	return nil
+}
+
+// RegistrationResponse is returned by a successful registration.
+type RegistrationResponse struct {
+	CustomerID   string `json:"customerId"`
+	CustomerName string `json:"customerName"`
+}
+
+// Register posts a registration request to the API and returns the new
+// customer ID. A customer that is already registered results in an error
+// for which api.IsConflict is true.
+func Register(ctx context.Context, client *api.Client, registration RegistrationRequest) (RegistrationResponse, error) {
+	out := RegistrationResponse{}
+	if err := registration.Validate(); err != nil {
+		return out, err
+	}
+	if err := client.Do(ctx, http.MethodPost, `/customer`, registration, &out); err != nil {
+		return out, err
+	}
+	if len(out.CustomerID) == 0 {
+		return out, fmt.Errorf(`API response did not include a customer ID`)
+	}
+	return out, nil
+}
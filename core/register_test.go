@@ -0,0 +1,80 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/k9securityio/k9-cli/core/api"
+)
+
+func testAPIConfig() aws.Config {
+	return aws.Config{
+		Region: `us-east-1`,
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: `AKID`, SecretAccessKey: `SECRET`}, nil
+		}),
+	}
+}
+
+func TestRegister(t *testing.T) {
+	var received RegistrationRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != `/customer` {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !strings.HasPrefix(r.Header.Get(`Authorization`), `AWS4-HMAC-SHA256`) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		switch received.CustomerName {
+		case `Existing`:
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"message":"customer exists"}`))
+		case `Invalid`:
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`name not allowed`))
+		case `Broken`:
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"customerId":"C10000","customerName":"Example"}`))
+		}
+	}))
+	defer server.Close()
+
+	cases := map[string]struct {
+		Name, Email string
+		Expected    string
+		Status      int
+		Valid       bool
+	}{
+		`Registered`:    {`Example`, `ops@example.com`, `C10000`, 0, true},
+		`Conflict`:      {`Existing`, `ops@example.com`, ``, http.StatusConflict, false},
+		`Rejected`:      {`Invalid`, `ops@example.com`, ``, http.StatusUnprocessableEntity, false},
+		`No ID`:         {`Broken`, `ops@example.com`, ``, 0, false},
+		`Invalid email`: {`Example`, `ops`, ``, 0, false},
+		`Display name`:  {`Example`, `Ops <ops@example.com>`, ``, 0, false},
+		`No name`:       {` `, `ops@example.com`, ``, 0, false},
+	}
+	for l, c := range cases {
+		client, _ := api.New(testAPIConfig(), server.URL, api.WithRetries(0))
+		o, err := Register(context.Background(), client,
+			RegistrationRequest{CustomerName: c.Name, TechnicalContactEmail: c.Email})
+		if (err == nil) != c.Valid || o.CustomerID != c.Expected {
+			t.Errorf("Case: %v, expected %v, but was %v, %v", l, c.Expected, o.CustomerID, err)
+		}
+		if o := api.StatusCode(err); o != c.Status {
+			t.Errorf("Case: %v, expected status %v, but was %v", l, c.Status, err)
+		}
+	}
+	if received.TechnicalContactEmail != `ops@example.com` {
+		t.Errorf("Case: request body, expected ops@example.com, but was %v", received.TechnicalContactEmail)
+	}
+}
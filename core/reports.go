@@ -84,7 +84,7 @@ func (r Report) ResourceAccessAuditS3ObjectKey() string {
 		r.Account,
 		strconv.Itoa(r.Timestamp.Year()),
 		r.Timestamp.Format(MONTH_TIMESTAMP_LAYOUT),
-		`resource-access-audit`,
+		REPORT_TYPE_PREFIX_RESOURCE_ACCESS_AUDIT,
 		r.Timestamp.Format(FILENAME_TIMESTAMP_LAYOUT))
 }
 
@@ -322,9 +322,13 @@ func UnmarshalResourceAccessSummaryReportItem(in []string) (o ResourceAccessSumm
 }
 
 // LoadReport reads all records from the provided Reader as CSV and aggregates those records using
-// the provided Collector.
+// the provided Collector. Gzip and zstd compressed content is detected and decompressed transparently.
 func LoadReport(in io.Reader, c Collector) error {
-	rr := csv.NewReader(in)
+	dr, err := decompressingReader(in)
+	if err != nil {
+		return err
+	}
+	rr := csv.NewReader(dr)
 	records, err := rr.ReadAll()
 	if err != nil {
 		return err
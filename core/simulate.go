@@ -0,0 +1,178 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// access change actions
+const (
+	CHANGE_REMOVE_PRINCIPAL = `remove-principal`
+	CHANGE_REVOKE           = `revoke`
+	CHANGE_DELETE_RESOURCE  = `delete-resource`
+)
+
+// AccessChange is a hypothetical change to IAM configuration. Removing a
+// principal or deleting a resource removes all of its access. Revoking a
+// capability removes the principal's grants of that capability, optionally
+// limited to one service or resource.
+type AccessChange struct {
+	Action       string `json:"action"`
+	PrincipalARN string `json:"principal_arn,omitempty"`
+	Capability   string `json:"capability,omitempty"`
+	ServiceName  string `json:"service,omitempty"`
+	ResourceARN  string `json:"resource_arn,omitempty"`
+}
+
+// Validate returns an error if the fields required by the action are
+// missing.
+func (c AccessChange) Validate() error {
+	switch c.Action {
+	case CHANGE_REMOVE_PRINCIPAL:
+		if len(c.PrincipalARN) == 0 {
+			return &IllegalArgumentError{`principal_arn`, `required to remove a principal`}
+		}
+	case CHANGE_REVOKE:
+		if len(c.PrincipalARN) == 0 || len(c.Capability) == 0 {
+			return &IllegalArgumentError{`revoke`, `principal_arn and capability are required`}
+		}
+	case CHANGE_DELETE_RESOURCE:
+		if len(c.ResourceARN) == 0 {
+			return &IllegalArgumentError{`resource_arn`, `required to delete a resource`}
+		}
+	default:
+		return &IllegalArgumentError{`action`, fmt.Sprintf(`expected one of %v, %v, %v, was %v`,
+			CHANGE_REMOVE_PRINCIPAL, CHANGE_REVOKE, CHANGE_DELETE_RESOURCE, c.Action)}
+	}
+	return nil
+}
+
+func (c AccessChange) String() string {
+	switch c.Action {
+	case CHANGE_REMOVE_PRINCIPAL:
+		return fmt.Sprintf(`%v %v`, c.Action, c.PrincipalARN)
+	case CHANGE_DELETE_RESOURCE:
+		return fmt.Sprintf(`%v %v`, c.Action, c.ResourceARN)
+	}
+	out := fmt.Sprintf(`%v %v from %v`, c.Action, c.Capability, c.PrincipalARN)
+	if len(c.ServiceName) > 0 {
+		out += ` on service ` + c.ServiceName
+	}
+	if len(c.ResourceARN) > 0 {
+		out += ` on ` + c.ResourceARN
+	}
+	return out
+}
+
+// removes reports whether the change removes the grant of the capability
+// to the principal on the resource.
+func (c AccessChange) removes(principalARN, serviceName, capability, resourceARN string) bool {
+	switch c.Action {
+	case CHANGE_REMOVE_PRINCIPAL:
+		return principalARN == c.PrincipalARN
+	case CHANGE_DELETE_RESOURCE:
+		return resourceARN == c.ResourceARN
+	case CHANGE_REVOKE:
+		return principalARN == c.PrincipalARN &&
+			capability == c.Capability &&
+			(len(c.ServiceName) == 0 || serviceName == c.ServiceName) &&
+			(len(c.ResourceARN) == 0 || resourceARN == c.ResourceARN)
+	}
+	return false
+}
+
+// ParseAccessChanges reads a JSON array of changes and validates each.
+func ParseAccessChanges(in io.Reader) ([]AccessChange, error) {
+	out := []AccessChange{}
+	if err := json.NewDecoder(in).Decode(&out); err != nil {
+		return nil, err
+	}
+	for i, c := range out {
+		if err := c.Validate(); err != nil {
+			return nil, fmt.Errorf(`change %v: %w`, i+1, err)
+		}
+	}
+	return out, nil
+}
+
+// ParseRevocation parses a revocation written as
+// <capability>:<service>:<principal-arn>, where an empty service or * selects
+// every service.
+func ParseRevocation(s string) (AccessChange, error) {
+	parts := strings.SplitN(s, `:`, 3)
+	if len(parts) != 3 {
+		return AccessChange{}, &IllegalArgumentError{`revoke`, fmt.Sprintf(`expected <capability>:<service>:<principal-arn>, was %v`, s)}
+	}
+	c := AccessChange{Action: CHANGE_REVOKE, Capability: parts[0], ServiceName: parts[1], PrincipalARN: parts[2]}
+	if c.ServiceName == `*` {
+		c.ServiceName = ``
+	}
+	return c, c.Validate()
+}
+
+// AccessSnapshot holds the report items of one analysis that determine
+// access risks.
+type AccessSnapshot struct {
+	Principals      []PrincipalsReportItem
+	PrincipalAccess []PrincipalAccessSummaryReportItem
+	ResourceAccess  []ResourceAccessSummaryReportItem
+}
+
+// Apply returns a copy of the snapshot with the changes applied. The
+// snapshot is not modified.
+func (s AccessSnapshot) Apply(changes []AccessChange) AccessSnapshot {
+	removed := func(principalARN, serviceName, capability, resourceARN string) bool {
+		for _, c := range changes {
+			if c.removes(principalARN, serviceName, capability, resourceARN) {
+				return true
+			}
+		}
+		return false
+	}
+
+	out := AccessSnapshot{
+		Principals:      []PrincipalsReportItem{},
+		PrincipalAccess: []PrincipalAccessSummaryReportItem{},
+		ResourceAccess:  []ResourceAccessSummaryReportItem{},
+	}
+	for _, i := range s.Principals {
+		gone := false
+		for _, c := range changes {
+			if c.Action == CHANGE_REMOVE_PRINCIPAL && c.PrincipalARN == i.PrincipalARN {
+				gone = true
+			}
+		}
+		if !gone {
+			out.Principals = append(out.Principals, i)
+		}
+	}
+	for _, i := range s.PrincipalAccess {
+		if !removed(i.PrincipalARN, i.ServiceName, i.AccessCapability, i.ResourceARN) {
+			out.PrincipalAccess = append(out.PrincipalAccess, i)
+		}
+	}
+	for _, i := range s.ResourceAccess {
+		if !removed(i.PrincipalARN, i.ServiceName, i.AccessCapability, i.ResourceARN) {
+			out.ResourceAccess = append(out.ResourceAccess, i)
+		}
+	}
+	return out
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAccessSnapshotApply(t *testing.T) {
+	snapshot := AccessSnapshot{
+		Principals: []PrincipalsReportItem{{PrincipalARN: `p1`}, {PrincipalARN: `p2`}},
+		PrincipalAccess: []PrincipalAccessSummaryReportItem{
+			{PrincipalARN: `p1`, ServiceName: `S3`, AccessCapability: ACCESS_CAPABILITY_WRITE_DATA, ResourceARN: `r1`},
+			{PrincipalARN: `p1`, ServiceName: `S3`, AccessCapability: ACCESS_CAPABILITY_READ_DATA, ResourceARN: `r1`},
+			{PrincipalARN: `p1`, ServiceName: `KMS`, AccessCapability: ACCESS_CAPABILITY_WRITE_DATA, ResourceARN: `r2`},
+			{PrincipalARN: `p2`, ServiceName: `S3`, AccessCapability: ACCESS_CAPABILITY_WRITE_DATA, ResourceARN: `r1`},
+		},
+		ResourceAccess: []ResourceAccessSummaryReportItem{
+			{PrincipalARN: `p1`, ServiceName: `S3`, AccessCapability: ACCESS_CAPABILITY_WRITE_DATA, ResourceARN: `r1`},
+			{PrincipalARN: `p2`, ServiceName: `S3`, AccessCapability: ACCESS_CAPABILITY_WRITE_DATA, ResourceARN: `r1`},
+		},
+	}
+
+	cases := map[string]struct {
+		Changes         []AccessChange
+		Principals      int
+		PrincipalAccess int
+		ResourceAccess  int
+	}{
+		`No changes`:        {[]AccessChange{}, 2, 4, 2},
+		`Remove principal`:  {[]AccessChange{{Action: CHANGE_REMOVE_PRINCIPAL, PrincipalARN: `p1`}}, 1, 1, 1},
+		`Revoke everywhere`: {[]AccessChange{{Action: CHANGE_REVOKE, PrincipalARN: `p1`, Capability: ACCESS_CAPABILITY_WRITE_DATA}}, 2, 2, 1},
+		`Revoke on service`: {[]AccessChange{{Action: CHANGE_REVOKE, PrincipalARN: `p1`, Capability: ACCESS_CAPABILITY_WRITE_DATA, ServiceName: `KMS`}}, 2, 3, 2},
+		`Delete resource`:   {[]AccessChange{{Action: CHANGE_DELETE_RESOURCE, ResourceARN: `r1`}}, 2, 1, 0},
+	}
+	for l, c := range cases {
+		o := snapshot.Apply(c.Changes)
+		if len(o.Principals) != c.Principals || len(o.PrincipalAccess) != c.PrincipalAccess || len(o.ResourceAccess) != c.ResourceAccess {
+			t.Errorf("Case: %v, expected %v/%v/%v, but was %v/%v/%v", l,
+				c.Principals, c.PrincipalAccess, c.ResourceAccess,
+				len(o.Principals), len(o.PrincipalAccess), len(o.ResourceAccess))
+		}
+	}
+	if len(snapshot.PrincipalAccess) != 4 {
+		t.Errorf(`expected the original snapshot to be unchanged`)
+	}
+}
+
+func TestParseAccessChanges(t *testing.T) {
+	cases := map[string]struct {
+		Input    string
+		Expected int
+		Valid    bool
+	}{
+		`Valid`: {`[{"action":"remove-principal","principal_arn":"p1"},
+			{"action":"revoke","principal_arn":"p1","capability":"write-data","service":"S3"},
+			{"action":"delete-resource","resource_arn":"r1"}]`, 3, true},
+		`Unknown action`:   {`[{"action":"grant","principal_arn":"p1"}]`, 0, false},
+		`Missing resource`: {`[{"action":"delete-resource"}]`, 0, false},
+		`Not json`:         {`remove p1`, 0, false},
+	}
+	for l, c := range cases {
+		o, err := ParseAccessChanges(strings.NewReader(c.Input))
+		if (err == nil) != c.Valid || len(o) != c.Expected {
+			t.Errorf("Case: %v, expected %v changes, but was %v, %v", l, c.Expected, len(o), err)
+		}
+	}
+}
+
+func TestParseRevocation(t *testing.T) {
+	cases := map[string]struct {
+		Input    string
+		Expected AccessChange
+		Valid    bool
+	}{
+		`With service`: {`write-data:S3:arn:aws:iam::111:role/ci`,
+			AccessChange{Action: CHANGE_REVOKE, Capability: `write-data`, ServiceName: `S3`, PrincipalARN: `arn:aws:iam::111:role/ci`}, true},
+		`Any service`: {`read-data:*:arn:aws:iam::111:role/ci`,
+			AccessChange{Action: CHANGE_REVOKE, Capability: `read-data`, PrincipalARN: `arn:aws:iam::111:role/ci`}, true},
+		`Missing principal`: {`read-data:S3:`, AccessChange{}, false},
+		`Too short`:         {`read-data`, AccessChange{}, false},
+	}
+	for l, c := range cases {
+		o, err := ParseRevocation(c.Input)
+		if (err == nil) != c.Valid || (c.Valid && o != c.Expected) {
+			t.Errorf("Case: %v, expected %v, but was %v, %v", l, c.Expected, o, err)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// STORE_SCHEME_* prefix report store locations, a location without a
+// scheme is the name of an S3 bucket.
+const (
+	STORE_SCHEME_S3   = `s3://`
+	STORE_SCHEME_FILE = `file://`
+)
+
+// ReportStore is a location that k9 reports are delivered to and synced
+// from, such as the secure inbox bucket or a mirror of it. Keys follow the
+// layout of the secure inbox, e.g. customers/C1/reports/aws/111/...
+type ReportStore interface {
+	// Location identifies the store in messages, e.g. s3://bucket.
+	Location() string
+	// ListObjects returns the objects whose keys start with prefix.
+	ListObjects(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// ListPrefixes returns the distinct key prefixes one level below
+	// prefix, each ending with REPORT_LOCATION_DELIMITER.
+	ListPrefixes(ctx context.Context, prefix string) ([]string, error)
+	// Download writes the content of the object to w and returns its size,
+	// along with the hex encoded MD5 digest of the content when the store
+	// knows it. When remote has an ETag the download fails if the object has
+	// since been replaced.
+	Download(ctx context.Context, w io.WriterAt, remote ObjectInfo) (int64, string, error)
+}
+
+// S3API is the subset of the S3 client used by an S3Store.
+type S3API interface {
+	s3.ListObjectsV2APIClient
+	manager.DownloadAPIClient
+}
+
+// S3Store is a ReportStore in an S3 bucket.
+type S3Store struct {
+	client S3API
+	bucket string
+}
+
+// NewS3Store returns a ReportStore for the bucket.
+func NewS3Store(client S3API, bucket string) *S3Store {
+	return &S3Store{client: client, bucket: bucket}
+}
+
+// S3Options configures the S3 client of a store, e.g. to reach an
+// S3-compatible service such as MinIO.
+type S3Options struct {
+	// EndpointURL replaces the AWS S3 endpoint, e.g. http://localhost:9000.
+	EndpointURL string
+	// PathStyle addresses buckets in the URL path rather than the host
+	// name, as most S3-compatible services require.
+	PathStyle bool
+}
+
+// NewS3Client returns an S3 client for the configuration and options.
+func NewS3Client(cfg aws.Config, o S3Options) *s3.Client {
+	return s3.NewFromConfig(cfg, func(so *s3.Options) {
+		if len(o.EndpointURL) > 0 {
+			so.EndpointResolver = s3.EndpointResolverFromURL(o.EndpointURL)
+		}
+		so.UsePathStyle = o.PathStyle
+	})
+}
+
+func (s *S3Store) Location() string {
+	return STORE_SCHEME_S3 + s.bucket
+}
+
+func (s *S3Store) ListObjects(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	out := []ObjectInfo{}
+	pages := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{Bucket: &s.bucket, Prefix: &prefix})
+	for pages.HasMorePages() {
+		resp, err := pages.NextPage(ctx)
+		if err != nil {
+			return out, err
+		}
+		for _, v := range resp.Contents {
+			info := ObjectInfo{Key: aws.ToString(v.Key), ETag: aws.ToString(v.ETag), Size: v.Size}
+			if v.LastModified != nil {
+				info.LastModified = *v.LastModified
+			}
+			out = append(out, info)
+		}
+	}
+	return out, nil
+}
+
+func (s *S3Store) ListPrefixes(ctx context.Context, prefix string) ([]string, error) {
+	out := []string{}
+	pages := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket:    &s.bucket,
+		Prefix:    &prefix,
+		Delimiter: &REPORT_LOCATION_DELIMITER})
+	for pages.HasMorePages() {
+		resp, err := pages.NextPage(ctx)
+		if err != nil {
+			return out, err
+		}
+		for _, p := range resp.CommonPrefixes {
+			out = append(out, aws.ToString(p.Prefix))
+		}
+	}
+	return out, nil
+}
+
+// Download reports the ETag as the MD5 digest of the content for objects
+// uploaded in a single part without KMS or customer provided keys.
+func (s *S3Store) Download(ctx context.Context, w io.WriterAt, remote ObjectInfo) (int64, string, error) {
+	input := &s3.GetObjectInput{Bucket: &s.bucket, Key: &remote.Key}
+	if len(remote.ETag) > 0 {
+		// fail rather than mix content from a concurrently replaced object
+		input.IfMatch = &remote.ETag
+	}
+	client := &encryptionRecorder{DownloadAPIClient: s.client}
+	n, err := manager.NewDownloader(client).Download(ctx, w, input)
+	if err != nil || client.keyed {
+		return n, ``, err
+	}
+	checksum, _ := etagMD5(remote.ETag)
+	return n, checksum, nil
+}
+
+// etagMD5 returns the MD5 digest held by the ETag of an object uploaded in a
+// single part. The ETags of multipart uploads are not digests of the content
+// and are reported as not ok.
+func etagMD5(etag string) (string, bool) {
+	etag = strings.ToLower(strings.Trim(etag, `"`))
+	if len(etag) != hex.EncodedLen(md5.Size) {
+		return ``, false
+	}
+	if _, err := hex.DecodeString(etag); err != nil {
+		return ``, false
+	}
+	return etag, true
+}
+
+// encryptionRecorder records whether any GetObject response was encrypted
+// with KMS or a customer provided key, the ETags of such objects are not
+// digests of their content.
+type encryptionRecorder struct {
+	manager.DownloadAPIClient
+	mu    sync.Mutex
+	keyed bool
+}
+
+func (r *encryptionRecorder) GetObject(ctx context.Context, in *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	out, err := r.DownloadAPIClient.GetObject(ctx, in, optFns...)
+	if err == nil && (strings.HasPrefix(string(out.ServerSideEncryption), string(types.ServerSideEncryptionAwsKms)) ||
+		out.SSECustomerAlgorithm != nil) {
+		r.mu.Lock()
+		r.keyed = true
+		r.mu.Unlock()
+	}
+	return out, err
+}
+
+// LocalStore is a ReportStore in a local directory with the layout of the
+// secure inbox, e.g. a mirror of the inbox on a shared file system. Objects
+// have no ETag, they are identified by size and modification time.
+type LocalStore struct {
+	root string
+}
+
+// NewLocalStore returns a ReportStore for the directory at root.
+func NewLocalStore(root string) *LocalStore {
+	return &LocalStore{root: root}
+}
+
+func (s *LocalStore) Location() string {
+	return STORE_SCHEME_FILE + filepath.ToSlash(s.root)
+}
+
+func (s *LocalStore) ListObjects(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	out := []ObjectInfo{}
+	// walk from the deepest directory containing the prefix
+	dir := prefix[:strings.LastIndex(prefix, REPORT_LOCATION_DELIMITER)+1]
+	err := filepath.WalkDir(filepath.Join(s.root, filepath.FromSlash(dir)), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		// skip hidden files such as partial copies
+		if d.IsDir() || strings.HasPrefix(d.Name(), `.`) {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		out = append(out, ObjectInfo{Key: key, Size: info.Size(), LastModified: info.ModTime().UTC()})
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return out, nil
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, err
+}
+
+func (s *LocalStore) ListPrefixes(ctx context.Context, prefix string) ([]string, error) {
+	out := []string{}
+	entries, err := os.ReadDir(filepath.Join(s.root, filepath.FromSlash(prefix)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return out, nil
+	} else if err != nil {
+		return out, err
+	}
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), `.`) {
+			out = append(out, prefix+e.Name()+REPORT_LOCATION_DELIMITER)
+		}
+	}
+	return out, nil
+}
+
+func (s *LocalStore) Download(ctx context.Context, w io.WriterAt, remote ObjectInfo) (int64, string, error) {
+	n, err := s.copyTo(ctx, w, remote.Key)
+	return n, ``, err
+}
+
+// copyTo writes the content of the file at key to w and returns its size.
+func (s *LocalStore) copyTo(ctx context.Context, w io.WriterAt, key string) (int64, error) {
+	f, err := os.Open(filepath.Join(s.root, filepath.FromSlash(key)))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	buf := make([]byte, 256*1024)
+	var n int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		r, err := f.Read(buf)
+		if r > 0 {
+			if _, werr := w.WriteAt(buf[:r], n); werr != nil {
+				return n, werr
+			}
+			n += int64(r)
+		}
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+	}
+}
+
+// OpenReportStore returns the ReportStore at the location, one of a bucket
+// name, an s3://bucket URL, or a file:// URL of a local directory.
+func OpenReportStore(cfg aws.Config, location string, o S3Options) (ReportStore, error) {
+	switch {
+	case strings.HasPrefix(location, STORE_SCHEME_FILE):
+		root := strings.TrimPrefix(location, STORE_SCHEME_FILE)
+		if len(root) == 0 {
+			return nil, &IllegalArgumentError{`store`, `a file location needs a directory, was ` + location}
+		}
+		return NewLocalStore(filepath.FromSlash(root)), nil
+	case strings.Contains(location, `://`) && !strings.HasPrefix(location, STORE_SCHEME_S3):
+		return nil, &IllegalArgumentError{`store`, `unsupported location ` + location}
+	}
+	bucket := strings.TrimSuffix(strings.TrimPrefix(location, STORE_SCHEME_S3), REPORT_LOCATION_DELIMITER)
+	if len(bucket) == 0 {
+		return nil, &IllegalArgumentError{`store`, `a bucket is required`}
+	}
+	return NewS3Store(NewS3Client(cfg, o), bucket), nil
+}
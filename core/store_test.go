@@ -0,0 +1,217 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	storePrincipals = `customers/C1/reports/aws/111/2022/05/principals.2022-05-01-0714.csv`
+	storeResources  = `customers/C1/reports/aws/111/2022/05/resources.2022-05-01-0714.csv`
+	storeOther      = `customers/C2/reports/aws/222/2022/05/principals.2022-05-02-0900.csv`
+)
+
+// storeObjects are the contents of the stores under test.
+var storeObjects = map[string]string{
+	storePrincipals: `principals`,
+	storeResources:  `resources`,
+	storeOther:      `other`,
+}
+
+// s3StandIn serves the objects like an S3-compatible service that uses
+// path-style addressing, e.g. MinIO, for a single bucket.
+func s3StandIn(t *testing.T, bucket string, objects map[string]string) *httptest.Server {
+	type content struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int
+	}
+	type result struct {
+		XMLName        xml.Name `xml:"ListBucketResult"`
+		Name           string
+		Prefix         string
+		IsTruncated    bool
+		Contents       []content
+		CommonPrefixes []struct{ Prefix string }
+	}
+	modified := time.Date(2022, 5, 1, 7, 14, 0, 0, time.UTC)
+	etag := func(key string) string { return fmt.Sprintf(`"%x"`, len(key)) }
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, `/`+bucket) {
+			t.Errorf(`expected a path-style request for bucket %v, was %v %v`, bucket, r.Host, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, `/`+bucket), `/`)
+		if len(key) == 0 {
+			prefix, delimiter := r.URL.Query().Get(`prefix`), r.URL.Query().Get(`delimiter`)
+			out := result{Name: bucket, Prefix: prefix}
+			seen := map[string]bool{}
+			keys := []string{}
+			for k := range objects {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if !strings.HasPrefix(k, prefix) {
+					continue
+				}
+				if i := strings.Index(k[len(prefix):], delimiter); len(delimiter) > 0 && i >= 0 {
+					p := k[:len(prefix)+i+1]
+					if !seen[p] {
+						seen[p] = true
+						out.CommonPrefixes = append(out.CommonPrefixes, struct{ Prefix string }{p})
+					}
+					continue
+				}
+				out.Contents = append(out.Contents, content{k, modified.Format(time.RFC3339), etag(k), len(objects[k])})
+			}
+			w.Header().Set(`Content-Type`, `application/xml`)
+			xml.NewEncoder(w).Encode(out)
+			return
+		}
+		body, ok := objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<Error><Code>NoSuchKey</Code></Error>`))
+			return
+		}
+		w.Header().Set(`ETag`, etag(key))
+		http.ServeContent(w, r, key, modified, strings.NewReader(body))
+	}))
+}
+
+func TestLocalStore(t *testing.T) {
+	root := t.TempDir()
+	for k, v := range storeObjects {
+		path := filepath.Join(root, filepath.FromSlash(k))
+		os.MkdirAll(filepath.Dir(path), 0750)
+		os.WriteFile(path, []byte(v), 0640)
+	}
+	os.WriteFile(filepath.Join(filepath.Dir(filepath.Join(root, filepath.FromSlash(storeOther))), `.partial.tmp`), nil, 0640)
+	store := NewLocalStore(root)
+	ctx := context.Background()
+
+	cases := map[string]struct {
+		Prefix   string
+		Expected []string
+	}{
+		`All`:      {``, []string{storePrincipals, storeResources, storeOther}},
+		`Account`:  {`customers/C1/reports/aws/111/`, []string{storePrincipals, storeResources}},
+		`Partial`:  {`customers/C1/reports/aws/111/2022/05/res`, []string{storeResources}},
+		`Missing`:  {`customers/C3/`, []string{}},
+		`Customer`: {`customers/C2/`, []string{storeOther}},
+	}
+	for l, c := range cases {
+		objects, err := store.ListObjects(ctx, c.Prefix)
+		if err != nil {
+			t.Errorf("Case: %v, unexpected error: %v", l, err)
+			continue
+		}
+		keys := []string{}
+		for _, o := range objects {
+			keys = append(keys, o.Key)
+			if o.Size != int64(len(storeObjects[o.Key])) {
+				t.Errorf("Case: %v, expected size %v for %v, but was %v", l, len(storeObjects[o.Key]), o.Key, o.Size)
+			}
+		}
+		sort.Strings(keys)
+		sort.Strings(c.Expected)
+		if !reflect.DeepEqual(keys, c.Expected) {
+			t.Errorf("Case: %v, expected %v, but was %v", l, c.Expected, keys)
+		}
+	}
+
+	prefixes, err := store.ListPrefixes(ctx, REPORT_LOCATION_PREFIX)
+	if expected := []string{`customers/C1/`, `customers/C2/`}; err != nil || !reflect.DeepEqual(prefixes, expected) {
+		t.Errorf(`expected prefixes %v, but was %v, %v`, expected, prefixes, err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err = List(buf, store, `C1`, ``); err != nil || buf.String() != "111\n" {
+		t.Errorf(`expected to list account 111, but was %q, %v`, buf.String(), err)
+	}
+}
+
+func TestS3CompatibleStoreSync(t *testing.T) {
+	server := s3StandIn(t, `inbox`, storeObjects)
+	defer server.Close()
+
+	store, err := OpenReportStore(testAPIConfig(), `s3://inbox`, S3Options{EndpointURL: server.URL, PathStyle: true})
+	if err != nil {
+		t.Fatalf(`unexpected error: %v`, err)
+	}
+	if store.Location() != `s3://inbox` {
+		t.Errorf(`expected location s3://inbox, was %v`, store.Location())
+	}
+
+	buf := &bytes.Buffer{}
+	if err = List(buf, store, ``, ``); err != nil || buf.String() != "C1\nC2\n" {
+		t.Errorf(`expected to list customers C1 and C2, but was %q, %v`, buf.String(), err)
+	}
+
+	remote, err := LoadStoreDB(context.Background(), store, ReportTypeSelector{EXT_CSV})
+	if err != nil {
+		t.Fatalf(`unexpected error loading the store: %v`, err)
+	}
+	if keys := remote.AccountKeys(``); len(keys) != 2 {
+		t.Fatalf(`expected 2 accounts in the store, was %v`, keys)
+	}
+
+	home := t.TempDir()
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	summaries, err := SyncAccounts(stdout, stderr, remote, store, home, remote.AccountKeys(`C1`), SyncOptions{Concurrency: 2})
+	if err != nil || summaries[0].Downloaded != 2 {
+		t.Fatalf(`expected 2 reports to be downloaded, was %v, %v`, summaries, err)
+	}
+	for _, k := range []string{storePrincipals, storeResources} {
+		if b, err := os.ReadFile(filepath.Join(home, filepath.FromSlash(k))); err != nil || string(b) != storeObjects[k] {
+			t.Errorf(`expected %v to contain %q, was %q, %v`, k, storeObjects[k], b, err)
+		}
+	}
+
+	// the ETag and modification time recorded in the manifest skip
+	// unchanged reports
+	summaries, err = SyncAccounts(stdout, stderr, remote, store, home, remote.AccountKeys(`C1`), SyncOptions{Concurrency: 2})
+	if err != nil || summaries[0].Skipped != 2 {
+		t.Errorf(`expected 2 reports to be skipped, was %v, %v`, summaries, err)
+	}
+}
+
+func TestOpenReportStore(t *testing.T) {
+	cases := map[string]struct {
+		Location string
+		Expected string
+		Err      bool
+	}{
+		`Bucket`:       {`k9-inbox`, `s3://k9-inbox`, false},
+		`S3 URL`:       {`s3://k9-inbox/`, `s3://k9-inbox`, false},
+		`Directory`:    {`file:///mnt/k9-mirror`, `file:///mnt/k9-mirror`, false},
+		`Empty`:        {``, ``, true},
+		`No directory`: {`file://`, ``, true},
+		`Unsupported`:  {`gs://k9-inbox`, ``, true},
+	}
+	for l, c := range cases {
+		store, err := OpenReportStore(testAPIConfig(), c.Location, S3Options{})
+		if (err != nil) != c.Err {
+			t.Errorf("Case: %v, unexpected error state: %v", l, err)
+			continue
+		}
+		if err == nil && store.Location() != c.Expected {
+			t.Errorf("Case: %v, expected %v, but was %v", l, c.Expected, store.Location())
+		}
+	}
+}
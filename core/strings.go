@@ -37,8 +37,18 @@ const (
 	REPORT_TYPE_PREFIX_RESOURCES                  = `resources`
 	REPORT_TYPE_PREFIX_PRINCIPAL_ACCESS_SUMMARIES = `principal-access-summaries`
 	REPORT_TYPE_PREFIX_RESOURCE_ACCESS_SUMMARIES  = `resource-access-summaries`
+	REPORT_TYPE_PREFIX_RESOURCE_ACCESS_AUDIT      = `resource-access-audit`
 )
 
+// ReportKinds lists every known report file name prefix.
+var ReportKinds = []string{
+	REPORT_TYPE_PREFIX_PRINCIPALS,
+	REPORT_TYPE_PREFIX_RESOURCES,
+	REPORT_TYPE_PREFIX_PRINCIPAL_ACCESS_SUMMARIES,
+	REPORT_TYPE_PREFIX_RESOURCE_ACCESS_SUMMARIES,
+	REPORT_TYPE_PREFIX_RESOURCE_ACCESS_AUDIT,
+}
+
 const (
 	_ = iota
 	FILENAME_POSITION_CID
@@ -18,71 +18,434 @@ package core
 
 import (
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 )
 
+// AccountKey identifies a single customer account.
+type AccountKey struct {
+	CustomerID string
+	Account    string
+}
+
+// SyncSummary tallies the outcome of a sync for a single account.
+type SyncSummary struct {
+	CustomerID string `csv:"customer_id" json:"customer_id"`
+	Account    string `csv:"account" json:"account"`
+	Downloaded int    `csv:"downloaded" json:"downloaded"`
+	Skipped    int    `csv:"skipped" json:"skipped"`
+	Failed     int    `csv:"failed" json:"failed"`
+}
+
+// SyncOptions adjust which reports are synced and how they are retrieved.
+type SyncOptions struct {
+	Filter ReportFilter
+	// Concurrency is the number of reports downloaded at the same time.
+	Concurrency int
+	// Retries is the number of additional attempts made to download a report
+	// after a transient failure.
+	Retries int
+	DryRun  bool
+	Verbose bool
+	// MaxBandwidth limits the combined download rate in bytes per second,
+	// zero is unlimited.
+	MaxBandwidth int64
+	// Progress receives progress events, if set.
+	Progress ProgressReporter
+	// Compression is the compression applied to the local copies of the
+	// reports, one of COMPRESSION_NONE, COMPRESSION_GZIP, or
+	// COMPRESSION_ZSTD. Reports are verified before they are compressed.
+	Compression string
+}
+
+// syncRetryBaseDelay is the delay before the first retry of a failed
+// download. The delay doubles for each subsequent attempt.
+var syncRetryBaseDelay = 500 * time.Millisecond
+
+// SyncError records the failure to sync a single report.
+type SyncError struct {
+	Key string
+	Err error
+}
+
+func (e *SyncError) Error() string {
+	return fmt.Sprintf(`%v, %v`, e.Key, e.Err)
+}
+
+func (e *SyncError) Unwrap() error {
+	return e.Err
+}
+
+// incompleteDownloadError indicates that fewer bytes were received than the
+// remote object size. It is retryable.
+type incompleteDownloadError struct {
+	expected, received int64
+}
+
+func (e *incompleteDownloadError) Error() string {
+	return fmt.Sprintf(`incomplete download, expected %v bytes but received %v`, e.expected, e.received)
+}
+
+func (e *incompleteDownloadError) RetryableError() bool {
+	return true
+}
+
+// checksumMismatchError indicates that the MD5 digest of the received
+// content does not match the digest reported by the store. It is retryable.
+type checksumMismatchError struct {
+	expected, received string
+}
+
+func (e *checksumMismatchError) Error() string {
+	return fmt.Sprintf(`checksum mismatch, expected MD5 %v but received %v`, e.expected, e.received)
+}
+
+func (e *checksumMismatchError) RetryableError() bool {
+	return true
+}
+
+// Sync downloads the reports for the specified customer account that are
+// missing or out of date in the local database rooted at reportHome. A
+// report is considered up to date when the manifest for the account records
+// the same ETag, size, and modification time as the remote object and the
+// local file is intact.
+// Reports are downloaded to a temporary file and moved into place only after
+// the content has been verified, so an interrupted sync never leaves a
+// partial report behind. Only the reports selected by the filter are
+// considered.
 func Sync(stdout, stderr io.Writer,
 	remote DB,
-	downloader *manager.Downloader,
-	bucket, customerID, account string,
-	concurrency int,
-	dryrun, verbose bool) error {
+	store ReportStore,
+	reportHome, customerID, account string,
+	opts SyncOptions) error {
 
-	// TODO input validation
+	_, err := SyncAccounts(stdout, stderr, remote, store, reportHome,
+		[]AccountKey{{CustomerID: customerID, Account: account}}, opts)
+	return err
+}
+
+// SyncAccounts performs a Sync for each of the provided accounts. Downloads
+// for all accounts share a single pool of at most opts.Concurrency workers,
+// and transient failures are retried with exponential backoff. The returned
+// summaries are in the same order as the provided accounts. If any report
+// fails to sync the returned error is an *AggregateError containing a
+// *SyncError for each failed report.
+func SyncAccounts(stdout, stderr io.Writer,
+	remote DB,
+	store ReportStore,
+	reportHome string,
+	accounts []AccountKey,
+	opts SyncOptions) ([]SyncSummary, error) {
+
+	if opts.Concurrency < 1 {
+		return nil, &IllegalArgumentError{`concurrency`, `must be at least 1`}
+	}
+	if opts.Retries < 0 {
+		return nil, &IllegalArgumentError{`retries`, `must not be negative`}
+	}
+	ext, err := CompressionExtension(opts.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	type job struct {
+		index int
+		info  ObjectInfo
+	}
+	type result struct {
+		job
+		entry ManifestEntry
+		err   error
+	}
 
 	// collector slice for errors that occur in processing
 	errs := []error{}
 
-	// setup concurrent downloading harness
-	semaphore := make(chan int, concurrency) // buffered channel
-	download := func(key string, w WriterAtCloser) {
-		defer func() {
-			w.Close()
-			<-semaphore
+	summaries := make([]SyncSummary, len(accounts))
+	manifests := make([]*Manifest, len(accounts))
+	for i, a := range accounts {
+		summaries[i] = SyncSummary{CustomerID: a.CustomerID, Account: a.Account}
+		manifest, err := LoadManifest(ManifestPathForCustomerAccount(reportHome, a.CustomerID, a.Account))
+		if err != nil {
+			errs = append(errs, err)
+			summaries[i].Failed++
+			continue
+		}
+		manifests[i] = manifest
+	}
+
+	// select the reports that need to be downloaded up front so that the
+	// progress totals are known before the first download starts
+	pending := []job{}
+	skipped := []job{}
+	var pendingBytes int64
+	for i, a := range accounts {
+		if manifests[i] == nil {
+			continue
+		}
+		for _, r := range remote.PathsByCustomerAccount(a.CustomerID, a.Account, opts.Filter) {
+			info, ok := remote.Objects[r]
+			if !ok {
+				info = ObjectInfo{Key: r, Size: -1}
+			}
+			if manifests[i].IsCurrent(info, localReportPath(reportHome, r, ext)) {
+				skipped = append(skipped, job{index: i, info: info})
+				continue
+			}
+			pending = append(pending, job{index: i, info: info})
+			if info.Size > 0 {
+				pendingBytes += info.Size
+			}
+		}
+	}
+	for _, j := range skipped {
+		summaries[j.index].Skipped++
+	}
+	progress := newSyncProgress(opts.Progress)
+	progress.start(len(pending), len(skipped), pendingBytes)
+	limiter := newBandwidthLimiter(opts.MaxBandwidth)
+
+	// setup the worker pool, results are aggregated on this goroutine
+	jobs := make(chan job)
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				r := result{job: j}
+				if !opts.DryRun {
+					r.entry, r.err = downloadObjectWithRetries(context.TODO(), store,
+						j.info, localReportPath(reportHome, j.info.Key, ext), opts.Compression,
+						opts.Retries, limiter, progress)
+				}
+				progress.fileDone(j.info.Key, r.err)
+				results <- r
+			}
 		}()
-		if !dryrun {
-			if _, err := downloader.Download(
-				context.TODO(), w, &s3.GetObjectInput{Bucket: &bucket, Key: &key}); err != nil {
-				// Don't do this... append is not synchronized
-				// errs = append(errs, err)
-				// TODO use a channel to aggregate the errors
-				fmt.Fprintln(stderr, err)
+	}
+	go func() {
+		defer close(jobs)
+		for _, j := range pending {
+			jobs <- j
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for r := range results {
+		switch {
+		case r.err != nil:
+			summaries[r.index].Failed++
+			errs = append(errs, &SyncError{Key: r.info.Key, Err: r.err})
+		default:
+			summaries[r.index].Downloaded++
+			if !opts.DryRun {
+				// remove a copy stored with a different compression
+				if prev, ok := manifests[r.index].Get(r.info.Key); ok && prev.Compression != r.entry.Compression {
+					if prevExt, err := CompressionExtension(prev.Compression); err == nil {
+						os.Remove(localReportPath(reportHome, r.info.Key, prevExt))
+					}
+				}
+				manifests[r.index].Put(r.entry)
+			}
+			if opts.Verbose && opts.Progress == nil {
+				fmt.Fprintln(stderr, r.info.Key)
 			}
 		}
-		if verbose {
-			fmt.Fprintln(stderr, key)
+	}
+
+	progress.finish()
+
+	succeeded := false
+	for i, a := range accounts {
+		if summaries[i].Downloaded > 0 || summaries[i].Skipped > 0 {
+			succeeded = true
 		}
+		if opts.Verbose {
+			fmt.Fprintf(stderr, "Skipped %v unchanged reports for %v account %v\n",
+				summaries[i].Skipped, a.CustomerID, a.Account)
+		}
+		if !opts.DryRun && manifests[i] != nil {
+			if err := manifests[i].Save(ManifestPathForCustomerAccount(reportHome, a.CustomerID, a.Account)); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return summaries, &AggregateError{succeeded, errs}
 	}
+	return summaries, nil
+}
 
-	// get the target payloads
-	pathsToSync := remote.AllPathsByCustomerAccount(customerID, account)
+// localPath returns the location of a report object key under the provided
+// report home.
+func localPath(reportHome, key string) string {
+	return filepath.Join(reportHome, filepath.FromSlash(key))
+}
 
-	for _, r := range pathsToSync {
-		semaphore <- 1
-		folder, _ := filepath.Split(r)
-		if err := os.MkdirAll(folder, 0750); err != nil {
-			errs = append(errs, err)
-			continue
+// localReportPath returns the location of a report object key stored with
+// the compression identified by the filename extension ext.
+func localReportPath(reportHome, key, ext string) string {
+	if len(ext) > 0 {
+		return localPath(reportHome, key) + `.` + ext
+	}
+	return localPath(reportHome, key)
+}
+
+// downloadObjectWithRetries calls downloadObject until it succeeds, fails
+// with an error that is not transient, or the retries are exhausted.
+func downloadObjectWithRetries(ctx context.Context,
+	store ReportStore,
+	remote ObjectInfo,
+	path, compression string,
+	retries int,
+	limiter *bandwidthLimiter,
+	progress *syncProgress) (ManifestEntry, error) {
+
+	retryables := retry.IsErrorRetryables(retry.DefaultRetryables)
+	delay := syncRetryBaseDelay
+	for attempt := 0; ; attempt++ {
+		entry, err := downloadObject(ctx, store, remote, path, compression, limiter, progress)
+		if err == nil || attempt >= retries || retryables.IsErrorRetryable(err) != aws.TrueTernary {
+			return entry, err
+		}
+		select {
+		case <-ctx.Done():
+			return entry, err
+		case <-time.After(delay):
 		}
-		f, err := os.Create(r)
+		delay *= 2
+	}
+}
+
+// downloadObject retrieves a single object into a temporary file next to the
+// destination path, verifies it against the remote metadata, and renames it
+// into place. A remote size less than zero skips the size verification, and
+// the content is verified against the MD5 digest when the store reports one.
+// Writes are paced by the limiter and counted towards the progress, the
+// count is retracted if the download fails. Verified content is compressed
+// with the named compression before it is moved into place.
+func downloadObject(ctx context.Context,
+	store ReportStore,
+	remote ObjectInfo,
+	path, compression string,
+	limiter *bandwidthLimiter,
+	progress *syncProgress) (entry ManifestEntry, err error) {
+
+	entry = ManifestEntry{ObjectInfo: remote}
+	folder, base := filepath.Split(path)
+	if err := os.MkdirAll(folder, 0750); err != nil {
+		return entry, err
+	}
+	// hidden temporary files are ignored when loading the local database
+	f, err := os.CreateTemp(folder, `.`+base+`.*.tmp`)
+	if err != nil {
+		return entry, err
+	}
+	defer os.Remove(f.Name())
+
+	w := &meteredWriterAt{w: f, limiter: limiter, progress: progress}
+	defer func() {
 		if err != nil {
-			errs = append(errs, err)
-			continue
+			w.discard()
 		}
-		go download(r, f)
+	}()
+	n, checksum, err := store.Download(ctx, w, remote)
+	if err != nil {
+		f.Close()
+		return entry, err
+	}
+	if remote.Size >= 0 && n != remote.Size {
+		f.Close()
+		return entry, &incompleteDownloadError{expected: remote.Size, received: n}
 	}
+	entry.Size = n
 
-	// TODO if any errors during retrival or writing aggregate those into an aggregate error
-	if len(errs) > 0 {
-		return &AggregateError{true, errs}
+	// verify the content against the ETag and record a digest of it
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return entry, err
+	}
+	h, m := sha256.New(), md5.New()
+	if _, err = io.Copy(io.MultiWriter(h, m), f); err != nil {
+		f.Close()
+		return entry, err
+	}
+	if len(checksum) > 0 {
+		if received := hex.EncodeToString(m.Sum(nil)); received != checksum {
+			f.Close()
+			return entry, &checksumMismatchError{expected: checksum, received: received}
+		}
+	}
+	entry.SHA256 = hex.EncodeToString(h.Sum(nil))
+
+	if len(compression) > 0 && compression != COMPRESSION_NONE {
+		f.Close()
+		entry.Compression = compression
+		entry.LocalSize, err = compressFile(f.Name(), path, compression)
+		return entry, err
+	}
+
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return entry, err
+	}
+	if err = f.Close(); err != nil {
+		return entry, err
+	}
+	if err = os.Rename(f.Name(), path); err != nil {
+		return entry, err
+	}
+	return entry, nil
+}
+
+// compressFile compresses the file at src into a temporary file next to
+// dest and renames it into place, returning the compressed size.
+func compressFile(src, dest, compression string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	folder, base := filepath.Split(dest)
+	f, err := os.CreateTemp(folder, `.`+base+`.*.tmp`)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	if err = compressTo(f, in, compression); err != nil {
+		f.Close()
+		return 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err = f.Close(); err != nil {
+		return 0, err
 	}
-	return nil
+	return info.Size(), os.Rename(f.Name(), dest)
 }
 
 type WriterAtCloser interface {
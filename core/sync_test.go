@@ -0,0 +1,338 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+type transientError struct{}
+
+func (transientError) Error() string        { return `transient` }
+func (transientError) RetryableError() bool { return true }
+
+// fakeS3 serves GetObject requests from memory. Keys listed in failures fail
+// with the associated error the specified number of times before succeeding.
+// Objects are reported as encrypted with the encryption, if set.
+type fakeS3 struct {
+	mu         sync.Mutex
+	objects    map[string][]byte
+	failures   map[string]int
+	failWith   map[string]error
+	calls      map[string]int
+	encryption types.ServerSideEncryption
+}
+
+func (f *fakeS3) ListObjectsV2(ctx context.Context, in *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &s3.ListObjectsV2Output{}
+	for k, b := range f.objects {
+		if strings.HasPrefix(k, aws.ToString(in.Prefix)) {
+			out.Contents = append(out.Contents, types.Object{Key: aws.String(k), Size: int64(len(b))})
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeS3) GetObject(ctx context.Context, in *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := *in.Key
+	f.calls[key]++
+	if f.failures[key] > 0 {
+		f.failures[key]--
+		return nil, f.failWith[key]
+	}
+	b, ok := f.objects[key]
+	if !ok {
+		return nil, errors.New(`no such key`)
+	}
+	return &s3.GetObjectOutput{
+		Body:                 io.NopCloser(bytes.NewReader(b)),
+		ContentLength:        int64(len(b)),
+		ServerSideEncryption: f.encryption,
+	}, nil
+}
+
+// recordingReporter keeps every progress event it receives.
+type recordingReporter struct {
+	events []ProgressEvent
+}
+
+func (r *recordingReporter) Report(e ProgressEvent) {
+	r.events = append(r.events, e)
+}
+
+func TestSyncAccounts(t *testing.T) {
+	home := t.TempDir()
+	syncRetryBaseDelay = time.Millisecond
+
+	const (
+		good      = `customers/C1/reports/aws/111/2022/05/principals.2022-05-01-0714.csv`
+		flaky     = `customers/C1/reports/aws/111/2022/05/resources.2022-05-01-0714.csv`
+		broken    = `customers/C1/reports/aws/222/2022/05/principals.2022-05-01-0714.csv`
+		truncated = `customers/C1/reports/aws/222/2022/05/resources.2022-05-01-0714.csv`
+	)
+	client := &fakeS3{
+		objects: map[string][]byte{
+			good:      []byte(`good`),
+			flaky:     []byte(`flaky`),
+			truncated: []byte(`short`),
+		},
+		failures: map[string]int{flaky: 2, broken: 1},
+		failWith: map[string]error{flaky: transientError{}, broken: errors.New(`access denied`)},
+		calls:    map[string]int{},
+	}
+
+	remote := DB{Customers: map[string]Customer{}, Objects: map[string]ObjectInfo{}}
+	for k, size := range map[string]int64{good: 4, flaky: 5, broken: 6, truncated: 10} {
+		remote.Objects[k] = ObjectInfo{Key: k, ETag: `"` + k + `"`, Size: size}
+	}
+	addReport := func(account, kind, key string) {
+		c, ok := remote.Customers[`C1`]
+		if !ok {
+			c = Customer{CustomerID: `C1`, Accounts: map[string]Account{}}
+			remote.Customers[`C1`] = c
+		}
+		a, ok := c.Accounts[account]
+		if !ok {
+			a = Account{AccountID: account, Reports: map[time.Time]LocalReport{}}
+			c.Accounts[account] = a
+		}
+		ts := parseTime(`2022-05-01-0714`)
+		r, ok := a.Reports[ts]
+		if !ok {
+			r = LocalReport{CustomerID: `C1`, Account: account, Timestamp: ts, pathByKind: map[string]string{}}
+			a.Reports[ts] = r
+		}
+		r.pathByKind[kind] = key
+	}
+	addReport(`111`, REPORT_TYPE_PREFIX_PRINCIPALS, good)
+	addReport(`111`, REPORT_TYPE_PREFIX_RESOURCES, flaky)
+	addReport(`222`, REPORT_TYPE_PREFIX_PRINCIPALS, broken)
+	addReport(`222`, REPORT_TYPE_PREFIX_RESOURCES, truncated)
+
+	accounts := remote.AccountKeys(`C1`)
+	reporter := &recordingReporter{}
+	opts := SyncOptions{Concurrency: 2, Retries: 2, Progress: reporter}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+
+	summaries, err := SyncAccounts(stdout, stderr, remote, NewS3Store(client, `bucket`), home, accounts, opts)
+	var aggregate *AggregateError
+	if !errors.As(err, &aggregate) {
+		t.Fatalf(`expected an AggregateError, was %v`, err)
+	}
+	if !aggregate.IsPartial() {
+		t.Errorf(`expected a partial failure`)
+	}
+	failed := map[string]bool{}
+	for _, e := range aggregate.Errors() {
+		var se *SyncError
+		if !errors.As(e, &se) {
+			t.Fatalf(`expected a SyncError, was %v`, e)
+		}
+		failed[se.Key] = true
+	}
+	if len(failed) != 2 || !failed[broken] || !failed[truncated] {
+		t.Errorf(`expected failures for %v and %v, was %v`, broken, truncated, aggregate.Errors())
+	}
+	if client.calls[flaky] != 3 {
+		t.Errorf(`expected the transient failure to be retried twice, was called %v times`, client.calls[flaky])
+	}
+	if client.calls[broken] != 1 {
+		t.Errorf(`expected the permanent failure not to be retried, was called %v times`, client.calls[broken])
+	}
+	if client.calls[truncated] != 3 {
+		t.Errorf(`expected the incomplete download to be retried twice, was called %v times`, client.calls[truncated])
+	}
+
+	expected := []SyncSummary{
+		{CustomerID: `C1`, Account: `111`, Downloaded: 2},
+		{CustomerID: `C1`, Account: `222`, Failed: 2},
+	}
+	for i := range expected {
+		if summaries[i] != expected[i] {
+			t.Errorf(`expected summary %v, but was %v`, expected[i], summaries[i])
+		}
+	}
+	first, last := reporter.events[0], reporter.events[len(reporter.events)-1]
+	if first.Event != PROGRESS_EVENT_START || first.FilesTotal != 4 || first.BytesTotal != 25 {
+		t.Errorf(`expected a start event with the totals, was %v`, first)
+	}
+	if last.Event != PROGRESS_EVENT_FINISH || last.FilesDone != 4 || last.FilesFailed != 2 || last.BytesDone != 9 {
+		t.Errorf(`expected a finish event counting only verified bytes, was %v`, last)
+	}
+	if b, err := os.ReadFile(localPath(home, good)); err != nil || string(b) != `good` {
+		t.Errorf(`expected the downloaded report content, was %q, %v`, b, err)
+	}
+	if _, err := os.Stat(localPath(home, truncated)); err == nil {
+		t.Errorf(`expected no local copy of the incomplete download`)
+	}
+
+	// a second sync skips the reports that are already current
+	opts.Progress = nil
+	summaries, _ = SyncAccounts(stdout, stderr, remote, NewS3Store(client, `bucket`), home, accounts[:1], opts)
+	if summaries[0].Skipped != 2 || summaries[0].Downloaded != 0 {
+		t.Errorf(`expected all reports to be skipped, was %v`, summaries[0])
+	}
+}
+
+func TestSyncCompressed(t *testing.T) {
+	home := t.TempDir()
+	key := `customers/C1/reports/aws/111/2022/05/principals.2022-05-01-0714.csv`
+	content := []byte("header\na\n")
+	client := &fakeS3{objects: map[string][]byte{key: content}, calls: map[string]int{}}
+	remote := testDB(`2022-05-01-0714`)
+	report := remote.Customers[`C1`].Accounts[`111`].Reports[parseTime(`2022-05-01-0714`)]
+	report.pathByKind = map[string]string{REPORT_TYPE_PREFIX_PRINCIPALS: key}
+	remote.Customers[`C1`].Accounts[`111`].Reports[report.Timestamp] = report
+	remote.Objects = map[string]ObjectInfo{key: {Key: key, ETag: `"e1"`, Size: int64(len(content))}}
+	accounts := remote.AccountKeys(`C1`)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+
+	opts := SyncOptions{Concurrency: 1, Compression: COMPRESSION_GZIP}
+	if _, err := SyncAccounts(stdout, stderr, remote, NewS3Store(client, `bucket`), home, accounts, opts); err != nil {
+		t.Fatalf(`unexpected error: %v`, err)
+	}
+	f, err := os.Open(localReportPath(home, key, EXT_GZ))
+	if err != nil {
+		t.Fatalf(`expected a compressed local copy, %v`, err)
+	}
+	r := &rowCollector{}
+	err = LoadReport(f, r)
+	f.Close()
+	if err != nil || len(r.rows) != 1 {
+		t.Errorf(`expected the compressed report to load, was %v, %v`, r.rows, err)
+	}
+
+	summaries, _ := SyncAccounts(stdout, stderr, remote, NewS3Store(client, `bucket`), home, accounts, opts)
+	if summaries[0].Skipped != 1 {
+		t.Errorf(`expected the compressed report to be current, was %v`, summaries[0])
+	}
+
+	// changing the compression replaces the local copy
+	opts.Compression = COMPRESSION_NONE
+	SyncAccounts(stdout, stderr, remote, NewS3Store(client, `bucket`), home, accounts, opts)
+	if _, err = os.Stat(localReportPath(home, key, EXT_GZ)); !os.IsNotExist(err) {
+		t.Errorf(`expected the compressed copy to be removed, %v`, err)
+	}
+	if _, err = os.Stat(localPath(home, key)); err != nil {
+		t.Errorf(`expected an uncompressed copy, %v`, err)
+	}
+
+	opts.Compression = COMPRESSION_ZSTD
+	if _, err = SyncAccounts(stdout, stderr, remote, NewS3Store(client, `bucket`), home, accounts, opts); err != nil {
+		t.Fatalf(`unexpected error: %v`, err)
+	}
+	if _, err = os.Stat(localPath(home, key)); !os.IsNotExist(err) {
+		t.Errorf(`expected the uncompressed copy to be removed, %v`, err)
+	}
+	if f, err = os.Open(localReportPath(home, key, EXT_ZST)); err != nil {
+		t.Fatalf(`expected a zstd compressed local copy, %v`, err)
+	}
+	r = &rowCollector{}
+	err = LoadReport(f, r)
+	f.Close()
+	if err != nil || len(r.rows) != 1 {
+		t.Errorf(`expected the zstd compressed report to load, was %v, %v`, r.rows, err)
+	}
+	summaries, _ = SyncAccounts(stdout, stderr, remote, NewS3Store(client, `bucket`), home, accounts, opts)
+	if summaries[0].Skipped != 1 {
+		t.Errorf(`expected the zstd compressed report to be current, was %v`, summaries[0])
+	}
+}
+
+func TestSyncChecksum(t *testing.T) {
+	syncRetryBaseDelay = time.Millisecond
+	key := `customers/C1/reports/aws/111/2022/05/principals.2022-05-01-0714.csv`
+	content := []byte("header\na\n")
+	md5ETag := func(b []byte) string { return fmt.Sprintf(`"%x"`, md5.Sum(b)) }
+
+	cases := map[string]struct {
+		ETag        string
+		Encryption  types.ServerSideEncryption
+		ExpectedErr bool
+	}{
+		`Matching MD5`:   {ETag: md5ETag(content)},
+		`Mismatched MD5`: {ETag: md5ETag([]byte(`other`)), ExpectedErr: true},
+		`Upper case MD5`: {ETag: strings.ToUpper(md5ETag(content))},
+		`Multipart`:      {ETag: `"` + strings.Repeat(`a`, 32) + `-2"`},
+		`KMS encrypted`:  {ETag: md5ETag([]byte(`other`)), Encryption: types.ServerSideEncryptionAwsKms},
+		`S3 encrypted`:   {ETag: md5ETag([]byte(`other`)), Encryption: types.ServerSideEncryptionAes256, ExpectedErr: true},
+		`Not an MD5`:     {ETag: `"e1"`},
+		`No ETag`:        {},
+	}
+	for l, c := range cases {
+		home := t.TempDir()
+		client := &fakeS3{objects: map[string][]byte{key: content}, calls: map[string]int{}, encryption: c.Encryption}
+		remote := testDB(`2022-05-01-0714`)
+		report := remote.Customers[`C1`].Accounts[`111`].Reports[parseTime(`2022-05-01-0714`)]
+		report.pathByKind = map[string]string{REPORT_TYPE_PREFIX_PRINCIPALS: key}
+		remote.Customers[`C1`].Accounts[`111`].Reports[report.Timestamp] = report
+		remote.Objects = map[string]ObjectInfo{key: {Key: key, ETag: c.ETag, Size: int64(len(content))}}
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+
+		_, err := SyncAccounts(stdout, stderr, remote, NewS3Store(client, `bucket`), home,
+			remote.AccountKeys(`C1`), SyncOptions{Concurrency: 1, Retries: 1})
+		mismatched := false
+		var aggregate *AggregateError
+		if errors.As(err, &aggregate) {
+			var mismatch *checksumMismatchError
+			for _, e := range aggregate.Errors() {
+				mismatched = mismatched || errors.As(e, &mismatch)
+			}
+		}
+		if c.ExpectedErr != mismatched {
+			t.Errorf("Case: %v, expected checksum error %v, but was %v", l, c.ExpectedErr, err)
+		}
+		if _, serr := os.Stat(localPath(home, key)); c.ExpectedErr != os.IsNotExist(serr) {
+			t.Errorf("Case: %v, expected the report to be kept %v, but was %v", l, !c.ExpectedErr, serr)
+		}
+		if c.ExpectedErr && client.calls[key] != 2 {
+			t.Errorf("Case: %v, expected the download to be retried, but was %v calls", l, client.calls[key])
+		}
+	}
+}
+
+func TestSyncReplacesCorruptedReport(t *testing.T) {
+	home := t.TempDir()
+	key := `customers/C1/reports/aws/111/2022/05/principals.2022-05-01-0714.csv`
+	content := []byte("header\na\n")
+	client := &fakeS3{objects: map[string][]byte{key: content}, calls: map[string]int{}}
+	remote := testDB(`2022-05-01-0714`)
+	report := remote.Customers[`C1`].Accounts[`111`].Reports[parseTime(`2022-05-01-0714`)]
+	report.pathByKind = map[string]string{REPORT_TYPE_PREFIX_PRINCIPALS: key}
+	remote.Customers[`C1`].Accounts[`111`].Reports[report.Timestamp] = report
+	remote.Objects = map[string]ObjectInfo{key: {Key: key, ETag: `"e1"`, Size: int64(len(content))}}
+	accounts := remote.AccountKeys(`C1`)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	opts := SyncOptions{Concurrency: 1}
+
+	if _, err := SyncAccounts(stdout, stderr, remote, NewS3Store(client, `bucket`), home, accounts, opts); err != nil {
+		t.Fatalf(`unexpected error: %v`, err)
+	}
+	// corrupt the local copy without changing its size
+	if err := os.WriteFile(localPath(home, key), []byte("header\nb\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	summaries, err := SyncAccounts(stdout, stderr, remote, NewS3Store(client, `bucket`), home, accounts, opts)
+	if err != nil || summaries[0].Downloaded != 1 || summaries[0].Skipped != 0 {
+		t.Errorf(`expected the corrupted report to be downloaded again, was %v, %v`, summaries[0], err)
+	}
+	if b, _ := os.ReadFile(localPath(home, key)); !bytes.Equal(b, content) {
+		t.Errorf(`expected the corrupted report to be replaced, was %q`, b)
+	}
+}
@@ -0,0 +1,176 @@
+/*
+Copyright © 2022 The K9CLI Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bandwidthUnits maps the accepted bandwidth suffixes to a number of bytes.
+// Decimal prefixes are powers of 1000 and binary prefixes powers of 1024.
+var bandwidthUnits = map[string]int64{
+	``:    1,
+	`b`:   1,
+	`k`:   1000,
+	`kb`:  1000,
+	`kib`: 1 << 10,
+	`m`:   1000 * 1000,
+	`mb`:  1000 * 1000,
+	`mib`: 1 << 20,
+	`g`:   1000 * 1000 * 1000,
+	`gb`:  1000 * 1000 * 1000,
+	`gib`: 1 << 30,
+}
+
+// ParseBandwidth converts a bandwidth such as 500KB, 2MiB/s, or 1048576 to
+// a number of bytes per second. An empty string is unlimited and returns 0.
+func ParseBandwidth(s string) (int64, error) {
+	v := strings.ToLower(strings.TrimSpace(s))
+	if len(v) == 0 {
+		return 0, nil
+	}
+	v = strings.TrimSuffix(v, `/s`)
+	i := strings.IndexFunc(v, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(v)
+	}
+	unit, ok := bandwidthUnits[strings.TrimSpace(v[i:])]
+	if !ok {
+		return 0, &IllegalArgumentError{`bandwidth`, `unknown unit in ` + s}
+	}
+	n, err := strconv.ParseFloat(v[:i], 64)
+	if err != nil || n <= 0 {
+		return 0, &IllegalArgumentError{`bandwidth`, `must be a positive number of bytes per second, was ` + s}
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// bandwidthLimiter paces writes shared by any number of goroutines so that
+// their combined throughput does not exceed the configured bytes per second.
+type bandwidthLimiter struct {
+	mu             sync.Mutex
+	bytesPerSecond int64
+	// next is the earliest time at which the next write may proceed
+	next time.Time
+}
+
+func newBandwidthLimiter(bytesPerSecond int64) *bandwidthLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &bandwidthLimiter{bytesPerSecond: bytesPerSecond}
+}
+
+// wait blocks until n bytes may be transferred. A nil limiter never blocks.
+func (l *bandwidthLimiter) wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.bytesPerSecond))
+	l.mu.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// meteredWriterAt throttles writes through a bandwidthLimiter and reports
+// the number of bytes written to a syncProgress. Because the downloader
+// copies the response body into the writer, throttling the writes applies
+// backpressure to the network transfer.
+type meteredWriterAt struct {
+	w        io.WriterAt
+	limiter  *bandwidthLimiter
+	progress *syncProgress
+	mu       sync.Mutex
+	written  int64
+}
+
+func (m *meteredWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	m.limiter.wait(len(p))
+	n, err := m.w.WriteAt(p, off)
+	m.mu.Lock()
+	m.written += int64(n)
+	m.mu.Unlock()
+	m.progress.addBytes(int64(n))
+	return n, err
+}
+
+// discard retracts the bytes written so far from the progress, used when
+// the download is abandoned and will be retried.
+func (m *meteredWriterAt) discard() {
+	m.mu.Lock()
+	n := m.written
+	m.written = 0
+	m.mu.Unlock()
+	m.progress.addBytes(-n)
+}
+
+// rateLimiter paces events shared by any number of goroutines so that no
+// more than the configured number start per second.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	// next is the earliest time at which the next event may start
+	next time.Time
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// wait blocks until the next event may start or the context is done. A nil
+// limiter never blocks.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseBandwidth(t *testing.T) {
+	cases := map[string]struct {
+		Input    string
+		Expected int64
+		Err      bool
+	}{
+		`Empty`:         {``, 0, false},
+		`Bytes`:         {`1048576`, 1048576, false},
+		`Decimal`:       {`500KB`, 500000, false},
+		`Binary`:        {`2MiB`, 2 << 20, false},
+		`Per second`:    {`1.5 MB/s`, 1500000, false},
+		`Short`:         {`10m`, 10000000, false},
+		`Unknown unit`:  {`10 parsecs`, 0, true},
+		`Zero`:          {`0`, 0, true},
+		`Missing value`: {`MB`, 0, true},
+	}
+	for l, c := range cases {
+		o, err := ParseBandwidth(c.Input)
+		if (err != nil) != c.Err {
+			t.Errorf("Case: %v, unexpected error state: %v", l, err)
+			continue
+		}
+		if o != c.Expected {
+			t.Errorf("Case: %v, expected %v, but was %v", l, c.Expected, o)
+		}
+	}
+}
+
+func TestBandwidthLimiter(t *testing.T) {
+	if newBandwidthLimiter(0) != nil {
+		t.Errorf(`expected no limiter for unlimited bandwidth`)
+	}
+
+	// 4 writers sharing 1000 B/s transfer 400 bytes in at least 300ms, the
+	// first write proceeds immediately
+	l := newBandwidthLimiter(1000)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.wait(100)
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf(`expected writes to be paced, finished in %v`, elapsed)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	if newRateLimiter(0) != nil {
+		t.Errorf(`expected no limiter for an unlimited rate`)
+	}
+
+	// 4 events at 20 per second start over at least 150ms, the first
+	// proceeds immediately
+	l := newRateLimiter(20)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.wait(context.Background())
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf(`expected events to be paced, finished in %v`, elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.wait(ctx); err == nil {
+		t.Errorf(`expected an error once the context is done`)
+	}
+}
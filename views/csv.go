@@ -5,50 +5,259 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"sort"
 )
 
-func WriteCSVTo(o, e io.Writer, v interface{}) {
+// Nested field encodings for CSV output. Records with a nested map or slice
+// field can either be flattened into one row per leaf, or summarized with
+// one count column per map key.
+const (
+	CSV_NESTED_FLATTEN = `flatten`
+	CSV_NESTED_COUNT   = `count`
+)
+
+// WriteCSVTo writes a slice of structs as CSV, flattening any nested field.
+func WriteCSVTo(o io.Writer, v interface{}) error {
+	return WriteCSVWithModeTo(o, v, CSV_NESTED_FLATTEN)
+}
+
+// WriteCSVWithModeTo writes a slice of structs as CSV. Column labels are taken
+// from the `csv` field tags. At most one field of each struct may be a map or
+// slice; that field is encoded according to the provided mode.
+//
+// In flatten mode each leaf of the nested field produces a row containing
+// the scalar fields of the parent record. Map keys are written to a column
+// labelled by the `csvkey` tag on the nested field, and struct leaves
+// contribute their own `csv` tagged fields.
+//
+// In count mode the nested field is replaced with one column per distinct
+// map key holding the number of values for that key, or a single count
+// column for slices.
+func WriteCSVWithModeTo(o io.Writer, v interface{}, mode string) error {
+	if mode != CSV_NESTED_FLATTEN && mode != CSV_NESTED_COUNT {
+		return fmt.Errorf(`invalid nested csv mode: %v`, mode)
+	}
 	top := reflect.TypeOf(v)
-	if k := top.Kind(); k != reflect.Slice {
-		panic(`called WriteCSVTo with a non-slice parameter`)
+	if top == nil || top.Kind() != reflect.Slice {
+		return fmt.Errorf(`csv output requires a slice, got %v`, top)
 	}
 	vv := reflect.ValueOf(v)
 
-	t := reflect.TypeOf(v).Elem()
+	t := top.Elem()
 	if k := t.Kind(); k != reflect.Struct {
-		panic(`called WriteCSVTo with a non-slice-of-struct parameter`)
+		return fmt.Errorf(`csv output requires a slice of structs, got a slice of %v`, t)
 	}
 
-	records := [][]string{}
-	fields := []reflect.StructField{}
-	var field reflect.StructField
-	fieldLabels := []string{}
-
-	// reflect all the fields and build the header row
+	// reflect all the fields and separate the scalars from the nested field
+	scalars := []reflect.StructField{}
+	var nested *reflect.StructField
 	for i := 0; i < t.NumField(); i++ {
-		field = t.Field(i)
-		fields = append(fields, field)
-		fieldLabels = append(fieldLabels, field.Tag.Get(`csv`))
+		field := t.Field(i)
+		if !isNested(field.Type) {
+			scalars = append(scalars, field)
+			continue
+		}
+		if nested != nil {
+			return fmt.Errorf(`csv output supports at most one nested field, %v has %v and %v`,
+				t.Name(), nested.Name, field.Name)
+		}
+		nested = &field
+	}
+
+	var records [][]string
+	var err error
+	if nested == nil {
+		records = flatRecords(vv, scalars)
+	} else if mode == CSV_NESTED_COUNT {
+		records = countRecords(vv, scalars, *nested)
+	} else {
+		records, err = flattenRecords(vv, scalars, *nested)
+		if err != nil {
+			return err
+		}
+	}
+
+	// write it all
+	return csv.NewWriter(o).WriteAll(records)
+}
+
+func isNested(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Map:
+		return true
+	case reflect.Slice, reflect.Array:
+		// byte slices are written as scalar values
+		return t.Elem().Kind() != reflect.Uint8
+	}
+	return false
+}
+
+func labels(fields []reflect.StructField) []string {
+	out := []string{}
+	for _, f := range fields {
+		out = append(out, f.Tag.Get(`csv`))
+	}
+	return out
+}
+
+func values(r reflect.Value, fields []reflect.StructField) []string {
+	out := []string{}
+	for _, f := range fields {
+		out = append(out, fmt.Sprintf("%v", r.FieldByName(f.Name)))
+	}
+	return out
+}
+
+func sortedKeys(m reflect.Value) []reflect.Value {
+	keys := m.MapKeys()
+	sort.Slice(keys, func(p, q int) bool {
+		return fmt.Sprintf("%v", keys[p]) < fmt.Sprintf("%v", keys[q])
+	})
+	return keys
+}
+
+// flatRecords builds a header and one row per record for structs without a
+// nested field.
+func flatRecords(vv reflect.Value, scalars []reflect.StructField) [][]string {
+	records := [][]string{labels(scalars)}
+	for i := 0; i < vv.Len(); i++ {
+		records = append(records, values(vv.Index(i), scalars))
+	}
+	return records
+}
+
+// flattenRecords builds a header and one row per leaf value in the nested
+// field of each record. Records with an empty nested field still produce a
+// single row so that they are not lost from the output.
+func flattenRecords(vv reflect.Value, scalars []reflect.StructField, nested reflect.StructField) ([][]string, error) {
+	nt := nested.Type
+	isMap := nt.Kind() == reflect.Map
+	lt := nt.Elem()
+	if isMap && isNested(lt) {
+		lt = lt.Elem()
+	}
+	if isNested(lt) {
+		return nil, fmt.Errorf(`csv output does not support field %v of type %v`, nested.Name, nt)
+	}
+
+	// leaves are either structs with their own fields or single values
+	leafFields := []reflect.StructField{}
+	if lt.Kind() == reflect.Struct {
+		for i := 0; i < lt.NumField(); i++ {
+			leafFields = append(leafFields, lt.Field(i))
+		}
+	}
+
+	header := labels(scalars)
+	if isMap {
+		key := nested.Tag.Get(`csvkey`)
+		if len(key) <= 0 {
+			key = nested.Tag.Get(`csv`) + `_key`
+		}
+		header = append(header, key)
 	}
-	records = append(records, fieldLabels)
+	if len(leafFields) > 0 {
+		header = append(header, labels(leafFields)...)
+	} else {
+		header = append(header, nested.Tag.Get(`csv`))
+	}
+	records := [][]string{header}
+
+	leaf := func(v reflect.Value) []string {
+		if len(leafFields) > 0 {
+			return values(v, leafFields)
+		}
+		return []string{fmt.Sprintf("%v", v)}
+	}
+	emptyLeaf := len(leafFields)
+	if emptyLeaf == 0 {
+		emptyLeaf = 1
+	}
+
 	for i := 0; i < vv.Len(); i++ {
-		// retrieve the record as a Value
 		r := vv.Index(i)
+		prefix := values(r, scalars)
+		nv := r.FieldByName(nested.Name)
+		rows := [][]string{}
+		if isMap {
+			for _, k := range sortedKeys(nv) {
+				mv := nv.MapIndex(k)
+				if !isNested(mv.Type()) {
+					rows = append(rows, append([]string{fmt.Sprintf("%v", k)}, leaf(mv)...))
+					continue
+				}
+				for j := 0; j < mv.Len(); j++ {
+					rows = append(rows, append([]string{fmt.Sprintf("%v", k)}, leaf(mv.Index(j))...))
+				}
+			}
+		} else {
+			for j := 0; j < nv.Len(); j++ {
+				rows = append(rows, leaf(nv.Index(j)))
+			}
+		}
+		if len(rows) <= 0 {
+			width := emptyLeaf
+			if isMap {
+				width++
+			}
+			rows = append(rows, make([]string, width))
+		}
+		for _, row := range rows {
+			records = append(records, append(append([]string{}, prefix...), row...))
+		}
+	}
+	return records, nil
+}
 
-		row := []string{}
-		for _, f := range fields {
-			row = append(row, fmt.Sprintf("%v", r.FieldByName(f.Name)))
+// countRecords builds a header and one row per record, replacing the nested
+// field with count columns.
+func countRecords(vv reflect.Value, scalars []reflect.StructField, nested reflect.StructField) [][]string {
+	header := labels(scalars)
+	if nested.Type.Kind() != reflect.Map {
+		records := [][]string{append(header, nested.Tag.Get(`csv`)+`_count`)}
+		for i := 0; i < vv.Len(); i++ {
+			r := vv.Index(i)
+			records = append(records,
+				append(values(r, scalars), fmt.Sprintf("%d", r.FieldByName(nested.Name).Len())))
 		}
-		records = append(records, row)
+		return records
 	}
 
-	// write it all
-	w := csv.NewWriter(o)
-	err := w.WriteAll(records)
-	if err != nil {
-		fmt.Fprintln(e, err)
+	// the count columns are the union of the keys in all records
+	seen := map[string]bool{}
+	keys := []string{}
+	for i := 0; i < vv.Len(); i++ {
+		for _, k := range vv.Index(i).FieldByName(nested.Name).MapKeys() {
+			ks := fmt.Sprintf("%v", k)
+			if !seen[ks] {
+				seen[ks] = true
+				keys = append(keys, ks)
+			}
+		}
 	}
-	if err = w.Error(); err != nil {
-		fmt.Fprintln(e, err)
+	sort.Strings(keys)
+	for _, k := range keys {
+		header = append(header, k+`_count`)
+	}
+
+	records := [][]string{header}
+	for i := 0; i < vv.Len(); i++ {
+		r := vv.Index(i)
+		counts := map[string]int{}
+		nv := r.FieldByName(nested.Name)
+		for _, k := range nv.MapKeys() {
+			mv := nv.MapIndex(k)
+			n := 1
+			if isNested(mv.Type()) {
+				n = mv.Len()
+			}
+			counts[fmt.Sprintf("%v", k)] = n
+		}
+		row := values(r, scalars)
+		for _, k := range keys {
+			row = append(row, fmt.Sprintf("%d", counts[k]))
+		}
+		records = append(records, row)
 	}
+	return records
 }
@@ -0,0 +1,114 @@
+package views
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+type csvLeaf struct {
+	ARN string `csv:"arn"`
+}
+
+type csvNestedMap struct {
+	Name   string               `csv:"name"`
+	ByKind map[string][]csvLeaf `csv:"by_kind" csvkey:"kind"`
+}
+
+type csvNestedSlice struct {
+	Name   string    `csv:"name"`
+	Leaves []csvLeaf `csv:"leaves"`
+}
+
+type csvTwoNested struct {
+	A []string `csv:"a"`
+	B []string `csv:"b"`
+}
+
+func TestWriteCSVWithModeTo(t *testing.T) {
+	cases := map[string]struct {
+		Input       interface{}
+		Mode        string
+		Expected    string
+		ExpectedErr bool
+	}{
+		`Flat structs`: {
+			Input:    []csvLeaf{{`x`}, {`y`}},
+			Mode:     CSV_NESTED_FLATTEN,
+			Expected: "arn\nx\ny\n",
+		},
+		`Flatten map of slices`: {
+			Input: []csvNestedMap{
+				{`p`, map[string][]csvLeaf{`write`: {{`b`}}, `read`: {{`a`}, {`b`}}}},
+				{`q`, map[string][]csvLeaf{}},
+			},
+			Mode:     CSV_NESTED_FLATTEN,
+			Expected: "name,kind,arn\np,read,a\np,read,b\np,write,b\nq,,\n",
+		},
+		`Count map of slices`: {
+			Input: []csvNestedMap{
+				{`p`, map[string][]csvLeaf{`write`: {{`b`}}, `read`: {{`a`}, {`b`}}}},
+				{`q`, map[string][]csvLeaf{`delete`: {{`c`}}}},
+			},
+			Mode:     CSV_NESTED_COUNT,
+			Expected: "name,delete_count,read_count,write_count\np,0,2,1\nq,1,0,0\n",
+		},
+		`Flatten slice`: {
+			Input:    []csvNestedSlice{{`p`, []csvLeaf{{`a`}, {`b`}}}},
+			Mode:     CSV_NESTED_FLATTEN,
+			Expected: "name,arn\np,a\np,b\n",
+		},
+		`Count slice`: {
+			Input:    []csvNestedSlice{{`p`, []csvLeaf{{`a`}, {`b`}}}},
+			Mode:     CSV_NESTED_COUNT,
+			Expected: "name,leaves_count\np,2\n",
+		},
+		`Non-slice input`: {
+			Input:       csvLeaf{`x`},
+			Mode:        CSV_NESTED_FLATTEN,
+			ExpectedErr: true,
+		},
+		`Slice of non-structs`: {
+			Input:       []string{`x`},
+			Mode:        CSV_NESTED_FLATTEN,
+			ExpectedErr: true,
+		},
+		`Multiple nested fields`: {
+			Input:       []csvTwoNested{},
+			Mode:        CSV_NESTED_FLATTEN,
+			ExpectedErr: true,
+		},
+		`Invalid mode`: {
+			Input:       []csvLeaf{},
+			Mode:        `bogus`,
+			ExpectedErr: true,
+		},
+	}
+	for l, c := range cases {
+		o := &bytes.Buffer{}
+		err := WriteCSVWithModeTo(o, c.Input, c.Mode)
+		if err == nil && c.ExpectedErr {
+			t.Errorf("Case: %v, missing expected error", l)
+		}
+		if err != nil && !c.ExpectedErr {
+			t.Errorf("Case: %v, unexpected error: %v", l, err)
+		}
+		if !c.ExpectedErr && o.String() != c.Expected {
+			t.Errorf("Case: %v, expected output %q, but was %q", l, c.Expected, o.String())
+		}
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New(`disk full`)
+}
+
+func TestDisplayCSVWriteError(t *testing.T) {
+	e := &bytes.Buffer{}
+	Display(failingWriter{}, e, `csv`, []csvLeaf{{`x`}})
+	if expected := "unable to write report as csv, disk full\n"; e.String() != expected {
+		t.Errorf("Case: write error, expected %q, but was %q", expected, e.String())
+	}
+}
@@ -6,14 +6,47 @@ import (
 	"io"
 )
 
+// Options adjust how a report is rendered in the selected output format.
+type Options struct {
+	// CSVNested is one of CSV_NESTED_FLATTEN or CSV_NESTED_COUNT.
+	CSVNested string
+	// Metadata, when set, describes the report. JSON output then becomes an
+	// object with the metadata and the report under the items field.
+	Metadata interface{}
+}
+
 func Display(stdout, stderr io.Writer, format string, report interface{}) {
+	DisplayWithOptions(stdout, stderr, format, report, Options{CSVNested: CSV_NESTED_FLATTEN})
+}
+
+func DisplayWithOptions(stdout, stderr io.Writer, format string, report interface{}, opts Options) {
 	switch format {
 	case `pdf`:
 	case `csv`:
-		WriteCSVTo(stdout, stderr, report)
+		if err := WriteCSVWithModeTo(stdout, report, opts.CSVNested); err != nil {
+			fmt.Fprintf(stderr, "unable to write report as csv, %v\n", err)
+		}
 	case `tap`:
+	case `junit`:
+		switch r := report.(type) {
+		case JUnitTestSuite:
+			WriteJUnitTo(stdout, stderr, r)
+		case []JUnitTestSuite:
+			WriteJUnitTo(stdout, stderr, r...)
+		default:
+			fmt.Fprintln(stderr, `junit output is not supported for this report`)
+		}
 	case `json`:
-		b, err := json.Marshal(report)
+		var b []byte
+		var err error
+		if opts.Metadata != nil {
+			b, err = json.Marshal(struct {
+				Metadata interface{} `json:"metadata"`
+				Items    interface{} `json:"items"`
+			}{opts.Metadata, report})
+		} else {
+			b, err = json.Marshal(report)
+		}
 		if err != nil {
 			fmt.Fprintln(stderr, `unable to marshal report to json`)
 		}
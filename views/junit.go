@@ -0,0 +1,91 @@
+package views
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// JUnitTestSuites is the document root of a JUnit XML report.
+type JUnitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []JUnitTestSuite `xml:"testsuite"`
+}
+
+// JUnitTestSuite groups the test cases evaluated by a single check, e.g. one
+// risk subcommand.
+type JUnitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []JUnitTestCase `xml:"testcase"`
+}
+
+// JUnitTestCase represents a single evaluated subject, e.g. a principal or
+// resource. A nil Failure means the case passed.
+type JUnitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *JUnitFailure `xml:"failure,omitempty"`
+}
+
+type JUnitFailure struct {
+	Message  string `xml:"message,attr"`
+	Type     string `xml:"type,attr"`
+	Contents string `xml:",chardata"`
+}
+
+// NewJUnitTestSuite creates an empty suite with the provided name.
+func NewJUnitTestSuite(name string) JUnitTestSuite {
+	return JUnitTestSuite{Name: name, Cases: []JUnitTestCase{}}
+}
+
+// Pass records a passing test case in the suite.
+func (s *JUnitTestSuite) Pass(className, name string) {
+	s.Tests++
+	s.Cases = append(s.Cases, JUnitTestCase{Name: name, ClassName: className})
+}
+
+// Fail records a failing test case in the suite with the provided message.
+func (s *JUnitTestSuite) Fail(className, name, message string) {
+	s.Tests++
+	s.Failures++
+	s.Cases = append(s.Cases, JUnitTestCase{
+		Name:      name,
+		ClassName: className,
+		Failure: &JUnitFailure{
+			Message:  message,
+			Type:     s.Name,
+			Contents: message,
+		},
+	})
+}
+
+// Check records a test case that fails with the violations joined into its
+// message, or passes when there are none.
+func (s *JUnitTestSuite) Check(className, name string, violations []string) {
+	if len(violations) > 0 {
+		s.Fail(className, name, strings.Join(violations, `, `))
+	} else {
+		s.Pass(className, name)
+	}
+}
+
+// WriteJUnitTo writes the provided suites as a single JUnit XML document.
+func WriteJUnitTo(o, e io.Writer, suites ...JUnitTestSuite) {
+	doc := JUnitTestSuites{Suites: suites}
+	for _, s := range suites {
+		doc.Tests += s.Tests
+		doc.Failures += s.Failures
+	}
+	b, err := xml.MarshalIndent(doc, ``, `  `)
+	if err != nil {
+		fmt.Fprintln(e, `unable to marshal report to junit`)
+		return
+	}
+	fmt.Fprint(o, xml.Header)
+	fmt.Fprintln(o, string(b))
+}
@@ -0,0 +1,166 @@
+package views
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+type junitCase struct {
+	ClassName string
+	Name      string
+	Failure   string
+}
+
+func junitSuite(name string, cases ...junitCase) JUnitTestSuite {
+	s := NewJUnitTestSuite(name)
+	for _, c := range cases {
+		if len(c.Failure) > 0 {
+			s.Fail(c.ClassName, c.Name, c.Failure)
+		} else {
+			s.Pass(c.ClassName, c.Name)
+		}
+	}
+	return s
+}
+
+func TestDisplayJUnit(t *testing.T) {
+	cases := map[string]struct {
+		Report           interface{}
+		ExpectedSuites   int
+		ExpectedTests    int
+		ExpectedFailures int
+		ExpectedMessages []string
+		ExpectedErr      bool
+	}{
+		`Empty suite`: {
+			Report:         NewJUnitTestSuite(`over-permissioned-principals`),
+			ExpectedSuites: 1,
+		},
+		`Passing and failing cases`: {
+			Report: junitSuite(`over-permissioned-principals`,
+				junitCase{`IAMUser`, `arn:aws:iam::123456789012:user/ci`, ``},
+				junitCase{`IAMRole`, `arn:aws:iam::123456789012:role/admin`, `admin-resources: 7 > 5`},
+				junitCase{`IAMRole`, `arn:aws:iam::123456789012:role/ops`, `read-data: 9 > 5, write-data: 6 > 5`}),
+			ExpectedSuites:   1,
+			ExpectedTests:    3,
+			ExpectedFailures: 2,
+			ExpectedMessages: []string{`admin-resources: 7 > 5`, `read-data: 9 > 5, write-data: 6 > 5`},
+		},
+		`Escaped finding text`: {
+			Report: junitSuite(`over-accessible-resources`,
+				junitCase{`s3`, `arn:aws:s3:::a&b`, `<admin> & "read": 6 > 5 'caps'`}),
+			ExpectedSuites:   1,
+			ExpectedTests:    1,
+			ExpectedFailures: 1,
+			ExpectedMessages: []string{`<admin> & "read": 6 > 5 'caps'`},
+		},
+		`Multiple suites`: {
+			Report: []JUnitTestSuite{
+				junitSuite(`a`, junitCase{`x`, `1`, ``}, junitCase{`x`, `2`, `bad`}),
+				junitSuite(`b`, junitCase{`y`, `3`, `worse`}),
+			},
+			ExpectedSuites:   2,
+			ExpectedTests:    3,
+			ExpectedFailures: 2,
+			ExpectedMessages: []string{`bad`, `worse`},
+		},
+		`Unsupported report`: {
+			Report:      []csvLeaf{{`x`}},
+			ExpectedErr: true,
+		},
+	}
+	for l, c := range cases {
+		o := &bytes.Buffer{}
+		e := &bytes.Buffer{}
+		Display(o, e, `junit`, c.Report)
+		if c.ExpectedErr {
+			if e.Len() == 0 || o.Len() != 0 {
+				t.Errorf("Case: %v, expected an error and no output, but was %q, %q", l, o.String(), e.String())
+			}
+			continue
+		}
+		if e.Len() != 0 {
+			t.Errorf("Case: %v, unexpected error: %v", l, e.String())
+		}
+		if !strings.HasPrefix(o.String(), xml.Header) {
+			t.Errorf("Case: %v, expected the xml header, but was %q", l, o.String())
+		}
+
+		if strings.Contains(o.String(), `<admin>`) {
+			t.Errorf("Case: %v, expected finding text to be escaped, but was %q", l, o.String())
+		}
+
+		doc := JUnitTestSuites{}
+		if err := xml.Unmarshal(o.Bytes(), &doc); err != nil {
+			t.Errorf("Case: %v, output is not well-formed xml: %v", l, err)
+			continue
+		}
+		if len(doc.Suites) != c.ExpectedSuites {
+			t.Errorf("Case: %v, expected %v suites, but was %v", l, c.ExpectedSuites, len(doc.Suites))
+		}
+		if doc.Tests != c.ExpectedTests {
+			t.Errorf("Case: %v, expected %v tests, but was %v", l, c.ExpectedTests, doc.Tests)
+		}
+		if doc.Failures != c.ExpectedFailures {
+			t.Errorf("Case: %v, expected %v failures, but was %v", l, c.ExpectedFailures, doc.Failures)
+		}
+
+		testcases, failures := 0, []string{}
+		for _, s := range doc.Suites {
+			if s.Tests != len(s.Cases) {
+				t.Errorf("Case: %v, suite %v expected %v tests, but was %v", l, s.Name, len(s.Cases), s.Tests)
+			}
+			testcases += len(s.Cases)
+			for _, tc := range s.Cases {
+				if tc.Failure == nil {
+					continue
+				}
+				if tc.Failure.Message != tc.Failure.Contents {
+					t.Errorf("Case: %v, expected message %q in the failure body, but was %q", l, tc.Failure.Message, tc.Failure.Contents)
+				}
+				if tc.Failure.Type != s.Name {
+					t.Errorf("Case: %v, expected failure type %v, but was %v", l, s.Name, tc.Failure.Type)
+				}
+				failures = append(failures, tc.Failure.Message)
+			}
+		}
+		if testcases != c.ExpectedTests {
+			t.Errorf("Case: %v, expected %v testcases, but was %v", l, c.ExpectedTests, testcases)
+		}
+		if strings.Join(failures, `|`) != strings.Join(c.ExpectedMessages, `|`) {
+			t.Errorf("Case: %v, expected failures %q, but was %q", l, c.ExpectedMessages, failures)
+		}
+	}
+}
+
+func TestJUnitTestSuiteCheck(t *testing.T) {
+	cases := map[string]struct {
+		Violations      []string
+		ExpectedFailure string
+	}{
+		`No violations`:       {},
+		`Empty violations`:    {Violations: []string{}},
+		`Single violation`:    {Violations: []string{`admin: 6 > 5`}, ExpectedFailure: `admin: 6 > 5`},
+		`Multiple violations`: {Violations: []string{`read: 9 > 5`, `write: 6 > 5`}, ExpectedFailure: `read: 9 > 5, write: 6 > 5`},
+	}
+	for l, c := range cases {
+		s := NewJUnitTestSuite(`risks`)
+		s.Check(`IAMRole`, `arn:aws:iam::123456789012:role/ops`, c.Violations)
+		if s.Tests != 1 || len(s.Cases) != 1 {
+			t.Errorf("Case: %v, expected 1 test, but was %v", l, s.Tests)
+			continue
+		}
+		failure := ``
+		if f := s.Cases[0].Failure; f != nil {
+			failure = f.Message
+		}
+		if failure != c.ExpectedFailure {
+			t.Errorf("Case: %v, expected failure %q, but was %q", l, c.ExpectedFailure, failure)
+		}
+		if expected := len(c.ExpectedFailure) > 0; (s.Failures == 1) != expected {
+			t.Errorf("Case: %v, expected failed %v, but was %v failures", l, expected, s.Failures)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package views
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// sparkTicks are the bar heights used by Sparkline, lowest first.
+var sparkTicks = []rune(`▁▂▃▄▅▆▇█`)
+
+// Sparkline renders a series as a single line of bars scaled between the
+// smallest and largest value. A flat series renders as the lowest bar.
+func Sparkline(values []int) string {
+	if len(values) == 0 {
+		return ``
+	}
+	min, max := values[0], values[0]
+	for _, v := range values {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if max > min {
+			i = (v - min) * (len(sparkTicks) - 1) / (max - min)
+		}
+		b.WriteRune(sparkTicks[i])
+	}
+	return b.String()
+}
+
+// Series is a named sequence of values for WriteSparklinesTo.
+type Series struct {
+	Name   string
+	Values []int
+}
+
+// WriteSparklinesTo writes one line per series with its sparkline followed
+// by the first and last value and the change between them.
+func WriteSparklinesTo(o io.Writer, series ...Series) {
+	width := 0
+	for _, s := range series {
+		if len(s.Name) > width {
+			width = len(s.Name)
+		}
+	}
+	for _, s := range series {
+		if len(s.Values) == 0 {
+			fmt.Fprintf(o, "%-*s\n", width, s.Name)
+			continue
+		}
+		first, last := s.Values[0], s.Values[len(s.Values)-1]
+		fmt.Fprintf(o, "%-*s  %s  %d -> %d (%+d)\n", width, s.Name, Sparkline(s.Values), first, last, last-first)
+	}
+}
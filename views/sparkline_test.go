@@ -0,0 +1,33 @@
+package views
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSparkline(t *testing.T) {
+	cases := map[string]struct {
+		Input    []int
+		Expected string
+	}{
+		`Empty`:      {[]int{}, ``},
+		`Single`:     {[]int{3}, `▁`},
+		`Flat`:       {[]int{2, 2, 2}, `▁▁▁`},
+		`Increasing`: {[]int{0, 1, 2, 3, 4, 5, 6, 7}, `▁▂▃▄▅▆▇█`},
+		`Scaled`:     {[]int{10, 20, 15}, `▁█▄`},
+	}
+	for l, c := range cases {
+		if o := Sparkline(c.Input); o != c.Expected {
+			t.Errorf("Case: %v, expected %v, but was %v", l, c.Expected, o)
+		}
+	}
+}
+
+func TestWriteSparklinesTo(t *testing.T) {
+	out := &bytes.Buffer{}
+	WriteSparklinesTo(out, Series{`admins`, []int{3, 1}}, Series{`principals`, []int{5, 5}})
+	expected := "admins      █▁  3 -> 1 (-2)\nprincipals  ▁▁  5 -> 5 (+0)\n"
+	if out.String() != expected {
+		t.Errorf("Case: output, expected %q, but was %q", expected, out.String())
+	}
+}